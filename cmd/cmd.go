@@ -3,18 +3,25 @@ package cmd
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	gitleaksconfig "github.com/zricethezav/gitleaks/v8/config"
 
 	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/fs"
+	"github.com/leaktk/leaktk/pkg/http"
 	"github.com/leaktk/leaktk/pkg/id"
 	"github.com/leaktk/leaktk/pkg/logger"
 	"github.com/leaktk/leaktk/pkg/response"
@@ -106,11 +113,17 @@ func runScan(cmd *cobra.Command, args []string) {
 			leaksFound = true
 		}
 		fmt.Println(formatter.Format(response))
-		wg.Done()
+
+		// Streamed results end with a summary that isn't partial
+		if !response.Partial {
+			wg.Done()
+		}
 	})
 
 	wg.Add(1)
-	leakScanner.Send(request)
+	if err := leakScanner.Send(request); err != nil {
+		logger.Fatal("could not queue request: error=%q", err)
+	}
 	wg.Wait()
 
 	if leaksFound {
@@ -166,6 +179,12 @@ func scanCommandToRequest(cmd *cobra.Command, args []string) (*scanner.Request,
 		return nil, fmt.Errorf("could not parse options: error=%q", err)
 	}
 
+	if baseline, err := flags.GetString("baseline"); err == nil && len(baseline) > 0 {
+		if _, isSet := options["baseline"]; !isSet {
+			options["baseline"] = baseline
+		}
+	}
+
 	// automatically set the is local flag
 	if _, isSet := options["local"]; !isSet {
 		if strings.ToLower(kind) == "gitrepo" {
@@ -205,21 +224,162 @@ func scanCommand() *cobra.Command {
 		Run:                   runScan,
 	}
 
-	flags := scanCommand.Flags()
+	addScanRequestFlags(scanCommand)
+	scanCommand.Flags().Int("leak-exit-code", 0, "the exit code when leaks are found (default 0)")
+
+	return scanCommand
+}
+
+// addScanRequestFlags adds the flags read by scanCommandToRequest
+func addScanRequestFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
 	flags.StringP("id", "", id.ID(), "an ID for associating responses to requests")
 	flags.StringP("kind", "k", "GitRepo", "the kind of resource to scan")
 	flags.StringP("resource", "r", "", "the resource to scan (required)")
 	flags.StringP("options", "o", "{}", "additional request options formatted as JSON")
-	flags.Int("leak-exit-code", 0, "the exit code when leaks are found (default 0)")
+	flags.StringP("baseline", "b", "", "a results file of known leaks to leave out of the response")
+}
 
-	return scanCommand
+func runBaselineCreate(cmd *cobra.Command, args []string) {
+	outputPath, err := cmd.Flags().GetString("output")
+	if err != nil || len(outputPath) == 0 {
+		logger.Fatal("missing required flag: flag=\"output\"")
+	}
+
+	request, err := scanCommandToRequest(cmd, args)
+	if err != nil {
+		logger.Fatal("could not generate scan request: error=%q", err.Error())
+	}
+
+	// Baselines only need the fingerprints so never store the secrets in them
+	request.Options.Redact = 100
+	// The baseline is written from a single response
+	request.Options.Stream = false
+
+	var wg sync.WaitGroup
+	var baselineResponse *response.Response
+	leakScanner := scanner.NewScanner(cfg)
+
+	go leakScanner.Recv(func(response *response.Response) {
+		baselineResponse = response
+		wg.Done()
+	})
+
+	wg.Add(1)
+	if err := leakScanner.Send(request); err != nil {
+		logger.Fatal("could not queue request: error=%q", err)
+	}
+	wg.Wait()
+
+	// An incomplete scan would make a baseline that hides real leaks later
+	if baselineResponse.Status != response.StatusSuccess {
+		logger.Fatal("could not create baseline: status=%q errors=%q", baselineResponse.Status, baselineResponse.Errors)
+	}
+
+	if err := scanner.WriteBaseline(outputPath, baselineResponse); err != nil {
+		logger.Fatal("could not create baseline: error=%q", err)
+	}
+
+	logger.Info("baseline created: path=%q results=%d", outputPath, len(baselineResponse.Results))
 }
 
-func readLine(reader *bufio.Reader) ([]byte, error) {
+func runBaselineDiff(cmd *cobra.Command, args []string) {
+	newExitCode, err := cmd.Flags().GetInt("new-exit-code")
+	if err != nil {
+		logger.Fatal("invalid new-exit-code: error=%q", err.Error())
+	}
+
+	previous, err := scanner.ReadResultsFile(args[0])
+	if err != nil {
+		logger.Fatal("could not read previous results: error=%q", err)
+	}
+
+	current, err := scanner.ReadResultsFile(args[1])
+	if err != nil {
+		logger.Fatal("could not read current results: error=%q", err)
+	}
+
+	diff := scanner.DiffResults(previous, current)
+	out, err := json.Marshal(diff)
+	if err != nil {
+		logger.Fatal("could not marshal diff: error=%q", err)
+	}
+
+	fmt.Println(string(out))
+	logger.Info("baseline diff: new=%d fixed=%d unchanged=%d", len(diff.New), len(diff.Fixed), len(diff.Unchanged))
+
+	if len(diff.New) > 0 {
+		os.Exit(newExitCode)
+	}
+}
+
+func baselineCreateCommand() *cobra.Command {
+	baselineCreateCommand := &cobra.Command{
+		Use:                   "create [flags] --output path {-r resource|resource}",
+		DisableFlagsInUseLine: true,
+		Short:                 "Scan a resource and save the results as a baseline",
+		Args:                  cobra.MaximumNArgs(1),
+		Run:                   runBaselineCreate,
+	}
+
+	addScanRequestFlags(baselineCreateCommand)
+	baselineCreateCommand.Flags().StringP("output", "O", "", "where to write the baseline (required)")
+
+	return baselineCreateCommand
+}
+
+func baselineDiffCommand() *cobra.Command {
+	baselineDiffCommand := &cobra.Command{
+		Use:   "diff previous-results current-results",
+		Short: "Show new, fixed and unchanged results between two results files",
+		Args:  cobra.ExactArgs(2),
+		Run:   runBaselineDiff,
+	}
+
+	baselineDiffCommand.Flags().Int("new-exit-code", 0, "the exit code when new results are found (default 0)")
+
+	return baselineDiffCommand
+}
+
+func baselineCommand() *cobra.Command {
+	baselineCommand := &cobra.Command{
+		Use:   "baseline",
+		Short: "Manage baselines of known results",
+		Run:   runHelp,
+	}
+
+	baselineCommand.AddCommand(baselineCreateCommand())
+	baselineCommand.AddCommand(baselineDiffCommand())
+
+	return baselineCommand
+}
+
+// errRequestTooLarge is returned by readLine when a line is over the max size
+var errRequestTooLarge = errors.New("request too large")
+
+// readLine reads the next line without its newline. If maxSize is set and the
+// line is longer, it stops keeping the line once it's over maxSize, discards
+// the rest of it and returns errRequestTooLarge.
+func readLine(reader *bufio.Reader, maxSize int) ([]byte, error) {
 	var buf bytes.Buffer
 
 	for {
 		line, isPrefix, err := reader.ReadLine()
+
+		if maxSize > 0 && buf.Len()+len(line) > maxSize {
+			// Skip to the end of the line so the next read starts with the
+			// next request
+			for isPrefix && err == nil {
+				_, isPrefix, err = reader.ReadLine()
+			}
+
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("%w: max_request_size=%d", errRequestTooLarge, maxSize)
+		}
+
 		buf.Write(line)
 
 		if err != nil || !isPrefix {
@@ -228,6 +388,93 @@ func readLine(reader *bufio.Reader) ([]byte, error) {
 	}
 }
 
+// reloadKind is the kind of listen request that reloads the config and
+// patterns instead of scanning something
+const reloadKind = "Reload"
+
+// reloadLock keeps a SIGHUP and a reload request from reloading at the same
+// time
+var reloadLock sync.Mutex
+
+// reloadScanner loads the config again from the same place and applies it to
+// the scanner and the logger. The config loaded at startup isn't changed.
+func reloadScanner(cmd *cobra.Command, leakScanner *scanner.Scanner) error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	path, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+
+	newCfg, err := config.LocateAndLoadConfig(path)
+	if err != nil {
+		return fmt.Errorf("could not load config: error=%q", err)
+	}
+
+	if err := leakScanner.Reload(newCfg); err != nil {
+		return err
+	}
+
+	if err := logger.SetLoggerLevel(newCfg.Logger.Level); err != nil {
+		logger.Error("could not set log level: error=%q", err)
+	}
+
+	if err := setLogOutputs(newCfg.Logger.Outputs); err != nil {
+		logger.Error("could not set log outputs: error=%q", err)
+	}
+
+	return nil
+}
+
+// reloadResponse reloads the scanner for a reload request and returns the
+// response for it
+func reloadResponse(cmd *cobra.Command, leakScanner *scanner.Scanner, requestID string) *response.Response {
+	entry := logger.Entry{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		Severity: "INFO",
+		Message:  "reloaded config and patterns",
+	}
+
+	var errs []response.LeakTKError
+	if err := reloadScanner(cmd, leakScanner); err != nil {
+		logger.Error("could not reload: request_id=%q error=%q", requestID, err)
+		entry.Severity = "ERROR"
+		entry.Message = fmt.Sprintf("could not reload: error=%q", err)
+		errs = append(errs, response.LeakTKError{Fatal: true, Code: response.ReloadError, Message: entry.Message})
+	}
+
+	return &response.Response{
+		ID:        id.ID(),
+		Logs:      []logger.Entry{entry},
+		RequestID: requestID,
+		Results:   make([]*response.Result, 0),
+		Status:    response.ErrorStatus(errs),
+		Errors:    errs,
+	}
+}
+
+// rejectedResponse tells the caller the scanner wouldn't queue their request
+func rejectedResponse(requestID string, err error) *response.Response {
+	msg := fmt.Sprintf("request rejected: error=%q", err)
+
+	return &response.Response{
+		ID: id.ID(),
+		Logs: []logger.Entry{
+			{
+				Time:     time.Now().UTC().Format(time.RFC3339),
+				Severity: "ERROR",
+				Code:     logger.LogCode(logger.RequestRejected).String(),
+				Message:  msg,
+			},
+		},
+		RequestID: requestID,
+		Results:   make([]*response.Result, 0),
+		Status:    response.StatusRejected,
+		Errors:    []response.LeakTKError{{Fatal: true, Code: response.RequestRejected, Message: msg}},
+	}
+}
+
 func runListen(cmd *cobra.Command, args []string) {
 	var wg sync.WaitGroup
 
@@ -237,22 +484,80 @@ func runListen(cmd *cobra.Command, args []string) {
 	// Prints the output of the scanner as they come
 	go leakScanner.Recv(func(response *response.Response) {
 		fmt.Println(response)
-		wg.Done()
+
+		// Streamed results end with a summary that isn't partial
+		if !response.Partial {
+			wg.Done()
+		}
+	})
+
+	// Prints the events for requests that ask for them
+	leakScanner.OnEvent(func(event *response.Event) {
+		fmt.Println(event)
 	})
 
+	if len(cfg.Metrics.Address) > 0 {
+		// Stop serving metrics once the last response is sent
+		metricsCtx, stopMetrics := context.WithCancel(context.Background())
+		defer stopMetrics()
+
+		go func() {
+			logger.Info("serving metrics: address=%q", cfg.Metrics.Address)
+			if err := leakScanner.Metrics().ListenAndServe(metricsCtx, cfg.Metrics.Address); err != nil {
+				logger.Error("could not serve metrics: address=%q error=%q", cfg.Metrics.Address, err)
+			}
+		}()
+	}
+
+	// Reload the config and patterns on SIGHUP
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	go func() {
+		for range hangups {
+			logger.Info("reloading on SIGHUP")
+			if err := reloadScanner(cmd, leakScanner); err != nil {
+				logger.Error("could not reload: error=%q", err)
+			}
+		}
+	}()
+
 	// Listen for requests
 	for {
-		line, err := readLine(stdinReader)
+		line, err := readLine(stdinReader, int(leakScanner.MaxRequestSize()))
 
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
 
+			// The request wasn't read so there's no request ID to respond to
+			if errors.Is(err, errRequestTooLarge) {
+				logger.Warning("rejecting request: error=%q", err)
+				fmt.Println(rejectedResponse("", err))
+				continue
+			}
+
 			logger.Error("error reading from stdin: error=%q", err)
 			continue
 		}
 
+		var control struct {
+			ID   string `json:"id"`
+			Kind string `json:"kind"`
+		}
+
+		if json.Unmarshal(line, &control) == nil && control.Kind == reloadKind {
+			// Reloading can fetch patterns so don't hold up the requests
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fmt.Println(reloadResponse(cmd, leakScanner, control.ID))
+			}()
+			continue
+		}
+
 		var request scanner.Request
 		err = json.Unmarshal(line, &request)
 
@@ -267,7 +572,10 @@ func runListen(cmd *cobra.Command, args []string) {
 		}
 
 		wg.Add(1)
-		leakScanner.Send(&request)
+		if err := leakScanner.Send(&request); err != nil {
+			wg.Done()
+			fmt.Println(rejectedResponse(request.ID, err))
+		}
 	}
 
 	// Wait for all of the scans to complete and responses to be sent
@@ -282,6 +590,396 @@ func listenCommand() *cobra.Command {
 	}
 }
 
+func runIgnoreAdd(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	suppression := &scanner.Suppression{}
+	suppression.Fingerprint, _ = flags.GetString("fingerprint")
+	suppression.Rule, _ = flags.GetString("rule")
+	suppression.Path, _ = flags.GetString("path")
+	suppression.SecretHash, _ = flags.GetString("secret-hash")
+	suppression.Reason, _ = flags.GetString("reason")
+	suppression.Expires, _ = flags.GetString("expires")
+
+	suppressions := scanner.NewSuppressions(cfg.Scanner.SuppressionsPath)
+	if err := suppressions.Add(suppression); err != nil {
+		logger.Fatal("could not add suppression: error=%q", err)
+	}
+
+	logger.Info("suppression added: id=%q path=%q", suppression.ID, cfg.Scanner.SuppressionsPath)
+}
+
+func runIgnoreList(cmd *cobra.Command, args []string) {
+	entries, err := scanner.NewSuppressions(cfg.Scanner.SuppressionsPath).List()
+	if err != nil {
+		logger.Fatal("could not list suppressions: error=%q", err)
+	}
+
+	for _, entry := range entries {
+		out, err := json.Marshal(entry)
+		if err != nil {
+			logger.Fatal("could not marshal suppression: error=%q", err)
+		}
+
+		fmt.Println(string(out))
+	}
+}
+
+func runIgnoreRemove(cmd *cobra.Command, args []string) {
+	suppressions := scanner.NewSuppressions(cfg.Scanner.SuppressionsPath)
+
+	for _, suppressionID := range args {
+		if err := suppressions.Remove(suppressionID); err != nil {
+			logger.Fatal("could not remove suppression: error=%q", err)
+		}
+
+		logger.Info("suppression removed: id=%q", suppressionID)
+	}
+}
+
+func ignoreAddCommand() *cobra.Command {
+	ignoreAddCommand := &cobra.Command{
+		Use:   "add",
+		Short: "Suppress results matching all of the provided criteria",
+		Args:  cobra.NoArgs,
+		Run:   runIgnoreAdd,
+	}
+
+	flags := ignoreAddCommand.Flags()
+	flags.String("fingerprint", "", "match a result fingerprint")
+	flags.String("rule", "", "match a rule ID")
+	flags.String("path", "", "match a location path glob (supports * and **)")
+	flags.String("secret-hash", "", "match a result secret_hash")
+	flags.String("reason", "", "why the results are suppressed")
+	flags.String("expires", "", "stop suppressing on this date (yyyy-mm-dd)")
+
+	return ignoreAddCommand
+}
+
+func ignoreListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List suppressions",
+		Args:  cobra.NoArgs,
+		Run:   runIgnoreList,
+	}
+}
+
+func ignoreRemoveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove id [id...]",
+		Short: "Remove suppressions by ID",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   runIgnoreRemove,
+	}
+}
+
+func ignoreCommand() *cobra.Command {
+	ignoreCommand := &cobra.Command{
+		Use:   "ignore",
+		Short: "Manage suppressed results",
+		Run:   runHelp,
+	}
+
+	ignoreCommand.AddCommand(ignoreAddCommand())
+	ignoreCommand.AddCommand(ignoreListCommand())
+	ignoreCommand.AddCommand(ignoreRemoveCommand())
+
+	return ignoreCommand
+}
+
+func runPatternsExport(cmd *cobra.Command, args []string) {
+	outputPath, _ := cmd.Flags().GetString("output")
+	patterns := scanner.NewPatterns(&cfg.Scanner.Patterns, http.NewClient())
+
+	if len(outputPath) == 0 {
+		if err := patterns.ExportBundle(os.Stdout); err != nil {
+			logger.Fatal("could not export patterns: error=%q", err)
+		}
+
+		logger.Info("patterns exported: hash=%s", patterns.GitleaksConfigHash())
+		return
+	}
+
+	// Export to a temp file in the same dir and rename it so a failed export
+	// doesn't clobber an existing bundle
+	outputFile, err := os.CreateTemp(filepath.Dir(outputPath), filepath.Base(outputPath)+".*.tmp")
+	if err != nil {
+		logger.Fatal("could not open output: path=%q error=%q", outputPath, err)
+	}
+
+	err = patterns.ExportBundle(outputFile)
+	if closeErr := outputFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(outputFile.Name(), outputPath)
+	}
+
+	if err != nil {
+		_ = os.Remove(outputFile.Name())
+		logger.Fatal("could not export patterns: path=%q error=%q", outputPath, err)
+	}
+
+	logger.Info("patterns exported: path=%q hash=%s", outputPath, patterns.GitleaksConfigHash())
+}
+
+func runPatternsImport(cmd *cobra.Command, args []string) {
+	var input io.Reader = os.Stdin
+
+	if args[0] != "-" {
+		inputFile, err := os.Open(args[0])
+		if err != nil {
+			logger.Fatal("could not open bundle: path=%q error=%q", args[0], err)
+		}
+		defer inputFile.Close()
+
+		input = inputFile
+	}
+
+	patterns := scanner.NewPatterns(&cfg.Scanner.Patterns, http.NewClient())
+	imported, err := patterns.ImportBundle(input)
+	if err != nil {
+		logger.Fatal("could not import patterns: error=%q", err)
+	}
+
+	// Make sure the imported patterns load together with any local sources
+	if _, err := patterns.Gitleaks(); err != nil {
+		logger.Fatal("could not load imported patterns: error=%q", err)
+	}
+
+	logger.Info("patterns imported: sources=%d hash=%s", imported, patterns.GitleaksConfigHash())
+}
+
+func patternsExportCommand() *cobra.Command {
+	patternsExportCommand := &cobra.Command{
+		Use:   "export",
+		Short: "Fetch the patterns and save them as an offline bundle",
+		Args:  cobra.NoArgs,
+		Run:   runPatternsExport,
+	}
+
+	patternsExportCommand.Flags().StringP("output", "O", "", "where to write the bundle (default stdout)")
+
+	return patternsExportCommand
+}
+
+func patternsImportCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import bundle",
+		Short: "Load patterns from an offline bundle (- for stdin)",
+		Args:  cobra.ExactArgs(1),
+		Run:   runPatternsImport,
+	}
+}
+
+// loadPatterns returns the patterns from the config and exits if they can't
+// be loaded
+func loadPatterns() (*scanner.Patterns, *gitleaksconfig.Config) {
+	patterns := scanner.NewPatterns(&cfg.Scanner.Patterns, http.NewClient())
+
+	gitleaksConfig, err := patterns.Gitleaks()
+	if err != nil {
+		logger.Fatal("could not load patterns: error=%q", err)
+	}
+
+	return patterns, gitleaksConfig
+}
+
+// printJSON prints the value as a line of JSON
+func printJSON(value any) {
+	out, err := json.Marshal(value)
+	if err != nil {
+		logger.Fatal("could not marshal output: error=%q", err)
+	}
+
+	fmt.Println(string(out))
+}
+
+func runPatternsList(cmd *cobra.Command, args []string) {
+	_, gitleaksConfig := loadPatterns()
+
+	for _, ruleID := range gitleaksConfig.OrderedRules {
+		if rule, ok := gitleaksConfig.Rules[ruleID]; ok {
+			info := scanner.NewRuleInfo(rule)
+			printJSON(map[string]any{
+				"id":          info.ID,
+				"description": info.Description,
+				"tags":        info.Tags,
+			})
+		}
+	}
+}
+
+func runPatternsShow(cmd *cobra.Command, args []string) {
+	_, gitleaksConfig := loadPatterns()
+
+	for _, ruleID := range args {
+		rule, ok := gitleaksConfig.Rules[ruleID]
+		if !ok {
+			logger.Fatal("rule not found: rule_id=%q", ruleID)
+		}
+
+		printJSON(scanner.NewRuleInfo(rule))
+	}
+}
+
+func runPatternsFetch(cmd *cobra.Command, args []string) {
+	patterns := scanner.NewPatterns(&cfg.Scanner.Patterns, http.NewClient())
+
+	if err := patterns.Fetch(); err != nil {
+		logger.Fatal("could not fetch patterns: error=%q", err)
+	}
+
+	logger.Info("patterns fetched: hash=%s", patterns.GitleaksConfigHash())
+}
+
+func runPatternsStatus(cmd *cobra.Command, args []string) {
+	status := scanner.NewPatterns(&cfg.Scanner.Patterns, http.NewClient()).Status()
+	printJSON(status)
+
+	if len(status.Error) > 0 {
+		os.Exit(config.ExitCodeBlockingError)
+	}
+}
+
+func runPatternsTest(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	rulesFile, _ := flags.GetString("rules-file")
+	failExitCode, err := flags.GetInt("fail-exit-code")
+	if err != nil {
+		logger.Fatal("invalid fail-exit-code: error=%q", err.Error())
+	}
+
+	var gitleaksConfig *gitleaksconfig.Config
+	if len(rulesFile) > 0 {
+		rawConfig, err := os.ReadFile(rulesFile)
+		if err != nil {
+			logger.Fatal("could not read rules file: path=%q error=%q", rulesFile, err)
+		}
+
+		if gitleaksConfig, err = scanner.ParseGitleaksConfig(string(rawConfig)); err != nil {
+			logger.Fatal("could not parse rules file: path=%q error=%q", rulesFile, err)
+		}
+	} else {
+		_, gitleaksConfig = loadPatterns()
+	}
+
+	var tests []scanner.PatternTest
+	for _, path := range args {
+		fileTests, err := scanner.LoadPatternTests(path)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+
+		tests = append(tests, fileTests...)
+	}
+
+	// Tests from the flags are added after the ones from files
+	flagTest := scanner.PatternTest{Name: "flags"}
+	flagTest.Rules, _ = flags.GetStringSlice("rule")
+	flagTest.Matches, _ = flags.GetStringArray("match")
+	flagTest.NoMatches, _ = flags.GetStringArray("no-match")
+	flagTest.MatchFiles, _ = flags.GetStringArray("match-file")
+	flagTest.NoMatchFiles, _ = flags.GetStringArray("no-match-file")
+	if len(flagTest.Matches)+len(flagTest.NoMatches)+len(flagTest.MatchFiles)+len(flagTest.NoMatchFiles) > 0 {
+		tests = append(tests, flagTest)
+	}
+
+	if len(tests) == 0 {
+		logger.Fatal("no pattern tests provided")
+	}
+
+	failed := 0
+	results := scanner.RunPatternTests(gitleaksConfig, tests)
+	for _, result := range results {
+		if !result.Passed {
+			failed++
+		}
+
+		printJSON(result)
+	}
+
+	logger.Info("pattern tests: passed=%d failed=%d", len(results)-failed, failed)
+
+	if failed > 0 {
+		os.Exit(failExitCode)
+	}
+}
+
+func patternsListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the loaded rules",
+		Args:  cobra.NoArgs,
+		Run:   runPatternsList,
+	}
+}
+
+func patternsShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show rule [rule...]",
+		Short: "Show the details of loaded rules",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   runPatternsShow,
+	}
+}
+
+func patternsFetchCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "fetch",
+		Short: "Fetch the patterns now even if they don't need a refresh",
+		Args:  cobra.NoArgs,
+		Run:   runPatternsFetch,
+	}
+}
+
+func patternsStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the pattern hash, rule count and sources",
+		Args:  cobra.NoArgs,
+		Run:   runPatternsStatus,
+	}
+}
+
+func patternsTestCommand() *cobra.Command {
+	patternsTestCommand := &cobra.Command{
+		Use:   "test [flags] [tests-file...]",
+		Short: "Check that rules match or don't match samples",
+		Run:   runPatternsTest,
+	}
+
+	flags := patternsTestCommand.Flags()
+	flags.String("rules-file", "", "test the rules in this gitleaks config instead of the loaded patterns")
+	flags.StringSliceP("rule", "R", nil, "the rules to test the samples from the flags against (default all)")
+	flags.StringArray("match", nil, "a sample string that should match")
+	flags.StringArray("no-match", nil, "a sample string that should not match")
+	flags.StringArray("match-file", nil, "a sample file that should match")
+	flags.StringArray("no-match-file", nil, "a sample file that should not match")
+	flags.Int("fail-exit-code", 1, "the exit code when a test fails")
+
+	return patternsTestCommand
+}
+
+func patternsCommand() *cobra.Command {
+	patternsCommand := &cobra.Command{
+		Use:   "patterns",
+		Short: "Manage scanner patterns",
+		Run:   runHelp,
+	}
+
+	patternsCommand.AddCommand(patternsExportCommand())
+	patternsCommand.AddCommand(patternsFetchCommand())
+	patternsCommand.AddCommand(patternsImportCommand())
+	patternsCommand.AddCommand(patternsListCommand())
+	patternsCommand.AddCommand(patternsShowCommand())
+	patternsCommand.AddCommand(patternsStatusCommand())
+	patternsCommand.AddCommand(patternsTestCommand())
+
+	return patternsCommand
+}
+
 func runVersion(cmd *cobra.Command, args []string) {
 	version.PrintVersion()
 }
@@ -294,6 +992,53 @@ func versionCommand() *cobra.Command {
 	}
 }
 
+// setLogOutputs opens the configured log outputs and switches the logger to
+// them. The current outputs are kept if any of them can't be opened.
+func setLogOutputs(logOutputs []config.LogOutput) error {
+	outputs := make([]logger.Output, 0, len(logOutputs))
+	closeAll := func() {
+		for _, output := range outputs {
+			_ = output.Close()
+		}
+	}
+
+	for _, logOutput := range logOutputs {
+		var output logger.Output
+		var err error
+
+		switch logOutput.Kind {
+		case "stderr":
+			output = logger.NewStderrOutput()
+		case "file":
+			if logOutput.Path == "" {
+				err = errors.New("file log output is missing a path")
+				break
+			}
+
+			output, err = logger.NewFileOutput(
+				logOutput.Path,
+				int64(logOutput.MaxSize)*1024*1024,
+				time.Duration(logOutput.MaxAge)*time.Hour,
+				int(logOutput.MaxBackups),
+			)
+		case "syslog":
+			output, err = logger.NewSyslogOutput(logOutput.Network, logOutput.Address, logOutput.Tag)
+		default:
+			err = fmt.Errorf("invalid log output kind: kind=%q", logOutput.Kind)
+		}
+
+		if err != nil {
+			closeAll()
+			return err
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	logger.SetOutputs(outputs...)
+	return nil
+}
+
 func configure(cmd *cobra.Command, args []string) error {
 	switch cmd.Use {
 	case "listen":
@@ -314,6 +1059,9 @@ func configure(cmd *cobra.Command, args []string) error {
 		if err == nil {
 			err = logger.SetLoggerLevel(cfg.Logger.Level)
 		}
+		if err == nil {
+			err = setLogOutputs(cfg.Logger.Outputs)
+		}
 		if err != nil {
 			return err
 		}
@@ -348,8 +1096,11 @@ func rootCommand() *cobra.Command {
 	flags.StringP("config", "c", "", "config file path")
 	flags.StringP("format", "f", "", "output format [json(default), human, csv, toml, yaml]")
 
+	rootCommand.AddCommand(baselineCommand())
+	rootCommand.AddCommand(ignoreCommand())
 	rootCommand.AddCommand(loginCommand())
 	rootCommand.AddCommand(logoutCommand())
+	rootCommand.AddCommand(patternsCommand())
 	rootCommand.AddCommand(scanCommand())
 	rootCommand.AddCommand(listenCommand())
 	rootCommand.AddCommand(versionCommand())
@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/leaktk/leaktk/pkg/fs"
+	"github.com/leaktk/leaktk/pkg/response"
 )
 
 func TestScanCommandToRequest(t *testing.T) {
@@ -64,4 +69,52 @@ func TestScanCommandToRequest(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, request)
 	assert.Equal(t, err.Error(), fmt.Sprintf("resource path does not exist: path=%q", dataPath+".invalid"))
+
+	// The baseline flag is passed through as an option
+	_ = cmd.Flags().Set("resource", "https://github.com/leaktk/fake-leaks.git")
+	_ = cmd.Flags().Set("kind", "GitRepo")
+	_ = cmd.Flags().Set("baseline", "/tmp/baseline.json")
+	request, err = scanCommandToRequest(cmd, args)
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/baseline.json", request.Options.Baseline)
+}
+
+func TestReadLine(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	reader := bufio.NewReaderSize(strings.NewReader("short\n"+long+"\nnext\n"+long), 16)
+
+	line, err := readLine(reader, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "short", string(line))
+
+	// The long line is skipped without keeping it
+	_, err = readLine(reader, 100)
+	assert.ErrorIs(t, err, errRequestTooLarge)
+
+	line, err = readLine(reader, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "next", string(line))
+
+	// Also when the long line is the last one
+	_, err = readLine(reader, 100)
+	assert.ErrorIs(t, err, errRequestTooLarge)
+
+	_, err = readLine(reader, 100)
+	assert.ErrorIs(t, err, io.EOF)
+
+	// No max size
+	line, err = readLine(bufio.NewReaderSize(strings.NewReader(long+"\n"), 16), 0)
+	assert.NoError(t, err)
+	assert.Len(t, line, len(long))
+}
+
+func TestRejectedResponse(t *testing.T) {
+	resp := rejectedResponse("1", errors.New("queue full"))
+
+	assert.Equal(t, "1", resp.RequestID)
+	assert.Equal(t, response.StatusRejected, resp.Status)
+	assert.Equal(t, []response.LeakTKError{
+		{Fatal: true, Code: response.RequestRejected, Message: `request rejected: error="queue full"`},
+	}, resp.Errors)
+	assert.Equal(t, resp.Errors[0].Message, resp.Logs[0].Message)
 }
@@ -27,10 +27,16 @@ type (
 	// the future as more components are added to the toolchain.
 	Config struct {
 		Logger    Logger    `toml:"logger"`
+		Metrics   Metrics   `toml:"metrics"`
 		Scanner   Scanner   `toml:"scanner"`
 		Formatter Formatter `toml:"formatter"`
 	}
 
+	// Metrics configures the metrics endpoint in listen mode
+	Metrics struct {
+		Address string `toml:"address"`
+	}
+
 	// Formatter provides a general output format config
 	Formatter struct {
 		Format string `toml:"format"`
@@ -38,29 +44,141 @@ type (
 
 	// Logger provides general logger config
 	Logger struct {
-		Level string `toml:"level"`
+		Level   string      `toml:"level"`
+		Outputs []LogOutput `toml:"outputs"`
+	}
+
+	// LogOutput is a destination for logs. Kind is "stderr", "file" or
+	// "syslog". Logs go to stderr when no outputs are configured.
+	LogOutput struct {
+		Address    string `toml:"address"`
+		Kind       string `toml:"kind"`
+		MaxAge     uint16 `toml:"max_age"`
+		MaxBackups uint16 `toml:"max_backups"`
+		MaxSize    uint32 `toml:"max_size"`
+		Network    string `toml:"network"`
+		Path       string `toml:"path"`
+		Tag        string `toml:"tag"`
 	}
 
 	// Scanner provides scanner specific config
 	Scanner struct {
-		AllowLocal          bool     `toml:"allow_local"`
-		CloneTimeout        uint16   `toml:"clone_timeout"`
-		CloneWorkers        uint16   `toml:"clone_workers"`
-		IncludeResponseLogs bool     `toml:"include_response_logs"`
-		MaxDecodeDepth      uint16   `toml:"max_decode_depth"`
-		MaxScanDepth        uint16   `toml:"max_scan_depth"`
-		Patterns            Patterns `toml:"patterns"`
-		ScanWorkers         uint16   `toml:"scan_workers"`
-		Workdir             string   `toml:"workdir"`
+		AllowLocal          bool       `toml:"allow_local"`
+		Backends            []Backend  `toml:"backends"`
+		CloneTimeout        uint16     `toml:"clone_timeout"`
+		CloneWorkers        uint16     `toml:"clone_workers"`
+		IncludeResponseLogs bool       `toml:"include_response_logs"`
+		MaxDecodeDepth      uint16     `toml:"max_decode_depth"`
+		MaxQueueDepth       uint32     `toml:"max_queue_depth"`
+		MaxRequestSize      uint32     `toml:"max_request_size"`
+		MaxResourceBytes    uint64     `toml:"max_resource_bytes"`
+		MaxScanDepth        uint16     `toml:"max_scan_depth"`
+		Patterns            Patterns   `toml:"patterns"`
+		Redact              uint       `toml:"redact"`
+		ResultCacheTTL      uint16     `toml:"result_cache_ttl"`
+		Retry               Retry      `toml:"retry"`
+		ScanWorkers         uint16     `toml:"scan_workers"`
+		Scheduling          Scheduling `toml:"scheduling"`
+		SecretHashSalt      string     `toml:"secret_hash_salt"`
+		StreamChunkSize     uint16     `toml:"stream_chunk_size"`
+		SuppressionsPath    string     `toml:"suppressions_path"`
+		Verifiers           []Verifier `toml:"verifiers"`
+		VerifyTimeout       uint16     `toml:"verify_timeout"`
+		Workdir             string     `toml:"workdir"`
+	}
+
+	// Retry controls how clones that fail for transient reasons (timeouts,
+	// dropped connections, 5xx responses, etc) are retried. Backoffs are in
+	// seconds.
+	Retry struct {
+		InitialBackoff float64 `toml:"initial_backoff"`
+		MaxAttempts    uint16  `toml:"max_attempts"`
+		MaxBackoff     float64 `toml:"max_backoff"`
+	}
+
+	// Scheduling controls the order queued requests are cloned and scanned
+	Scheduling struct {
+		PriorityAging     uint16                  `toml:"priority_aging"`
+		TenantConcurrency uint16                  `toml:"tenant_concurrency"`
+		Tenants           map[string]TenantPolicy `toml:"tenants"`
+	}
+
+	// TenantPolicy sets a tenant's share of the workers. Requests pick their
+	// tenant with the "tenant" field.
+	TenantPolicy struct {
+		Concurrency uint16 `toml:"concurrency"`
+		Weight      uint16 `toml:"weight"`
+	}
+
+	// Backend selects and configures a scanner backend. Backends run in the
+	// order they're listed.
+	Backend struct {
+		Disabled bool            `toml:"disabled"`
+		External ExternalBackend `toml:"external"`
+		Kind     string          `toml:"kind"`
+		Name     string          `toml:"name"`
+		Native   NativeBackend   `toml:"native"`
+	}
+
+	// ExternalBackend provides options for running a custom detector as a
+	// separate process (see docs/external-backends.md)
+	ExternalBackend struct {
+		Args    []string          `toml:"args"`
+		Env     map[string]string `toml:"env"`
+		Path    string            `toml:"path"`
+		Timeout uint16            `toml:"timeout"`
+	}
+
+	// NativeBackend provides options for the native regex/entropy backend
+	NativeBackend struct {
+		DisableEntropy   bool    `toml:"disable_entropy"`
+		EntropyMinLength uint16  `toml:"entropy_min_length"`
+		EntropyThreshold float64 `toml:"entropy_threshold"`
+	}
+
+	// Verifier describes an HTTP request used to check if a secret is live.
+	// Method, URL, Headers and Body are Go templates (see docs/config.md).
+	Verifier struct {
+		Body          string            `toml:"body"`
+		Headers       map[string]string `toml:"headers"`
+		InvalidBody   string            `toml:"invalid_body"`
+		InvalidStatus []int             `toml:"invalid_status"`
+		Method        string            `toml:"method"`
+		Name          string            `toml:"name"`
+		RateLimit     float64           `toml:"rate_limit"`
+		Rules         []string          `toml:"rules"`
+		Tags          []string          `toml:"tags"`
+		Timeout       uint16            `toml:"timeout"`
+		URL           string            `toml:"url"`
+		ValidBody     string            `toml:"valid_body"`
+		ValidStatus   []int             `toml:"valid_status"`
 	}
 
 	// Patterns provides configuration for managing pattern updates
 	Patterns struct {
-		Autofetch    bool          `toml:"autofetch"`
-		ExpiredAfter uint32        `toml:"expired_after"`
-		Gitleaks     Gitleaks      `toml:"gitleaks"`
-		RefreshAfter uint32        `toml:"refresh_after"`
-		Server       PatternServer `toml:"server"`
+		Autofetch     bool            `toml:"autofetch"`
+		ExpiredAfter  uint32          `toml:"expired_after"`
+		Gitleaks      Gitleaks        `toml:"gitleaks"`
+		RefreshAfter  uint32          `toml:"refresh_after"`
+		RuleCollision string          `toml:"rule_collision"`
+		Server        PatternServer   `toml:"server"`
+		Sources       []PatternSource `toml:"sources"`
+		TrustedKeys   []string        `toml:"trusted_keys"`
+	}
+
+	// PatternSource is an extra set of gitleaks patterns layered on top of the
+	// patterns from the pattern server. Sources are merged in the order
+	// they're listed.
+	PatternSource struct {
+		AuthToken        string `toml:"auth_token"`
+		ConfigPath       string `toml:"config_path"`
+		DisableAutofetch bool   `toml:"disable_autofetch"`
+		ExpiredAfter     uint32 `toml:"expired_after"`
+		Kind             string `toml:"kind"`
+		Name             string `toml:"name"`
+		Path             string `toml:"path"`
+		RefreshAfter     uint32 `toml:"refresh_after"`
+		URL              string `toml:"url"`
 	}
 
 	// Gitleaks holds version and config information for the Gitleaks scanner
@@ -101,6 +219,29 @@ func setMissingValues(cfg *Config) *Config {
 		cfg.Scanner.Patterns.Server.AuthToken = authToken
 	}
 
+	// Like the auth token, the salt is sensitive so allow it to be kept out of
+	// the config file
+	if salt := os.Getenv("LEAKTK_SCANNER_SECRET_HASH_SALT"); len(salt) != 0 {
+		cfg.Scanner.SecretHashSalt = salt
+	}
+
+	if cfg.Scanner.Redact > 100 {
+		logger.Warning("redact is above 100 percent, using 100: redact=%d", cfg.Scanner.Redact)
+		cfg.Scanner.Redact = 100
+	}
+
+	if cfg.Scanner.StreamChunkSize == 0 {
+		cfg.Scanner.StreamChunkSize = DefaultConfig().Scanner.StreamChunkSize
+	}
+
+	if cfg.Scanner.VerifyTimeout == 0 {
+		cfg.Scanner.VerifyTimeout = DefaultConfig().Scanner.VerifyTimeout
+	}
+
+	if len(cfg.Scanner.SuppressionsPath) == 0 {
+		cfg.Scanner.SuppressionsPath = filepath.Join(localConfigDir, "suppressions.json")
+	}
+
 	if len(cfg.Scanner.Patterns.Gitleaks.ConfigPath) == 0 {
 		cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(
 			cfg.Scanner.Workdir, "patterns", "gitleaks",
@@ -108,6 +249,20 @@ func setMissingValues(cfg *Config) *Config {
 		)
 	}
 
+	for i := range cfg.Scanner.Patterns.Sources {
+		source := &cfg.Scanner.Patterns.Sources[i]
+
+		if len(source.Name) == 0 {
+			source.Name = source.Path
+		}
+
+		if len(source.ConfigPath) == 0 && strings.ToLower(source.Kind) == "url" {
+			source.ConfigPath = filepath.Join(
+				cfg.Scanner.Workdir, "patterns", "sources", source.Name+".toml",
+			)
+		}
+	}
+
 	return cfg
 }
 
@@ -171,12 +326,18 @@ func DefaultConfig() *Config {
 			Level: "INFO",
 		},
 		Scanner: Scanner{
-			AllowLocal:          true,
+			AllowLocal: true,
+			Backends: []Backend{
+				{Kind: "gitleaks"},
+			},
 			CloneTimeout:        0,
 			CloneWorkers:        1,
 			IncludeResponseLogs: false,
 			MaxScanDepth:        0,
+			Redact:              0,
 			ScanWorkers:         1,
+			StreamChunkSize:     100,
+			VerifyTimeout:       60,
 			Workdir:             filepath.Join(xdg.CacheHome, "leaktk", "scanner"),
 			MaxDecodeDepth:      8,
 			Patterns: Patterns{
@@ -190,6 +351,11 @@ func DefaultConfig() *Config {
 					URL: "https://raw.githubusercontent.com/leaktk/patterns/main/target",
 				},
 			},
+			Retry: Retry{
+				InitialBackoff: 1,
+				MaxAttempts:    3,
+				MaxBackoff:     30,
+			},
 		},
 	}
 }
@@ -50,6 +50,10 @@ func TestPartialLoadConfigFromFile(t *testing.T) {
 			expected: uint16(0),
 			actual:   cfg.Scanner.MaxScanDepth,
 		},
+		{
+			expected: []Backend{{Kind: "gitleaks"}},
+			actual:   cfg.Scanner.Backends,
+		},
 	}
 
 	for _, test := range tests {
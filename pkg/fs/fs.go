@@ -29,6 +29,40 @@ func PathExists(path string) bool {
 	return info != nil && err == nil
 }
 
+// DirSize returns the total size of the files under path. A missing path has
+// a size of 0 and files removed during the walk are skipped.
+func DirSize(path string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(path, func(_ string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
+
 // CleanJoin checks to make sure that the prefix path remains after the join, this is to
 // control for path traversal
 func CleanJoin(prefix string, elem string) (string, error) {
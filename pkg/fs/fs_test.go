@@ -53,6 +53,26 @@ func TestPathExists(t *testing.T) {
 	})
 }
 
+func TestDirSize(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("MissingDir", func(t *testing.T) {
+		size, err := DirSize(filepath.Join(tmpDir, "missing"))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), size)
+	})
+
+	t.Run("NestedFiles", func(t *testing.T) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "a", "b"), 0700))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a", "one"), []byte("12345"), 0600))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a", "b", "two"), []byte("123"), 0600))
+
+		size, err := DirSize(tmpDir)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(8), size)
+	})
+}
+
 func TestCleanJoin(t *testing.T) {
 	t.Run("CleanJoin", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -0,0 +1,153 @@
+package logger
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Field is a typed key/value pair attached to a log entry. In the JSON format
+// fields are keys of the entry and in the HUMAN format they follow the
+// message as key=value pairs.
+type Field struct {
+	Key   string `toml:"key" yaml:"key"`
+	Value any    `toml:"value" yaml:"value"`
+}
+
+// String renders the field as key=value with strings quoted
+func (f Field) String() string {
+	switch value := f.Value.(type) {
+	case string:
+		return f.Key + "=" + strconv.Quote(value)
+	case nil:
+		return f.Key + "=null"
+	default:
+		return fmt.Sprintf("%s=%v", f.Key, value)
+	}
+}
+
+// String returns a string field
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int returns an integer field
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int64 returns a 64-bit integer field
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Float64 returns a floating point field
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Bool returns a boolean field
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration returns a field with the duration in seconds
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value.Seconds()}
+}
+
+// Err returns an "error" field with the error's message (null if err is nil)
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Value: nil}
+	}
+
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// Any returns a field with any value that can be marshaled to JSON
+func Any(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger logs entries with a set of fields attached to each of them
+type Logger struct {
+	fields []Field
+	// capture receives the entries at or above captureLevel even when the
+	// global level would leave them out
+	capture      func(Entry)
+	captureLevel LogLevel
+}
+
+// With returns a logger that attaches the fields to every entry
+func With(fields ...Field) *Logger {
+	return &Logger{fields: fields}
+}
+
+// With returns a logger with the fields added to the ones it already has
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{
+		fields:       append(slices.Clone(l.fields), fields...),
+		capture:      l.capture,
+		captureLevel: l.captureLevel,
+	}
+}
+
+// Capture returns a logger that also passes the entries at or above level to
+// fn, regardless of the global level. This is how a single request can
+// collect DEBUG logs without turning them on for everything.
+func (l *Logger) Capture(level LogLevel, fn func(Entry)) *Logger {
+	return &Logger{
+		fields:       l.fields,
+		capture:      fn,
+		captureLevel: level,
+	}
+}
+
+// Log emits an entry at the level with the logger's fields followed by the
+// fields passed in
+func (l *Logger) Log(level LogLevel, msg string, fields ...Field) *Entry {
+	captured := l.capture != nil && level >= l.captureLevel
+	if GetLoggerLevel() > level && !captured {
+		return nil
+	}
+
+	fields = append(slices.Clone(l.fields), fields...)
+	entry := emit(level, msg, fields)
+
+	if captured {
+		if entry != nil {
+			l.capture(*entry)
+		} else {
+			l.capture(*NewEntry(level, msg, fields...))
+		}
+	}
+
+	return entry
+}
+
+// Debug emits a DEBUG level log
+func (l *Logger) Debug(msg string, fields ...Field) *Entry {
+	return l.Log(DEBUG, msg, fields...)
+}
+
+// Info emits an INFO level log
+func (l *Logger) Info(msg string, fields ...Field) *Entry {
+	return l.Log(INFO, msg, fields...)
+}
+
+// Warning emits a WARNING level log
+func (l *Logger) Warning(msg string, fields ...Field) *Entry {
+	return l.Log(WARNING, msg, fields...)
+}
+
+// Error emits an ERROR level log
+func (l *Logger) Error(msg string, fields ...Field) *Entry {
+	return l.Log(ERROR, msg, fields...)
+}
+
+// Critical emits a CRITICAL level log
+func (l *Logger) Critical(msg string, fields ...Field) *Entry {
+	return l.Log(CRITICAL, msg, fields...)
+}
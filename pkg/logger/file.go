@@ -0,0 +1,186 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the suffix added to rotated log files. It sorts in
+// the order the files were rotated.
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+// fileOutput writes entries to a file and rotates it when it gets too big
+// or too old
+type fileOutput struct {
+	lock       sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	opened     time.Time
+}
+
+// NewFileOutput returns an output that appends to the file at path. The file
+// is rotated once it would grow past maxSize bytes or has been open longer
+// than maxAge (0 disables either) and only the newest maxBackups rotated
+// files are kept (0 keeps them all).
+func NewFileOutput(path string, maxSize int64, maxAge time.Duration, maxBackups int) (Output, error) {
+	output := &fileOutput{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("could not create log directory: error=%q", err)
+	}
+
+	if err := output.open(path); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// open opens the file at path for appending and writes to it from then on.
+// The lock must be held.
+func (o *fileOutput) open(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("could not open log file: path=%q error=%q", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not stat log file: path=%q error=%q", path, err)
+	}
+
+	o.file = file
+	o.size = info.Size()
+	o.opened = time.Now()
+
+	return nil
+}
+
+func (o *fileOutput) Write(_ *Entry, line string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.file == nil {
+		return fmt.Errorf("log file is closed: path=%q", o.path)
+	}
+
+	var rotateErr error
+	data := []byte(line + "\n")
+	if o.shouldRotate(int64(len(data))) {
+		// A failed rotation keeps a file open when it can so the entry isn't
+		// lost, and the rotation is tried again on the next write
+		if rotateErr = o.rotate(); o.file == nil {
+			return rotateErr
+		}
+	}
+
+	n, err := o.file.Write(data)
+	o.size += int64(n)
+
+	return errors.Join(rotateErr, err)
+}
+
+// shouldRotate returns true if the file should be rotated before writing
+// size more bytes. Empty files are never rotated so an entry bigger than
+// maxSize still gets written. The lock must be held.
+func (o *fileOutput) shouldRotate(size int64) bool {
+	if o.size == 0 {
+		return false
+	}
+
+	if o.maxSize > 0 && o.size+size > o.maxSize {
+		return true
+	}
+
+	return o.maxAge > 0 && time.Since(o.opened) > o.maxAge
+}
+
+// rotate moves the current file aside, opens a new one and removes the
+// rotated files that shouldn't be kept. If the new file can't be opened, the
+// original one is reopened so there's still somewhere to write. The file is
+// closed before it's moved since open files can't be renamed everywhere. The
+// lock must be held.
+func (o *fileOutput) rotate() error {
+	closeErr := o.file.Close()
+	o.file = nil
+
+	if closeErr != nil {
+		closeErr = fmt.Errorf("could not close log file: path=%q error=%q", o.path, closeErr)
+		return errors.Join(closeErr, o.open(o.path))
+	}
+
+	rotatedPath := o.path + "." + time.Now().UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(o.path, rotatedPath); err != nil {
+		err = fmt.Errorf("could not rotate log file: path=%q error=%q", o.path, err)
+		return errors.Join(err, o.open(o.path))
+	}
+
+	if err := o.open(o.path); err != nil {
+		return errors.Join(err, o.open(rotatedPath))
+	}
+
+	return o.prune()
+}
+
+// prune removes the oldest rotated files beyond maxBackups
+func (o *fileOutput) prune() error {
+	if o.maxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(o.path + ".*")
+	if err != nil {
+		return fmt.Errorf("could not list rotated log files: error=%q", err)
+	}
+
+	rotated := make([]string, 0, len(matches))
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, o.path+".")
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			rotated = append(rotated, match)
+		}
+	}
+
+	if len(rotated) <= o.maxBackups {
+		return nil
+	}
+
+	sort.Strings(rotated)
+	for _, path := range rotated[:len(rotated)-o.maxBackups] {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("could not remove rotated log file: path=%q error=%q", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (o *fileOutput) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.file == nil {
+		return nil
+	}
+
+	err := o.file.Close()
+	o.file = nil
+
+	return err
+}
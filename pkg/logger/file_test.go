@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "leaktk.log")
+	entry := NewEntry(INFO, "hi")
+
+	t.Run("RotatesBySize", func(t *testing.T) {
+		output, err := NewFileOutput(path, 10, 0, 2)
+		assert.NoError(t, err)
+		defer output.Close()
+
+		for _, line := range []string{"first", "second", "third", "fourth"} {
+			assert.NoError(t, output.Write(entry, line))
+		}
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "fourth\n", string(data))
+
+		// Only the newest two rotated files are kept
+		rotated, err := filepath.Glob(path + ".*")
+		assert.NoError(t, err)
+		assert.Len(t, rotated, 2)
+
+		data, err = os.ReadFile(rotated[1])
+		assert.NoError(t, err)
+		assert.Equal(t, "third\n", string(data))
+	})
+
+	t.Run("RotatesByAge", func(t *testing.T) {
+		output, err := NewFileOutput(path, 0, time.Nanosecond, 0)
+		assert.NoError(t, err)
+		defer output.Close()
+
+		time.Sleep(time.Millisecond)
+		assert.NoError(t, output.Write(entry, "newer"))
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "newer\n", string(data))
+	})
+
+	t.Run("KeepsWritingWhenRotateFails", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leaktk.log")
+		output, err := NewFileOutput(path, 10, 0, 0)
+		assert.NoError(t, err)
+		defer output.Close()
+
+		assert.NoError(t, output.Write(entry, "first"))
+
+		// The file can't be moved aside if it's gone, so it's reopened
+		assert.NoError(t, os.Remove(path))
+		assert.ErrorContains(t, output.Write(entry, "second"), "could not rotate log file")
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "second\n", string(data))
+		assert.NoError(t, output.Write(entry, "third"))
+	})
+}
+
+func TestSetOutputs(t *testing.T) {
+	defer SetOutputs()
+
+	path := filepath.Join(t.TempDir(), "leaktk.log")
+	output, err := NewFileOutput(path, 0, 0, 0)
+	assert.NoError(t, err)
+
+	SetOutputs(output)
+	Info("written to the file: n=%d", 1)
+	SetOutputs()
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(data), "written to the file: n=1\n"))
+}
@@ -1,9 +1,13 @@
 package logger
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -12,6 +16,7 @@ import (
 )
 
 func init() {
+	currentLogLevel.Store(int64(INFO))
 	// Disable logging by default to make sure that gitleaks can't produce logs
 	// without being specifically configured
 	glog.Logger.Level(zerolog.Disabled)
@@ -101,9 +106,11 @@ const (
 	CloneDetail
 	// ScanDetail are log entries that are informational
 	ScanDetail
+	// RequestRejected means the scanner was at one of its limits
+	RequestRejected
 )
 
-var logCodeNames = [...]string{"NoCode", "CloneError", "ScanError", "ResourceCleanupError", "CommandError", "CloneDetail", "ScanDetail"}
+var logCodeNames = [...]string{"NoCode", "CloneError", "ScanError", "ResourceCleanupError", "LocalScanDisabled", "CommandError", "CloneDetail", "ScanDetail", "RequestRejected"}
 
 func (code LogCode) String() string {
 	return logCodeNames[code]
@@ -129,7 +136,9 @@ func (l LogLevel) String() string {
 	}
 }
 
-var currentLogLevel = INFO
+// currentLogLevel is atomic since the level can change on a reload while
+// other goroutines are logging
+var currentLogLevel atomic.Int64
 var currentLogFormat = HUMAN
 
 // Entry defines a log entry
@@ -138,6 +147,49 @@ type Entry struct {
 	Severity string `json:"severity"`
 	Code     string `json:"code,omitempty"`
 	Message  string `json:"message"`
+	// Fields are rendered as keys of the entry in JSON (see MarshalJSON)
+	Fields []Field `json:"-" toml:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// reservedKeys are the entry keys that fields can't replace in JSON
+var reservedKeys = map[string]bool{"time": true, "severity": true, "code": true, "message": true}
+
+// MarshalJSON renders the entry with its fields as keys next to the message.
+// Fields named after one of the entry's own keys get a "field_" prefix.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type plainEntry Entry
+	out, err := json.Marshal(plainEntry(e))
+	if err != nil || len(e.Fields) == 0 {
+		return out, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(out[:len(out)-1])
+
+	for _, field := range e.Fields {
+		key := field.Key
+		if reservedKeys[key] {
+			key = "field_" + key
+		}
+
+		rawKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		rawValue, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal log field: key=%q error=%q", field.Key, err)
+		}
+
+		buf.WriteByte(',')
+		buf.Write(rawKey)
+		buf.WriteByte(':')
+		buf.Write(rawValue)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
 }
 
 // String renders a log entry structure to the JSON format
@@ -148,7 +200,13 @@ func (e Entry) String() string {
 
 	switch currentLogFormat {
 	case HUMAN:
-		return fmt.Sprintf("[%s] %s", e.Severity, e.Message)
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "[%s] %s", e.Severity, e.Message)
+		for _, field := range e.Fields {
+			buf.WriteString(" " + field.String())
+		}
+
+		return buf.String()
 
 	case JSON:
 		out, err := json.Marshal(e)
@@ -186,111 +244,124 @@ func SetLoggerFormat(logFormat LogFormat) error {
 	return nil
 }
 
-// SetLoggerLevel takes the string version of the name and sets the current level
-func SetLoggerLevel(levelName string) error {
+// ParseLogLevel returns the level for a level name
+func ParseLogLevel(levelName string) (LogLevel, error) {
 	switch levelName {
 	case "DEBUG":
-		currentLogLevel = DEBUG
-		glog.Logger.Level(zerolog.DebugLevel)
+		return DEBUG, nil
 	case "INFO":
-		currentLogLevel = INFO
-		glog.Logger.Level(zerolog.InfoLevel)
+		return INFO, nil
 	case "WARNING":
-		currentLogLevel = WARNING
-		glog.Logger.Level(zerolog.WarnLevel)
+		return WARNING, nil
 	case "ERROR":
-		currentLogLevel = ERROR
-		glog.Logger.Level(zerolog.ErrorLevel)
+		return ERROR, nil
 	case "CRITICAL":
-		currentLogLevel = CRITICAL
-		glog.Logger.Level(zerolog.FatalLevel)
+		return CRITICAL, nil
 	default:
-		return fmt.Errorf("invalid log level: level=%q", levelName)
+		return NOTSET, fmt.Errorf("invalid log level: level=%q", levelName)
+	}
+}
+
+// SetLoggerLevel takes the string version of the name and sets the current level
+func SetLoggerLevel(levelName string) error {
+	level, err := ParseLogLevel(levelName)
+	if err != nil {
+		return err
 	}
 
+	currentLogLevel.Store(int64(level))
+	glog.Logger.Level(gitleaksLevels[level])
+
 	return nil
 }
 
+// gitleaksLevels maps the levels to the ones used by the gitleaks logger
+var gitleaksLevels = map[LogLevel]zerolog.Level{
+	DEBUG:    zerolog.DebugLevel,
+	INFO:     zerolog.InfoLevel,
+	WARNING:  zerolog.WarnLevel,
+	ERROR:    zerolog.ErrorLevel,
+	CRITICAL: zerolog.FatalLevel,
+}
+
 // GetLoggerLevel returns the current logger level
 func GetLoggerLevel() LogLevel {
-	return currentLogLevel
+	return LogLevel(currentLogLevel.Load())
+}
+
+// severityNames maps the levels that entries can be logged at to their
+// severity
+var severityNames = map[LogLevel]string{
+	DEBUG:    "DEBUG",
+	INFO:     "INFO",
+	WARNING:  "WARNING",
+	ERROR:    "ERROR",
+	CRITICAL: "CRITICAL",
+}
+
+// NewEntry returns an entry without logging it
+func NewEntry(level LogLevel, msg string, fields ...Field) *Entry {
+	return &Entry{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		Severity: severityNames[level],
+		Message:  msg,
+		Fields:   fields,
+	}
+}
+
+// emit logs the entry if the level is enabled and returns it
+func emit(level LogLevel, msg string, fields []Field) *Entry {
+	if GetLoggerLevel() > level {
+		return nil
+	}
+	entry := NewEntry(level, msg, fields...)
+	writeEntry(entry)
+	return entry
 }
 
 // Debug emits an DEBUG level log
 func Debug(msg string, a ...any) *Entry {
-	if currentLogLevel > DEBUG {
+	if GetLoggerLevel() > DEBUG {
 		return nil
 	}
-	entry := Entry{
-		Time:     time.Now().UTC().Format(time.RFC3339),
-		Severity: "DEBUG",
-		Message:  fmt.Sprintf(msg, a...),
-	}
-	log.Println(entry)
-	return &entry
+	return emit(DEBUG, fmt.Sprintf(msg, a...), nil)
 }
 
 // Info emits an INFO level log
 func Info(msg string, a ...any) *Entry {
-	if currentLogLevel > INFO {
+	if GetLoggerLevel() > INFO {
 		return nil
 	}
-	entry := Entry{
-		Time:     time.Now().UTC().Format(time.RFC3339),
-		Severity: "INFO",
-		Message:  fmt.Sprintf(msg, a...),
-	}
-	log.Println(entry)
-	return &entry
+	return emit(INFO, fmt.Sprintf(msg, a...), nil)
 }
 
 // Warning emits an WARNING level log
 func Warning(msg string, a ...any) *Entry {
-	if currentLogLevel > WARNING {
+	if GetLoggerLevel() > WARNING {
 		return nil
 	}
-	entry := Entry{
-		Time:     time.Now().UTC().Format(time.RFC3339),
-		Severity: "WARNING",
-		Message:  fmt.Sprintf(msg, a...),
-	}
-	log.Println(entry)
-	return &entry
+	return emit(WARNING, fmt.Sprintf(msg, a...), nil)
 }
 
 // Error emits an ERROR level log
 func Error(msg string, a ...any) *Entry {
-	if currentLogLevel > ERROR {
+	if GetLoggerLevel() > ERROR {
 		return nil
 	}
-	entry := Entry{
-		Time:     time.Now().UTC().Format(time.RFC3339),
-		Severity: "ERROR",
-		Message:  fmt.Errorf(msg, a...).Error(),
-	}
-	log.Println(entry)
-	return &entry
+	return emit(ERROR, fmt.Errorf(msg, a...).Error(), nil)
 }
 
 // Critical emits an CRITICAL level log
 func Critical(msg string, a ...any) *Entry {
-	if currentLogLevel > CRITICAL {
+	if GetLoggerLevel() > CRITICAL {
 		return nil
 	}
-	entry := Entry{
-		Time:     time.Now().UTC().Format(time.RFC3339),
-		Severity: "CRITICAL",
-		Message:  fmt.Errorf(msg, a...).Error(),
-	}
-	log.Println(entry)
-	return &entry
+	return emit(CRITICAL, fmt.Errorf(msg, a...).Error(), nil)
 }
 
 // Fatal emits an CRITICAL level log and stops the program
 func Fatal(msg string, a ...any) {
-	log.Fatal(Entry{
-		Time:     time.Now().UTC().Format(time.RFC3339),
-		Severity: "CRITICAL",
-		Message:  fmt.Errorf(msg, a...).Error(),
-	})
+	writeEntry(NewEntry(CRITICAL, fmt.Errorf(msg, a...).Error()))
+	closeOutputs()
+	os.Exit(1)
 }
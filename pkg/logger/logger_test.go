@@ -16,3 +16,60 @@ func TestGetAndSetLoggerLevel(t *testing.T) {
 	assert.Nil(t, SetLoggerLevel(INFO.String()))
 	assert.Equal(t, GetLoggerLevel().String(), INFO.String())
 }
+
+func TestLogCodeString(t *testing.T) {
+	assert.Equal(t, "LocalScanDisabled", LogCode(LocalScanDisabled).String())
+	assert.Equal(t, "ScanDetail", LogCode(ScanDetail).String())
+}
+
+func TestStructuredLogging(t *testing.T) {
+	defer func() { _ = SetLoggerFormat(HUMAN) }()
+
+	entry := With(String("request_id", "1")).With(Int("files", 3)).Info("scan finished", Bool("partial", false), Err(nil))
+	assert.NotNil(t, entry)
+	assert.Equal(t, "INFO", entry.Severity)
+	assert.Equal(t, "scan finished", entry.Message)
+
+	t.Run("HUMAN", func(t *testing.T) {
+		assert.NoError(t, SetLoggerFormat(HUMAN))
+		assert.Equal(t, `[INFO] scan finished request_id="1" files=3 partial=false error=null`, entry.String())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		assert.NoError(t, SetLoggerFormat(JSON))
+		assert.JSONEq(t, `{"time":"`+entry.Time+`","severity":"INFO","message":"scan finished","request_id":"1","files":3,"partial":false,"error":null}`, entry.String())
+	})
+
+	t.Run("ReservedKeys", func(t *testing.T) {
+		out, err := Entry{Severity: "INFO", Message: "hi", Fields: []Field{String("message", "other")}}.MarshalJSON()
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"time":"","severity":"INFO","message":"hi","field_message":"other"}`, string(out))
+	})
+
+	t.Run("DisabledLevel", func(t *testing.T) {
+		assert.Nil(t, With(String("request_id", "1")).Debug("hidden"))
+	})
+}
+
+func TestCapture(t *testing.T) {
+	var captured []Entry
+	l := With(String("request_id", "1")).Capture(DEBUG, func(entry Entry) {
+		captured = append(captured, entry)
+	})
+
+	// The global level is INFO so the DEBUG entry is captured but not emitted
+	assert.Nil(t, l.Debug("cloning"))
+	assert.NotNil(t, l.With(Int("files", 3)).Info("scan finished"))
+	assert.Len(t, captured, 2)
+	assert.Equal(t, "DEBUG", captured[0].Severity)
+	assert.Equal(t, []Field{String("request_id", "1"), Int("files", 3)}, captured[1].Fields)
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("DEBUG")
+	assert.NoError(t, err)
+	assert.Equal(t, DEBUG, level)
+
+	_, err = ParseLogLevel("LOUD")
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// Output is somewhere log entries are written
+type Output interface {
+	// Write writes the rendered entry. The entry is passed along for outputs
+	// that need more than the text (e.g. the severity for syslog).
+	Write(entry *Entry, line string) error
+	// Close releases anything the output holds open
+	Close() error
+}
+
+// stderrOutput writes the entries to stderr through the standard logger
+type stderrOutput struct{}
+
+// NewStderrOutput returns an output that writes to stderr
+func NewStderrOutput() Output {
+	return stderrOutput{}
+}
+
+func (stderrOutput) Write(_ *Entry, line string) error {
+	log.Println(line)
+	return nil
+}
+
+func (stderrOutput) Close() error {
+	return nil
+}
+
+var outputsLock sync.RWMutex
+var outputs = []Output{stderrOutput{}}
+
+// SetOutputs replaces where the logs are written and closes the outputs that
+// were in use. With no outputs the logs go to stderr.
+func SetOutputs(newOutputs ...Output) {
+	if len(newOutputs) == 0 {
+		newOutputs = []Output{stderrOutput{}}
+	}
+
+	outputsLock.Lock()
+	oldOutputs := outputs
+	outputs = newOutputs
+	outputsLock.Unlock()
+
+	for _, output := range oldOutputs {
+		if err := output.Close(); err != nil {
+			Error("could not close log output: error=%q", err)
+		}
+	}
+}
+
+// writeEntry writes the entry to every output. Failures go to stderr since
+// there may be nowhere else to report them.
+func writeEntry(entry *Entry) {
+	line := entry.String()
+
+	outputsLock.RLock()
+	defer outputsLock.RUnlock()
+
+	for _, output := range outputs {
+		if err := output.Write(entry, line); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write log entry: error=%q\n", err)
+		}
+	}
+}
+
+// closeOutputs flushes and closes the outputs before the program exits
+func closeOutputs() {
+	outputsLock.Lock()
+	defer outputsLock.Unlock()
+
+	for _, output := range outputs {
+		_ = output.Close()
+	}
+}
@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogFacility is the "user" facility
+const syslogFacility = 1
+
+// syslogSeverities maps log levels to syslog severities
+var syslogSeverities = map[string]int{
+	"CRITICAL": 2,
+	"ERROR":    3,
+	"WARNING":  4,
+	"INFO":     6,
+	"DEBUG":    7,
+}
+
+// syslogOutput sends entries to a syslog daemon in the RFC 3164 format. It
+// talks to the socket directly since log/syslog isn't available on every
+// platform leaktk is built for.
+type syslogOutput struct {
+	lock    sync.Mutex
+	network string
+	address string
+	tag     string
+	conn    net.Conn
+}
+
+// NewSyslogOutput returns an output that sends entries to the syslog daemon
+// at address. The network is any supported by net.Dial and defaults to
+// unixgram at /dev/log. The tag defaults to "leaktk".
+func NewSyslogOutput(network, address, tag string) (Output, error) {
+	if network == "" {
+		network = "unixgram"
+	}
+
+	if address == "" {
+		address = "/dev/log"
+	}
+
+	if tag == "" {
+		tag = "leaktk"
+	}
+
+	output := &syslogOutput{
+		network: network,
+		address: address,
+		tag:     tag,
+	}
+
+	if err := output.connect(); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// connect dials the daemon. The lock must be held.
+func (o *syslogOutput) connect() error {
+	conn, err := net.Dial(o.network, o.address)
+	if err != nil {
+		return fmt.Errorf("could not connect to syslog: network=%q address=%q error=%q", o.network, o.address, err)
+	}
+
+	o.conn = conn
+	return nil
+}
+
+// format renders the line as a syslog message
+func (o *syslogOutput) format(entry *Entry, line string) string {
+	severity, ok := syslogSeverities[entry.Severity]
+	if !ok {
+		severity = syslogSeverities["INFO"]
+	}
+
+	msg := fmt.Sprintf(
+		"<%d>%s %s[%d]: %s",
+		syslogFacility*8+severity,
+		time.Now().Format(time.Stamp),
+		o.tag,
+		os.Getpid(),
+		strings.TrimRight(line, "\n"),
+	)
+
+	// Stream sockets need a delimiter between messages
+	if o.network == "tcp" || o.network == "tcp4" || o.network == "tcp6" || o.network == "unix" {
+		msg += "\n"
+	}
+
+	return msg
+}
+
+func (o *syslogOutput) Write(entry *Entry, line string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	msg := o.format(entry, line)
+	if o.conn != nil {
+		if _, err := o.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+
+		_ = o.conn.Close()
+		o.conn = nil
+	}
+
+	// The daemon may have restarted so try again on a new connection
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	_, err := o.conn.Write([]byte(msg))
+	return err
+}
+
+func (o *syslogOutput) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.conn == nil {
+		return nil
+	}
+
+	err := o.conn.Close()
+	o.conn = nil
+
+	return err
+}
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogOutput(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", address)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	output, err := NewSyslogOutput("unixgram", address, "")
+	assert.NoError(t, err)
+	defer output.Close()
+
+	assert.NoError(t, output.Write(NewEntry(ERROR, "oops"), "[ERROR] oops"))
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+
+	// user facility (1) * 8 + error severity (3) = 11
+	pattern := regexp.MustCompile(`^<11>\w{3} [ \d]\d \d{2}:\d{2}:\d{2} leaktk\[` + strconv.Itoa(os.Getpid()) + `\]: \[ERROR\] oops$`)
+	assert.Regexp(t, pattern, string(buf[:n]))
+}
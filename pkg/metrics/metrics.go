@@ -0,0 +1,409 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shutdownTimeout is how long the metrics server waits for in flight scrapes
+// when it's shut down
+const shutdownTimeout = 5 * time.Second
+
+// DefaultDurationBuckets are the histogram buckets (in seconds) used for
+// clone and scan durations
+var DefaultDurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800}
+
+// metric is anything that can be written in the Prometheus text format
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry holds a set of metrics and renders them in the Prometheus text
+// exposition format. It implements http.Handler so it can be served as is.
+type Registry struct {
+	lock      sync.Mutex
+	metrics   []metric
+	onCollect []func()
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// OnCollect adds a function that's called before the metrics are written.
+// It's for metrics that are cheaper to read when scraped (e.g. queue depths)
+// than to keep up to date.
+func (r *Registry) OnCollect(fn func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onCollect = append(r.onCollect, fn)
+}
+
+// NewCounter adds a counter with the label names
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	counter := &Counter{family: newFamily(name, help, "counter", labels)}
+	r.add(counter)
+
+	return counter
+}
+
+// NewGauge adds a gauge with the label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	gauge := &Gauge{family: newFamily(name, help, "gauge", labels)}
+	r.add(gauge)
+
+	return gauge
+}
+
+// NewHistogram adds a histogram with the upper bounds of its buckets in
+// increasing order and the label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	histogram := &Histogram{
+		family:  newFamily(name, help, "histogram", labels),
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.add(histogram)
+
+	return histogram
+}
+
+func (r *Registry) add(m metric) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every metric in the order they were added
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.lock.Lock()
+	onCollect := append([]func(){}, r.onCollect...)
+	metrics := append([]metric{}, r.metrics...)
+	r.lock.Unlock()
+
+	for _, fn := range onCollect {
+		fn()
+	}
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		m.write(&buf)
+	}
+
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP responds with the metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// ListenAndServe serves the metrics at /metrics on the address until the
+// server fails or the context is done. It returns nil if the server was shut
+// down because of the context.
+func (r *Registry) ListenAndServe(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stopped := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	})
+	defer stopped()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// family is the shared part of every metric type
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{name: name, help: help, kind: kind, labels: labels}
+}
+
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+}
+
+// key identifies the series for the label values. Each value is quoted so
+// that no two sets of values have the same key. It panics if the number of
+// values doesn't match the labels since that's a programming error.
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values but got %d", f.name, len(f.labels), len(labelValues)))
+	}
+
+	return fmt.Sprintf("%q", labelValues)
+}
+
+// labelPairs renders the labels for a series plus any extra pairs
+func (f *family) labelPairs(labelValues []string, extra ...string) string {
+	pairs := make([]string, 0, len(f.labels)+len(extra)/2)
+	for i, value := range labelValues {
+		pairs = append(pairs, f.labels[i]+"="+quote(value))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quote(extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// quote escapes a label value
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+
+	return `"` + value + `"`
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// values is a set of series with a single value each
+type values struct {
+	lock   sync.Mutex
+	series map[string]*valueSeries
+}
+
+type valueSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// get returns the series for the label values, adding it if it's new. The
+// caller must hold the lock.
+func (v *values) get(f *family, labelValues []string) *valueSeries {
+	key := f.key(labelValues)
+
+	if v.series == nil {
+		v.series = make(map[string]*valueSeries)
+	}
+
+	series, ok := v.series[key]
+	if !ok {
+		series = &valueSeries{labelValues: slices.Clone(labelValues)}
+		v.series[key] = series
+	}
+
+	return series
+}
+
+func (v *values) add(f *family, labelValues []string, delta float64) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.get(f, labelValues).value += delta
+}
+
+func (v *values) set(f *family, labelValues []string, value float64) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.get(f, labelValues).value = value
+}
+
+func (v *values) value(f *family, labelValues []string) float64 {
+	key := f.key(labelValues)
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if series, ok := v.series[key]; ok {
+		return series.value
+	}
+
+	return 0
+}
+
+func (v *values) write(w io.Writer, f *family) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	f.writeHeader(w)
+	for _, series := range sortedSeries(v.series, func(s *valueSeries) []string { return s.labelValues }) {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelPairs(series.labelValues), formatFloat(series.value))
+	}
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	family
+	values values
+}
+
+// Inc adds one to the series for the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a positive amount to the series for the label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+
+	c.values.add(&c.family, labelValues, delta)
+}
+
+// Value returns the current value of the series for the label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.values.value(&c.family, labelValues)
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.values.write(w, &c.family)
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	family
+	values values
+}
+
+// Set sets the series for the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.values.set(&g.family, labelValues, value)
+}
+
+// Add adds to the series for the label values (use a negative delta to
+// subtract)
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.values.add(&g.family, labelValues, delta)
+}
+
+// Value returns the current value of the series for the label values
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.values.value(&g.family, labelValues)
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.values.write(w, &g.family)
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	family
+	buckets []float64
+	lock    sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Observe records a value in the series for the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{
+			labelValues: slices.Clone(labelValues),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = series
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+
+	series.count++
+	series.sum += value
+}
+
+// Count returns how many values were observed for the label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if series, ok := h.series[key]; ok {
+		return series.count
+	}
+
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.writeHeader(w)
+	for _, series := range sortedSeries(h.series, func(s *histogramSeries) []string { return s.labelValues }) {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(series.labelValues, "le", formatFloat(bound)), series.counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(series.labelValues, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(series.labelValues), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(series.labelValues), series.count)
+	}
+}
+
+// sortedSeries returns the series ordered by their label values
+func sortedSeries[S any](m map[string]S, labelValues func(S) []string) []S {
+	series := make([]S, 0, len(m))
+	for _, s := range m {
+		series = append(series, s)
+	}
+
+	slices.SortFunc(series, func(a, b S) int {
+		return slices.Compare(labelValues(a), labelValues(b))
+	})
+
+	return series
+}
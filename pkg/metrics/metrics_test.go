@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("test_requests_total", "Requests seen", "outcome")
+	depth := registry.NewGauge("test_queue_depth", "Messages waiting", "queue")
+	durations := registry.NewHistogram("test_duration_seconds", "How long it took", []float64{1, 5}, "kind")
+
+	requests.Inc("queued")
+	requests.Add(2, "queued")
+	requests.Add(-1, "queued")
+	requests.Inc(`say "hi"`)
+	durations.Observe(0.5, "Text")
+	durations.Observe(3, "Text")
+	registry.OnCollect(func() {
+		depth.Set(7, "clone")
+	})
+
+	assert.Equal(t, float64(3), requests.Value("queued"))
+	assert.Equal(t, uint64(2), durations.Count("Text"))
+
+	var buf bytes.Buffer
+	_, err := registry.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP test_requests_total Requests seen
+# TYPE test_requests_total counter
+test_requests_total{outcome="queued"} 3
+test_requests_total{outcome="say \"hi\""} 1
+# HELP test_queue_depth Messages waiting
+# TYPE test_queue_depth gauge
+test_queue_depth{queue="clone"} 7
+# HELP test_duration_seconds How long it took
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{kind="Text",le="1"} 1
+test_duration_seconds_bucket{kind="Text",le="5"} 2
+test_duration_seconds_bucket{kind="Text",le="+Inf"} 2
+test_duration_seconds_sum{kind="Text"} 3.5
+test_duration_seconds_count{kind="Text"} 2
+`, buf.String())
+
+	t.Run("ServeHTTP", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		body, err := io.ReadAll(recorder.Result().Body)
+		assert.NoError(t, err)
+		assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+		assert.Contains(t, string(body), `test_queue_depth{queue="clone"} 7`)
+	})
+
+	t.Run("LabelValues", func(t *testing.T) {
+		pairs := registry.NewCounter("test_pairs_total", "Label values that used to share a key", "a", "b")
+		pairs.Inc("x\xffy", "z")
+		pairs.Inc("x", "y\xffz")
+		pairs.Inc("x", "y\xffz")
+
+		assert.Equal(t, float64(1), pairs.Value("x\xffy", "z"))
+		assert.Equal(t, float64(2), pairs.Value("x", "y\xffz"))
+		assert.Equal(t, float64(0), pairs.Value("x", "y"))
+	})
+
+	t.Run("WrongLabelCount", func(t *testing.T) {
+		assert.Panics(t, func() { requests.Inc() })
+	})
+}
+
+func TestListenAndServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- NewRegistry().ListenAndServe(ctx, "127.0.0.1:0")
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("server didn't stop when the context was done")
+	}
+}
@@ -1,14 +1,33 @@
 package queue
 
+import (
+	"math"
+	"time"
+)
+
+// maxScaledPriority bounds a priority scaled by the aging interval so that it
+// and the queued time can be combined without overflowing
+const maxScaledPriority = math.MaxInt64 / 2
+
 // Message encapsulates a value with its priority
 type Message[T any] struct {
 	Priority int
 	Value    T
+	// Tenant groups messages for fair scheduling (empty is its own tenant)
+	Tenant string
+	// sequence is set by the queue so messages with the same priority come
+	// out in the order they were sent
+	sequence uint64
+	// queued is when the message was sent to the queue
+	queued time.Time
 }
 
 // MessageHeap implements the container/heap interface to hold messages
 type MessageHeap[T any] struct {
 	data []*Message[T]
+	// aging raises the priority of waiting messages by one each interval
+	// (0 disables aging)
+	aging time.Duration
 }
 
 // NewMessageHeap returns an initialized MessageHeap of the specified size
@@ -25,7 +44,40 @@ func (h *MessageHeap[T]) Len() int {
 
 // Less returns which item in the heap is smaller than the other
 func (h *MessageHeap[T]) Less(i, j int) bool {
-	return h.data[i].Priority > h.data[j].Priority
+	return h.before(h.data[i], h.data[j])
+}
+
+// before reports whether a should come out of the heap before b
+func (h *MessageHeap[T]) before(a, b *Message[T]) bool {
+	if h.aging > 0 {
+		// Every waiting message ages at the same rate so comparing the
+		// priorities at the time they were queued keeps the heap valid
+		// without updating it as time passes
+		agedA, agedB := h.agedPriority(a), h.agedPriority(b)
+		if agedA != agedB {
+			return agedA > agedB
+		}
+	} else if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+
+	return a.sequence < b.sequence
+}
+
+// agedPriority is the priority scaled to nanoseconds minus when the message
+// was queued, so a message queued one aging interval earlier ranks the same
+// as one with a priority one higher. Priorities too large to scale are
+// clamped, so they rank the same as each other.
+func (h *MessageHeap[T]) agedPriority(msg *Message[T]) int64 {
+	limit := maxScaledPriority / int64(h.aging)
+	priority := min(max(int64(msg.Priority), -limit), limit)
+
+	return priority*int64(h.aging) - msg.queued.UnixNano()
+}
+
+// peek returns the message that would be popped next without removing it
+func (h *MessageHeap[T]) peek() *Message[T] {
+	return h.data[0]
 }
 
 // Swap two items in the heap
@@ -3,51 +3,79 @@ package queue
 import (
 	"container/heap"
 	"sync"
+	"time"
 )
 
+// Policy controls the order messages leave a PriorityQueue. The zero value
+// returns messages by priority and then in the order they were sent.
+type Policy struct {
+	// AgingInterval raises the priority of a waiting message by one each
+	// interval so low priority messages can't be starved (0 disables aging)
+	AgingInterval time.Duration
+	// TenantLimit is how many messages from a tenant can be handled at once
+	// when it isn't set in Tenants (0 is unlimited)
+	TenantLimit int
+	// Tenants overrides the weight and limit of specific tenants
+	Tenants map[string]TenantPolicy
+}
+
+// TenantPolicy is the share of the queue a tenant gets
+type TenantPolicy struct {
+	// Weight is the tenant's share relative to the others (0 is treated as 1)
+	Weight uint
+	// Limit is how many of the tenant's messages can be handled at once
+	// (0 falls back to Policy.TenantLimit)
+	Limit int
+}
+
+// tenantQueue holds the messages waiting for one tenant
+type tenantQueue[T any] struct {
+	heap *MessageHeap[T]
+	// active is how many of the tenant's messages are being handled
+	active int
+	// finish is the virtual time the tenant's last message finished at
+	finish float64
+}
+
 // PriorityQueue is like a channel but with dynamic buffering and returns items
-// with the highest priority first
+// with the highest priority first. Tenants share the queue by weighted fair
+// queuing so one tenant's messages can't starve another's regardless of
+// their priorities.
 type PriorityQueue[T any] struct {
-	heap      *MessageHeap[T]
-	heapMutex sync.Mutex
-	out       chan *Message[T]
+	lock      sync.Mutex
 	msgCond   *sync.Cond
+	policy    Policy
+	queueSize int
+	// sequence counts the messages sent to keep equal priorities in order
+	sequence uint64
+	tenants  map[string]*tenantQueue[T]
+	// vtime is the virtual time of the last message sent out. Tenants are
+	// picked by which would finish their next message first in virtual time.
+	vtime float64
+	out   chan *Message[T]
 }
 
 // NewPriorityQueue returns a PriorityQueue instance that is ready to send to
 func NewPriorityQueue[T any](queueSize int) *PriorityQueue[T] {
 	pq := &PriorityQueue[T]{
-		heap:    NewMessageHeap[T](queueSize),
-		out:     make(chan *Message[T]),
-		msgCond: sync.NewCond(&sync.Mutex{}),
+		queueSize: queueSize,
+		tenants:   make(map[string]*tenantQueue[T]),
+		out:       make(chan *Message[T]),
 	}
-
-	// Init the heap
-	heap.Init(pq.heap)
+	pq.msgCond = sync.NewCond(&pq.lock)
 
 	// Set up message forwarding
 	go func() {
 		for {
-			pq.heapMutex.Lock()
-			count := pq.heap.Len()
-			pq.heapMutex.Unlock()
-
-			if count == 0 {
-				pq.waitForMessage()
-			}
-
 			// Get the message but don't send it yet because sending can wait for
 			// the receiver and we don't want to hold the lock for that long
-			pq.heapMutex.Lock()
-			// Sometimes with a lot of workers and very rapid bulk scanning, another
-			// worker may snag the last item between the wait and this lock. So we
-			// need to check the length again just to be sure to avoid any panics.
-			if pq.heap.Len() == 0 {
-				pq.heapMutex.Unlock()
-				continue
+			pq.lock.Lock()
+			msg := pq.next()
+			for msg == nil {
+				pq.msgCond.Wait()
+				msg = pq.next()
 			}
-			msg := heap.Pop(pq.heap).(*Message[T])
-			pq.heapMutex.Unlock()
+			pq.lock.Unlock()
 
 			// Send the message to the out channel
 			pq.out <- msg
@@ -57,29 +85,153 @@ func NewPriorityQueue[T any](queueSize int) *PriorityQueue[T] {
 	return pq
 }
 
+// SetPolicy changes how messages are scheduled, including the ones already
+// waiting
+func (pq *PriorityQueue[T]) SetPolicy(policy Policy) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	pq.policy = policy
+	for _, tenant := range pq.tenants {
+		tenant.heap.aging = policy.AgingInterval
+		heap.Init(tenant.heap)
+	}
+
+	// Limits may have gone up
+	pq.msgCond.Broadcast()
+}
+
 // Send puts items on the queue
 func (pq *PriorityQueue[T]) Send(msg *Message[T]) {
-	pq.heapMutex.Lock()
-	heap.Push(pq.heap, msg)
-	pq.heapMutex.Unlock()
-	pq.signalMessageRecieved()
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	pq.sequence++
+	msg.sequence = pq.sequence
+	msg.queued = time.Now()
+	heap.Push(pq.tenant(msg.Tenant), msg)
+	pq.msgCond.Signal()
+}
+
+// Len returns how many messages are waiting to be received
+func (pq *PriorityQueue[T]) Len() int {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	count := 0
+	for _, tenant := range pq.tenants {
+		count += tenant.heap.Len()
+	}
+
+	return count
 }
 
-// Recv takes a function that can receive messages sent to the queue
+// Recv takes a function that can receive messages sent to the queue. A
+// message counts against its tenant's limit until fn returns.
 func (pq *PriorityQueue[T]) Recv(fn func(*Message[T])) {
 	for msg := range pq.out {
 		fn(msg)
+		pq.done(msg)
 	}
 }
 
-func (pq *PriorityQueue[T]) waitForMessage() {
-	pq.msgCond.L.Lock()
-	pq.msgCond.Wait()
-	pq.msgCond.L.Unlock()
+// tenant returns the heap for the tenant, creating it if needed. The lock
+// must be held.
+func (pq *PriorityQueue[T]) tenant(name string) *MessageHeap[T] {
+	tenant, ok := pq.tenants[name]
+	if !ok {
+		tenant = &tenantQueue[T]{heap: NewMessageHeap[T](pq.queueSize)}
+		tenant.heap.aging = pq.policy.AgingInterval
+		pq.tenants[name] = tenant
+	}
+
+	return tenant.heap
 }
 
-func (pq *PriorityQueue[T]) signalMessageRecieved() {
-	pq.msgCond.L.Lock()
+// next pops the next message to send out or returns nil if every tenant is
+// empty or at its limit. The lock must be held.
+func (pq *PriorityQueue[T]) next() *Message[T] {
+	var nextName string
+	var nextTenant *tenantQueue[T]
+	var nextStart, nextFinish float64
+
+	for name, tenant := range pq.tenants {
+		if tenant.heap.Len() == 0 {
+			continue
+		}
+
+		weight, limit := pq.tenantPolicy(name)
+		if limit > 0 && tenant.active >= limit {
+			continue
+		}
+
+		// Tenants that were idle start from the current virtual time so they
+		// don't build up credit while they have nothing queued
+		start := max(tenant.finish, pq.vtime)
+		finish := start + 1/float64(weight)
+
+		if nextTenant == nil || finish < nextFinish || (finish == nextFinish && pq.headBefore(tenant, nextTenant, name, nextName)) {
+			nextName, nextTenant, nextStart, nextFinish = name, tenant, start, finish
+		}
+	}
+
+	if nextTenant == nil {
+		return nil
+	}
+
+	pq.vtime = nextStart
+	nextTenant.finish = nextFinish
+	nextTenant.active++
+
+	return heap.Pop(nextTenant.heap).(*Message[T])
+}
+
+// headBefore breaks ties between tenants by their next messages and then by
+// name so the order is deterministic
+func (pq *PriorityQueue[T]) headBefore(a, b *tenantQueue[T], aName, bName string) bool {
+	aHead, bHead := a.heap.peek(), b.heap.peek()
+	if a.heap.before(aHead, bHead) {
+		return true
+	}
+
+	if a.heap.before(bHead, aHead) {
+		return false
+	}
+
+	return aName < bName
+}
+
+// tenantPolicy returns the weight and limit for the tenant
+func (pq *PriorityQueue[T]) tenantPolicy(name string) (uint, int) {
+	weight, limit := uint(1), pq.policy.TenantLimit
+
+	if tenantPolicy, ok := pq.policy.Tenants[name]; ok {
+		if tenantPolicy.Weight > 0 {
+			weight = tenantPolicy.Weight
+		}
+
+		if tenantPolicy.Limit > 0 {
+			limit = tenantPolicy.Limit
+		}
+	}
+
+	return weight, limit
+}
+
+// done frees the message's slot in its tenant's limit
+func (pq *PriorityQueue[T]) done(msg *Message[T]) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	tenant, ok := pq.tenants[msg.Tenant]
+	if !ok {
+		return
+	}
+
+	tenant.active--
+	if tenant.active == 0 && tenant.heap.Len() == 0 {
+		delete(pq.tenants, msg.Tenant)
+	}
+
 	pq.msgCond.Signal()
-	pq.msgCond.L.Unlock()
 }
@@ -1,8 +1,11 @@
 package queue
 
 import (
+	"container/heap"
+	"math"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,13 +45,118 @@ func TestPriorityQueue(t *testing.T) {
 			pq.Send(msg)
 		}
 
+		// The forwarder may have already taken one message off the queue
+		assert.GreaterOrEqual(t, pq.Len(), len(messages)-1)
+
 		go pq.Recv(func(msg *Message[string]) {
 			actual = append(actual, msg.Value)
 			wg.Done()
 		})
 
 		wg.Wait()
-		expected := []string{"A", "B", "C", "D", "E"}
+		// Messages with the same priority come out in the order they were sent
+		expected := []string{"A", "B", "D", "C", "E"}
 		assert.Equal(t, expected, actual)
 	})
+	t.Run("Tenants", func(t *testing.T) {
+		pq := NewPriorityQueue[string](8)
+
+		var wg sync.WaitGroup
+		var actual []string
+
+		// The high priority messages from a can't starve b
+		for _, msg := range []*Message[string]{
+			{Priority: 9, Value: "a", Tenant: "a"},
+			{Priority: 9, Value: "a", Tenant: "a"},
+			{Priority: 0, Value: "b", Tenant: "b"},
+			{Priority: 9, Value: "a", Tenant: "a"},
+			{Priority: 0, Value: "b", Tenant: "b"},
+			{Priority: 9, Value: "a", Tenant: "a"},
+		} {
+			wg.Add(1)
+			pq.Send(msg)
+		}
+
+		go pq.Recv(func(msg *Message[string]) {
+			actual = append(actual, msg.Value)
+			wg.Done()
+		})
+
+		wg.Wait()
+		assert.Equal(t, []string{"a", "b", "a", "b", "a", "a"}, actual)
+	})
+
+	t.Run("TenantLimit", func(t *testing.T) {
+		pq := NewPriorityQueue[string](8)
+		pq.SetPolicy(Policy{TenantLimit: 1, Tenants: map[string]TenantPolicy{"b": {Limit: 2}}})
+
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		active := make(map[string]int)
+		maxActive := make(map[string]int)
+
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			pq.Send(&Message[string]{Value: "a", Tenant: "a"})
+			pq.Send(&Message[string]{Value: "b", Tenant: "b"})
+		}
+
+		for i := 0; i < 4; i++ {
+			go pq.Recv(func(msg *Message[string]) {
+				lock.Lock()
+				active[msg.Tenant]++
+				maxActive[msg.Tenant] = max(maxActive[msg.Tenant], active[msg.Tenant])
+				lock.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				lock.Lock()
+				active[msg.Tenant]--
+				lock.Unlock()
+				wg.Done()
+			})
+		}
+
+		wg.Wait()
+		assert.Equal(t, 1, maxActive["a"])
+		assert.LessOrEqual(t, maxActive["b"], 2)
+	})
+}
+
+func TestMessageHeapAging(t *testing.T) {
+	now := time.Now()
+	h := NewMessageHeap[string](3)
+	h.aging = time.Minute
+
+	heap.Push(h, &Message[string]{Priority: 5, Value: "new-high", queued: now, sequence: 1})
+	heap.Push(h, &Message[string]{Priority: 1, Value: "old-low", queued: now.Add(-10 * time.Minute), sequence: 2})
+	heap.Push(h, &Message[string]{Priority: 3, Value: "new-mid", queued: now, sequence: 3})
+
+	var actual []string
+	for h.Len() > 0 {
+		actual = append(actual, heap.Pop(h).(*Message[string]).Value)
+	}
+
+	// Waiting ten minutes raised old-low's priority from 1 to 11
+	assert.Equal(t, []string{"old-low", "new-high", "new-mid"}, actual)
+}
+
+func TestMessageHeapAgingOverflow(t *testing.T) {
+	now := time.Now()
+	h := NewMessageHeap[string](4)
+	h.aging = time.Hour
+
+	heap.Push(h, &Message[string]{Priority: math.MinInt, Value: "min", queued: now, sequence: 1})
+	heap.Push(h, &Message[string]{Priority: 1, Value: "one", queued: now, sequence: 2})
+	heap.Push(h, &Message[string]{Priority: math.MaxInt, Value: "max", queued: now, sequence: 3})
+	heap.Push(h, &Message[string]{Priority: math.MaxInt - 1, Value: "almost-max", queued: now, sequence: 4})
+
+	var actual []string
+	for h.Len() > 0 {
+		actual = append(actual, heap.Pop(h).(*Message[string]).Value)
+	}
+
+	// Huge priorities are clamped instead of wrapping around, so they still
+	// come first and fall back on the order they were sent
+	assert.Equal(t, []string{"max", "almost-max", "one", "min"}, actual)
 }
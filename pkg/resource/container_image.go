@@ -5,13 +5,16 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	iofs "io/fs"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/leaktk/leaktk/pkg/fs"
@@ -20,10 +23,14 @@ import (
 	"github.com/leaktk/leaktk/version"
 
 	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache"
 	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/klauspost/compress/zstd"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 var rfc5322Regexp = regexp.MustCompile(`^(.*)\s<([^>]+)>$`)
@@ -49,6 +56,7 @@ type ContainerImage struct {
 	options      *ContainerImageOptions
 	manifest     *string
 	labels       map[string]string
+	retry        *Retry
 }
 
 // ContainerImageOptions are options for the ContainerImage resource
@@ -115,11 +123,22 @@ func (r *ContainerImage) String() string {
 	return r.location
 }
 
+// Identity returns the fully qualified image name without the tag or digest
+// since the layer digests identify the version
+func (r *ContainerImage) Identity() string {
+	named, err := reference.ParseNormalizedNamed(r.location)
+	if err != nil {
+		return r.location
+	}
+
+	return reference.TrimNamed(named).String()
+}
+
 // Clone the resource to the desired path location
 func (r *ContainerImage) Clone(path string) error {
 	err := os.MkdirAll(path, 0700)
 	if err != nil {
-		return fmt.Errorf("could not create clone directory: %v", err)
+		return fmt.Errorf("could not create clone directory: %w", err)
 	}
 
 	r.path = path
@@ -141,24 +160,33 @@ func (r *ContainerImage) cloneRemoteResource(ctx context.Context, path string, r
 
 	imgRef, err := docker.ParseReference("//" + resource)
 	if err != nil {
-		return fmt.Errorf("could not parse image reference: %v", err)
+		return fmt.Errorf("could not parse image reference: %w", err)
 	}
 
-	imageSource, err := imgRef.NewImageSource(ctx, sysCtx)
+	var imageSource types.ImageSource
+	err = r.retry.Do(ctx, func() (err error) {
+		imageSource, err = imgRef.NewImageSource(ctx, sysCtx)
+		return registryError("could not create image source", err)
+	})
 	if err != nil {
-		return fmt.Errorf("could not create image source: %v", err)
+		return err
 	}
 	defer imageSource.Close()
 
-	rawManifest, manifestType, err := imageSource.GetManifest(ctx, nil)
+	var rawManifest []byte
+	var manifestType string
+	err = r.retry.Do(ctx, func() (err error) {
+		rawManifest, manifestType, err = imageSource.GetManifest(ctx, nil)
+		return registryError("could not fetch manifest", err)
+	})
 	if err != nil {
-		return fmt.Errorf("could not fetch manifest: %v", err)
+		return err
 	}
 	if r.manifest == nil {
 		// We only want the first manifest as it includes all of them
 		err = r.writeFile("manifest.json", rawManifest)
 		if err != nil {
-			return fmt.Errorf("failed writing manifest to clonepath: %v", err)
+			return fmt.Errorf("failed writing manifest to clonepath: %w", err)
 		}
 		stringManifest := string(rawManifest)
 		r.manifest = &stringManifest
@@ -168,19 +196,23 @@ func (r *ContainerImage) cloneRemoteResource(ctx context.Context, path string, r
 		var indexManifest manifest.Schema2List
 		index := 0
 		if err := json.Unmarshal(rawManifest, &indexManifest); err != nil {
-			return fmt.Errorf("could not unmarshal manifest: %v", err)
+			return fmt.Errorf("could not unmarshal manifest: %w", err)
 		}
 		if r.options.Arch != "" {
 			for i, m := range indexManifest.Manifests {
 				if m.Platform.Architecture == r.options.Arch {
 					index = i
-					r.Info(logger.CloneDetail, "selected first %s container", r.options.Arch)
+					r.Info(logger.CloneDetail, "selected first container for arch", logger.String("arch", r.options.Arch))
 					break
 				}
 			}
 		} else {
-			r.Info(logger.CloneDetail, "manifest contains multiple options, defaulted to first (OS: %s, Arch: %s)",
-				indexManifest.Manifests[index].Platform.OS, indexManifest.Manifests[index].Platform.Architecture)
+			r.Info(
+				logger.CloneDetail,
+				"manifest contains multiple options, defaulted to first",
+				logger.String("os", indexManifest.Manifests[index].Platform.OS),
+				logger.String("arch", indexManifest.Manifests[index].Platform.Architecture),
+			)
 		}
 		imgRefString := imageSource.Reference().DockerReference().Name() + "@" + indexManifest.Manifests[index].Digest.String()
 
@@ -189,13 +221,17 @@ func (r *ContainerImage) cloneRemoteResource(ctx context.Context, path string, r
 
 	img, err := imgRef.NewImage(ctx, sysCtx)
 	if err != nil {
-		return fmt.Errorf("could not load image to retrieve labels: %v", err)
+		return registryError("could not load image to retrieve labels", err)
 	}
 	defer img.Close()
 
-	config, err := img.OCIConfig(ctx)
+	var config *imgspecv1.Image
+	err = r.retry.Do(ctx, func() (err error) {
+		config, err = img.OCIConfig(ctx)
+		return registryError("could not get image config to retrieve labels", err)
+	})
 	if err != nil {
-		return fmt.Errorf("could not get image config to retrieve labels: %v", err)
+		return err
 	}
 
 	var layerHistoryDates []*time.Time
@@ -208,16 +244,16 @@ func (r *ContainerImage) cloneRemoteResource(ctx context.Context, path string, r
 
 	configJSON, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to create string from configjson: %v", err)
+		return fmt.Errorf("failed to create string from configjson: %w", err)
 	}
 	err = r.writeFile("config.json", configJSON)
 	if err != nil {
-		return fmt.Errorf("failed to write config to clonepath: %v", err)
+		return fmt.Errorf("failed to write config to clonepath: %w", err)
 	}
 
 	imgManifest, err := manifest.FromBlob(rawManifest, manifestType)
 	if err != nil {
-		return fmt.Errorf("could not parse manifest: %v", err)
+		return fmt.Errorf("could not parse manifest: %w", err)
 	}
 
 	cache := blobinfocache.DefaultCache(sysCtx)
@@ -227,35 +263,98 @@ func (r *ContainerImage) cloneRemoteResource(ctx context.Context, path string, r
 	for i, layer := range layers {
 		if since != nil && layerHistoryDates != nil {
 			if layerHistoryDates[i].Before(*since) {
-				r.Info(logger.CloneDetail, "layer older than provided date, skipping layer %s", layer.Digest.Hex())
+				r.Info(logger.CloneDetail, "layer older than provided date, skipping layer", logger.String("digest", layer.Digest.Hex()))
 				continue
 			}
 		}
 		if r.skipLayer(layer.Digest.Hex()) {
 			continue
 		}
-		r.Debug(logger.CloneDetail, "downloading layer %s", layer.Digest.Hex())
+		r.Debug(logger.CloneDetail, "downloading layer", logger.String("digest", layer.Digest.Hex()))
 
-		blobInfo := types.BlobInfo{
-			Digest: layer.Digest,
-			Size:   layer.Size,
-		}
-		layerBlob, _, err := imageSource.GetBlob(ctx, blobInfo, cache)
+		// Only the layer that failed is downloaded again
+		err = r.retry.Do(ctx, func() error {
+			return r.downloadLayer(ctx, imageSource, cache, layer, path)
+		})
 		if err != nil {
-			return fmt.Errorf("could not download layer blob: %v", err)
+			return err
 		}
+	}
 
-		err = r.extractLayer(layerBlob, layer, path)
-		if err != nil {
-			return fmt.Errorf("could not decompress layer: %v", err)
+	return nil
+}
+
+// downloadLayer downloads and extracts a single layer. Anything left by an
+// earlier attempt is removed first so a retry starts from an empty layer.
+func (r *ContainerImage) downloadLayer(ctx context.Context, imageSource types.ImageSource, cache types.BlobInfoCache, layer manifest.LayerInfo, path string) error {
+	if err := os.RemoveAll(filepath.Join(path, layer.Digest.Hex())); err != nil {
+		return fmt.Errorf("could not remove partial layer: %w", err)
+	}
+
+	blobInfo := types.BlobInfo{
+		Digest: layer.Digest,
+		Size:   layer.Size,
+	}
+	layerBlob, _, err := imageSource.GetBlob(ctx, blobInfo, cache)
+	if err != nil {
+		return registryError("could not download layer blob", err)
+	}
+
+	err = r.extractLayer(layerBlob, layer, path)
+	if err != nil {
+		_ = layerBlob.Close()
+		return registryError("could not decompress layer", err)
+	}
+	err = layerBlob.Close()
+	if err != nil {
+		return fmt.Errorf("could not close layer: %w", err)
+	}
+
+	return nil
+}
+
+// registryError wraps err with msg and tags it with the kind of failure
+// based on the registry and transport error types, so the retries and error
+// codes don't depend on the message
+func registryError(msg string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("%s: %w", msg, err)
+
+	var unauthorized docker.ErrUnauthorizedForCredentials
+	var unexpectedStatus docker.UnexpectedHTTPStatusError
+	var coder errcode.ErrorCoder
+	var dnsErr *net.DNSError
+
+	switch {
+	case errors.As(err, &unauthorized):
+		return withKind(ErrAuth, err)
+	case errors.Is(err, docker.ErrTooManyRequests):
+		return withKind(ErrUnavailable, err)
+	case errors.As(err, &unexpectedStatus):
+		if kind := statusKind(unexpectedStatus.StatusCode); kind != nil {
+			return withKind(kind, err)
 		}
-		err = layerBlob.Close()
-		if err != nil {
-			return fmt.Errorf("could not close layer: %v", err)
+	case errors.As(err, &coder):
+		switch coder.ErrorCode() {
+		case errcode.ErrorCodeUnauthorized, errcode.ErrorCodeDenied:
+			return withKind(ErrAuth, err)
+		case v2.ErrorCodeManifestUnknown, v2.ErrorCodeNameUnknown, v2.ErrorCodeBlobUnknown:
+			return withKind(ErrNotFound, err)
+		case errcode.ErrorCodeTooManyRequests, errcode.ErrorCodeUnavailable:
+			return withKind(ErrUnavailable, err)
 		}
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTemporary || dnsErr.IsTimeout {
+			return withKind(ErrUnavailable, err)
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED):
+		return withKind(ErrUnavailable, err)
 	}
 
-	return nil
+	return err
 }
 
 func (r *ContainerImage) writeFile(filename string, content []byte) error {
@@ -276,7 +375,7 @@ func (r *ContainerImage) copyN(dst string, src io.Reader, n int64) error {
 		return err
 	}
 	if written >= n {
-		r.Warning(logger.CloneDetail, "copying file %s did not finish due to max file size: %v", file.Name(), err)
+		r.Warning(logger.CloneDetail, "copying file did not finish due to max file size", logger.String("path", file.Name()), logger.Int64("max_size", n))
 	}
 	return nil
 }
@@ -289,7 +388,7 @@ func (r *ContainerImage) extractLayer(t io.Reader, layer manifest.LayerInfo, pat
 	layerDir := filepath.Join(path, layer.Digest.Hex())
 	err := os.MkdirAll(layerDir, 0700)
 	if err != nil {
-		return fmt.Errorf("could not create layer directory: %v", err)
+		return fmt.Errorf("could not create layer directory: %w", err)
 	}
 
 	var tarReader *tar.Reader
@@ -297,14 +396,14 @@ func (r *ContainerImage) extractLayer(t io.Reader, layer manifest.LayerInfo, pat
 	if strings.HasSuffix(strings.ToLower(layer.MediaType), "gzip") {
 		gzReader, err := gzip.NewReader(t)
 		if err != nil {
-			return fmt.Errorf("could not create gzip reader: %v", err)
+			return fmt.Errorf("could not create gzip reader: %w", err)
 		}
 		tarReader = tar.NewReader(gzReader)
 		defer gzReader.Close()
 	} else if strings.HasSuffix(strings.ToLower(layer.MediaType), "zstd") {
 		zstdReader, err := zstd.NewReader(t)
 		if err != nil {
-			return fmt.Errorf("could not create zstd reader: %v", err)
+			return fmt.Errorf("could not create zstd reader: %w", err)
 		}
 		tarReader = tar.NewReader(zstdReader)
 		defer zstdReader.Close()
@@ -317,28 +416,28 @@ func (r *ContainerImage) extractLayer(t io.Reader, layer manifest.LayerInfo, pat
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return fmt.Errorf("could not extract tar: %v", err)
+			return fmt.Errorf("could not extract tar: %w", err)
 		}
 		path, err := fs.CleanJoin(layerRootDir, header.Name)
 		if err != nil {
-			r.Error(logger.CloneError, "%v - skipped", err)
+			r.Error(logger.CloneError, "skipping invalid tar entry", logger.String("name", header.Name), logger.Err(err))
 			continue
 		}
 		info := header.FileInfo()
 		if info.IsDir() {
 			if err = os.MkdirAll(path, 0700); err != nil {
-				return fmt.Errorf("could not create directory: %v", err)
+				return fmt.Errorf("could not create directory: %w", err)
 			}
 			continue
 		}
 		if info.Mode()&os.ModeSymlink != 0 {
-			r.Warning(logger.CloneDetail, "skipping file that is a symlink: %s", info.Name())
+			r.Warning(logger.CloneDetail, "skipping file that is a symlink", logger.String("name", info.Name()))
 			continue
 		}
 
 		err = r.copyN(path, tarReader, size)
 		if err != nil {
-			r.Error(logger.CloneError, "could not create/write file: %v", err)
+			r.Error(logger.CloneError, "could not create/write file", logger.String("path", path), logger.Err(err))
 			// Try others, in case its unsupported file name for the filesystem etc.
 			continue
 		}
@@ -406,6 +505,11 @@ func (r *ContainerImage) SetCloneTimeout(timeout time.Duration) {
 	r.cloneTimeout = timeout
 }
 
+// SetRetry sets how the registry requests and layer downloads are retried
+func (r *ContainerImage) SetRetry(retry *Retry) {
+	r.retry = retry
+}
+
 // Since returns the date after which things should be scanned for containers
 // that have history
 func (r *ContainerImage) Since() string {
@@ -416,7 +520,7 @@ func (r *ContainerImage) sinceTime() *time.Time {
 	if len(r.options.Since) > 0 {
 		date, err := time.Parse("2006-01-02", r.options.Since)
 		if err != nil {
-			r.Error(logger.CloneError, "could not parse since time: %v", err)
+			r.Error(logger.CloneError, "could not parse since time", logger.Err(err))
 			return nil
 		}
 
@@ -430,7 +534,7 @@ func (r *ContainerImage) sinceTime() *time.Time {
 func (r *ContainerImage) skipLayer(digest string) bool {
 	for _, exclude := range r.options.Exclusions {
 		if exclude == digest {
-			r.Info(logger.CloneDetail, "layer in exclusion list, skipping layer %s", digest)
+			r.Info(logger.CloneDetail, "layer in exclusion list, skipping layer", logger.String("digest", digest))
 			return true
 		}
 	}
@@ -447,13 +551,13 @@ func (r *ContainerImage) Walk(fn WalkFunc) error {
 	// TODO: consider calling JSONData and creating Files for these instead of walking this way
 	return filepath.WalkDir(r.Path(), func(path string, d iofs.DirEntry, err error) error {
 		if err != nil {
-			r.Error(logger.ScanError, "could not walk path: path=%q error=%q", path, err)
+			r.Error(logger.ScanError, "could not walk path", logger.String("path", path), logger.Err(err))
 			return nil
 		}
 
 		relPath, err := filepath.Rel(r.Path(), path)
 		if err != nil {
-			r.Error(logger.ScanError, "could generate relative path: path=%q error=%q", path, err)
+			r.Error(logger.ScanError, "could generate relative path", logger.String("path", path), logger.Err(err))
 			return nil
 		}
 
@@ -467,13 +571,13 @@ func (r *ContainerImage) Walk(fn WalkFunc) error {
 		}
 
 		if info.Mode()&os.ModeSymlink != 0 {
-			r.Info(logger.ScanDetail, "skipping symlink: path=%q", relPath)
+			r.Info(logger.ScanDetail, "skipping symlink", logger.String("path", relPath))
 			return nil
 		}
 
 		file, err := os.Open(filepath.Clean(path))
 		if err != nil {
-			r.Error(logger.ScanError, "could not open file: path=%q error=%q", relPath, err)
+			r.Error(logger.ScanError, "could not open file", logger.String("path", relPath), logger.Err(err))
 			return nil
 		}
 		defer file.Close()
@@ -1,9 +1,17 @@
 package resource
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"testing"
 
+	"github.com/containers/image/v5/docker"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/response"
 )
 
 func TestContainerImage(t *testing.T) {
@@ -19,4 +27,30 @@ func TestContainerImage(t *testing.T) {
 		assert.Equal(t, "fake-leaks@leaktk.org", contact.Email)
 	})
 
+	t.Run("RegistryErrors", func(t *testing.T) {
+		assert.NoError(t, registryError("could not fetch manifest", nil))
+
+		err := registryError("could not create image source", docker.ErrUnauthorizedForCredentials{Err: errors.New("denied")})
+		assert.Equal(t, response.CloneAuthError, CloneErrorCode(err))
+		assert.ErrorContains(t, err, "could not create image source: ")
+
+		err = registryError("could not fetch manifest", errcode.ErrorCodeDenied.WithMessage("access denied"))
+		assert.Equal(t, response.CloneAuthError, CloneErrorCode(err))
+
+		err = registryError("could not fetch manifest", fmt.Errorf("fetching manifest: %w", v2.ErrorCodeManifestUnknown.WithMessage("gone")))
+		assert.Equal(t, response.NotFoundError, CloneErrorCode(err))
+		assert.False(t, IsRetryable(err))
+
+		err = registryError("could not download layer blob", docker.UnexpectedHTTPStatusError{StatusCode: 503})
+		assert.ErrorIs(t, err, ErrUnavailable)
+		assert.True(t, IsRetryable(err))
+
+		err = registryError("could not download layer blob", docker.ErrTooManyRequests)
+		assert.True(t, IsRetryable(err))
+
+		// A dropped connection while reading the layer
+		err = registryError("could not decompress layer", fmt.Errorf("could not extract tar: %w", io.ErrUnexpectedEOF))
+		assert.ErrorIs(t, err, ErrUnavailable)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
 }
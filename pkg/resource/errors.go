@@ -0,0 +1,183 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// Kinds of clone failures. Clone wraps its errors with these when it knows
+// why the clone failed so the scanner can report a stable error code.
+var (
+	// ErrAuth means the credentials were missing or rejected
+	ErrAuth = errors.New("authentication failed")
+	// ErrNotFound means the resource doesn't exist (or isn't visible)
+	ErrNotFound = errors.New("resource not found")
+	// ErrTimeout means the clone took longer than it was allowed to
+	ErrTimeout = errors.New("timed out")
+	// ErrUnavailable means the server failed or asked to try again later
+	// (e.g. a 5xx or 429 status)
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// kindError tags an error with one of the kinds above without changing its
+// message
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e kindError) Unwrap() []error {
+	return []error{e.err, e.kind}
+}
+
+// withKind tags err with the kind of failure (or the error that caused it)
+func withKind(kind, err error) error {
+	return kindError{err: err, kind: kind}
+}
+
+// statusKind returns the kind of failure for an HTTP status code or nil if
+// the status doesn't say
+func statusKind(statusCode int) error {
+	switch {
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return ErrAuth
+	case statusCode == http.StatusNotFound, statusCode == http.StatusGone:
+		return ErrNotFound
+	case statusCode == http.StatusTooManyRequests, statusCode >= 500:
+		return ErrUnavailable
+	}
+
+	return nil
+}
+
+// Messages from git and container registries that tell what went wrong when
+// the error itself isn't typed
+var (
+	authMessages = []string{
+		"authentication failed",
+		"authentication required",
+		"could not read username",
+		"permission denied (publickey)",
+		"requested access to the resource is denied",
+		"terminal prompts disabled",
+		"unauthorized",
+		"returned error: 401",
+		"returned error: 403",
+	}
+	// These are kept specific on purpose: a bare "not found" also matches
+	// things like a missing git binary, which isn't the resource's fault
+	notFoundMessages = []string{
+		"couldn't find remote ref",
+		"does not appear to be a git repository",
+		"manifest unknown",
+		"name unknown",
+		"not found in upstream",
+		"remote ref does not exist",
+		"repository not found",
+		"returned error: 404",
+	}
+	transientMessages = []string{
+		"502 bad gateway",
+		"503 service unavailable",
+		"504 gateway timeout",
+		"connection refused",
+		"connection reset",
+		"connection timed out",
+		"early eof",
+		"i/o timeout",
+		"internal server error",
+		"returned error: 429",
+		"returned error: 5",
+		"rpc failed",
+		"temporary failure in name resolution",
+		"tls handshake timeout",
+		"too many requests",
+		"unexpected eof",
+	}
+)
+
+// repoNotFoundPattern matches git's message for a missing repo, e.g.
+// "fatal: repository 'https://github.com/leaktk/missing/' not found"
+var repoNotFoundPattern = regexp.MustCompile(`repository '[^']*' not found`)
+
+// CloneErrorCode returns the response error code for an error from Clone
+func CloneErrorCode(err error) response.ErrorCode {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return response.TimeoutError
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return response.TimeoutError
+	case errors.Is(err, ErrAuth):
+		return response.CloneAuthError
+	case errors.Is(err, ErrNotFound):
+		return response.NotFoundError
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, authMessage := range authMessages {
+		if strings.Contains(msg, authMessage) {
+			return response.CloneAuthError
+		}
+	}
+
+	for _, notFoundMessage := range notFoundMessages {
+		if strings.Contains(msg, notFoundMessage) {
+			return response.NotFoundError
+		}
+	}
+
+	if repoNotFoundPattern.MatchString(msg) {
+		return response.NotFoundError
+	}
+
+	return response.CloneError
+}
+
+// IsRetryable returns true if the clone failed for a reason that may go away
+// on its own, like a network timeout, a dropped connection or a 5xx from the
+// server. Auth and not found errors are never retried and neither is running
+// out of clone_timeout, since another attempt would have no time left.
+func IsRetryable(err error) bool {
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return false
+	// Checked before net.Error because context.DeadlineExceeded is one too
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	}
+
+	switch CloneErrorCode(err) {
+	case response.TimeoutError, response.CloneAuthError, response.NotFoundError:
+		return false
+	}
+
+	if errors.Is(err, ErrUnavailable) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, transientMessage := range transientMessages {
+		if strings.Contains(msg, transientMessage) {
+			return true
+		}
+	}
+
+	return false
+}
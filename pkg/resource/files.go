@@ -44,6 +44,15 @@ func (r *Files) String() string {
 	return r.path
 }
 
+// Identity returns the absolute path to the files
+func (r *Files) Identity() string {
+	if path, err := filepath.Abs(r.path); err == nil {
+		return path
+	}
+
+	return r.path
+}
+
 // Clone the resource to the desired local location and store the path
 func (r *Files) Clone(path string) error {
 	// no-op
@@ -103,13 +112,13 @@ func (r *Files) Walk(fn WalkFunc) error {
 
 	return filepath.WalkDir(r.path, func(path string, d iofs.DirEntry, err error) error {
 		if err != nil {
-			r.Error(logger.ScanError, "could not walk path: path=%q error=%q", path, err)
+			r.Error(logger.ScanError, "could not walk path", logger.String("path", path), logger.Err(err))
 			return nil
 		}
 
 		relPath, err := filepath.Rel(r.path, path)
 		if err != nil {
-			r.Error(logger.ScanError, "could generate relative path: path=%q error=%q", path, err)
+			r.Error(logger.ScanError, "could generate relative path", logger.String("path", path), logger.Err(err))
 			return nil
 		}
 
@@ -123,13 +132,13 @@ func (r *Files) Walk(fn WalkFunc) error {
 		}
 
 		if info.Mode()&os.ModeSymlink != 0 {
-			r.Info(logger.ScanDetail, "skipping symlink: path=%q", relPath)
+			r.Info(logger.ScanDetail, "skipping symlink", logger.String("path", relPath))
 			return nil
 		}
 
 		file, err := os.Open(filepath.Clean(path))
 		if err != nil {
-			r.Error(logger.ScanError, "could not open file: path=%q error=%q", relPath, err)
+			r.Error(logger.ScanError, "could not open file", logger.String("path", relPath), logger.Err(err))
 			return nil
 		}
 		defer file.Close()
@@ -3,7 +3,9 @@ package resource
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -89,7 +91,8 @@ func (r *GitRepo) String() string {
 
 // Clone the resource to the desired local location and store the path
 func (r *GitRepo) Clone(path string) error {
-	if r.path != "" {
+	// Cloning to the same path again is allowed so failed clones can be retried
+	if r.path != "" && r.path != path {
 		return fmt.Errorf("resource path already set: path=%q", r.path)
 	}
 
@@ -105,8 +108,8 @@ func (r *GitRepo) Clone(path string) error {
 	// The --[no-]single-branch flags are still needed with mirror due to how
 	// things like --depth and --shallow-since behave
 	if len(r.options.Branch) > 0 {
-		if !r.RemoteRefExists(r.options.Branch) {
-			return fmt.Errorf("remote ref does not exist: resource_id=%q ref=%q", r.ID(), r.options.Branch)
+		if err := r.remoteRef(r.options.Branch); err != nil {
+			return err
 		}
 
 		cloneArgs = append(cloneArgs, "--bare")
@@ -135,7 +138,8 @@ func (r *GitRepo) Clone(path string) error {
 	var ctx context.Context
 
 	if r.cloneTimeout > 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), r.cloneTimeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), r.cloneTimeout)
 		defer cancel()
 		gitClone = exec.CommandContext(ctx, "git", cloneArgs...)
 	} else {
@@ -144,17 +148,68 @@ func (r *GitRepo) Clone(path string) error {
 
 	output, err := gitClone.CombinedOutput()
 
+	// Check this first since the killed command also returns an error
+	if ctx != nil && ctx.Err() == context.DeadlineExceeded {
+		return withKind(ErrTimeout, fmt.Errorf("clone timeout exceeded resource_id=%q error=%q", r.ID(), ctx.Err().Error()))
+	}
+
 	if err != nil {
 		return fmt.Errorf("git clone: resource_id=%q command=%q error=%q output=%q", r.ID(), gitClone.String(), err.Error(), output)
 	}
 
-	r.Debug(logger.CloneDetail, "git clone: resource_id=%q command=%q output=%q", r.ID(), gitClone.String(), output)
+	r.Debug(logger.CloneDetail, "git clone", logger.String("command", gitClone.String()), logger.String("output", string(output)))
 
-	if ctx != nil && ctx.Err() == context.DeadlineExceeded {
-		return fmt.Errorf("clone timeout exceeded resource_id=%q error=%q", r.ID(), ctx.Err().Error())
+	return nil
+}
+
+// Identity returns the normalized repo URL. For local repos it uses the
+// origin remote if there is one so a local clone matches the remote repo.
+func (r *GitRepo) Identity() string {
+	if r.IsLocal() {
+		cmd := exec.Command("git", "-C", r.repo, "config", "--get", "remote.origin.url") // #nosec G204
+		if output, err := cmd.Output(); err == nil && len(bytes.TrimSpace(output)) > 0 {
+			return NormalizeGitURL(string(output))
+		}
+
+		if path, err := filepath.Abs(r.repo); err == nil {
+			return path
+		}
 	}
 
-	return nil
+	return NormalizeGitURL(r.repo)
+}
+
+// NormalizeGitURL reduces the different ways of referencing a remote repo to
+// "host/path" so that https, ssh and scp style URLs for the same repo match.
+// The scheme, user info, port, trailing slashes and ".git" suffix are removed
+// and the host is lower cased. The path's case is kept since not every forge
+// treats it as case insensitive.
+func NormalizeGitURL(repo string) string {
+	repo = strings.TrimSpace(repo)
+	var host, path string
+
+	if strings.Contains(repo, "://") {
+		u, err := url.Parse(repo)
+		if err != nil {
+			return repo
+		}
+
+		host, path = u.Hostname(), u.Path
+	} else if at := strings.Index(repo, ":"); at > 0 && !strings.Contains(repo[:at], "/") {
+		// scp style: [user@]host:path
+		host, path = repo[:at], repo[at+1:]
+
+		if user := strings.LastIndex(host, "@"); user >= 0 {
+			host = host[user+1:]
+		}
+	} else {
+		return strings.TrimSuffix(strings.TrimRight(repo, "/"), ".git")
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	path = strings.TrimRight(path, "/")
+
+	return strings.ToLower(host) + "/" + path
 }
 
 // Path returns where the repo is on disk
@@ -247,8 +302,10 @@ func (r *GitRepo) Walk(fn WalkFunc) error {
 		}
 
 		data, err := r.ReadFile(path)
-		if err == nil {
-			return err
+		if err != nil {
+			// Things like submodules show up in the tree but can't be read
+			r.Warning(logger.ScanDetail, "could not read file", logger.String("path", path), logger.Err(err))
+			continue
 		}
 
 		if err := fn(path, bytes.NewReader(data)); err != nil {
@@ -261,8 +318,26 @@ func (r *GitRepo) Walk(fn WalkFunc) error {
 
 // RemoteRefExists checks the remote repo to see if the ref exists
 func (r *GitRepo) RemoteRefExists(ref string) bool {
+	return r.remoteRef(ref) == nil
+}
+
+// remoteRef checks the remote repo for the ref and returns an ErrNotFound
+// error if it doesn't exist or the reason it couldn't check
+func (r *GitRepo) remoteRef(ref string) error {
 	cmd := exec.Command("git", "ls-remote", "--exit-code", "--quiet", r.String(), ref) // #nosec G204
-	return cmd.Run() == nil
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	// ls-remote exits with 2 when it could talk to the remote but the ref
+	// wasn't there
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return withKind(ErrNotFound, fmt.Errorf("remote ref does not exist: resource_id=%q ref=%q", r.ID(), ref))
+	}
+
+	return fmt.Errorf("could not check remote ref: resource_id=%q ref=%q error=%q output=%q", r.ID(), ref, err.Error(), output)
 }
 
 // Refs returns the unique OIDs in a repo
@@ -272,7 +347,7 @@ func (r *GitRepo) Refs() []string {
 	refs := []string{}
 
 	if err != nil {
-		r.Error(logger.CommandError, "could not list refs: error=%q", err)
+		r.Error(logger.CommandError, "could not list refs", logger.Err(err))
 		return refs
 	}
 
@@ -64,6 +64,12 @@ func (r *JSONData) String() string {
 	return r.raw
 }
 
+// Identity is empty since the data isn't tied to a location. Results are
+// identified by their path in the data instead.
+func (r *JSONData) Identity() string {
+	return ""
+}
+
 // Clone the resource to the desired local location and store the path
 func (r *JSONData) Clone(path string) error {
 	var err error
@@ -76,7 +82,7 @@ func (r *JSONData) Clone(path string) error {
 
 	// Load the raw json into the data variable
 	if err = json.Unmarshal([]byte(r.raw), &r.data); err != nil {
-		r.Debug(logger.ScanDetail, "JSONData:\n%v", r.raw)
+		r.Debug(logger.ScanDetail, "could not unmarshal JSONData", logger.String("data", r.raw))
 		return fmt.Errorf("could not unmarshal JSONData: error=%q", err)
 	}
 
@@ -124,22 +130,22 @@ func (r *JSONData) fetchURLs(rootNode jsonNode, path string) error {
 		}
 
 		if !r.shouldFetchURL(leafNode.path) {
-			r.Debug(logger.CloneDetail, "not fetching URL: path=%q url=%q", leafNode.path, obj)
+			r.Debug(logger.CloneDetail, "not fetching URL", logger.String("path", leafNode.path), logger.String("url", obj))
 			return nil
 		}
 
 		urlResource := NewURL(obj, &URLOptions{})
-		r.Info(logger.CloneDetail, "fetching url: url=%q", obj)
+		r.Info(logger.CloneDetail, "fetching url", logger.String("url", obj))
 		err := urlResource.Clone(filepath.Join(path, leafNode.path))
 
 		if err != nil {
 			// Not being able to retrieve a URL found inside JSONData is not a fatal error. Logging until update how
 			// we manage fatal/nonfatal errors flowing through the application.
-			r.Error(logger.CloneError, "%v", fmt.Errorf("could not fetch url: path=%q url=%q error=%q", leafNode.path, obj, err))
+			r.Error(logger.CloneError, "could not fetch url", logger.String("path", leafNode.path), logger.String("url", obj), logger.Err(err))
 			return nil
 		}
 
-		r.Info(logger.CloneDetail, "replacing url with contents: path=%q url=%q", leafNode.path, obj)
+		r.Info(logger.CloneDetail, "replacing url with contents", logger.String("path", leafNode.path), logger.String("url", obj))
 		return r.replaceWithResource(leafNode, urlResource)
 	})
 }
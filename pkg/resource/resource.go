@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/leaktk/leaktk/pkg/id"
@@ -20,25 +22,36 @@ type WalkFunc func(path string, reader io.Reader) error
 type Resource interface {
 	Clone(path string) error
 	Path() string
-	Critical(code logger.LogCode, msg string, args ...any)
-	Debug(code logger.LogCode, msg string, args ...any)
+	Critical(code logger.LogCode, msg string, fields ...logger.Field)
+	Debug(code logger.LogCode, msg string, fields ...logger.Field)
 	Depth() uint16
 	EnrichResult(result *response.Result) *response.Result
-	Error(code logger.LogCode, msg string, args ...any)
+	Error(code logger.LogCode, msg string, fields ...logger.Field)
+	// Errors are the errors logged for the resource for the response
+	Errors() []response.LeakTKError
+	Fail(code logger.LogCode, errCode response.ErrorCode, fatal bool, msg string, fields ...logger.Field)
 	ID() string
-	Info(code logger.LogCode, msg string, args ...any)
+	// Identity is a normalized form of the resource used to recognize the
+	// same resource across requests (e.g. different git URL forms)
+	Identity() string
+	Info(code logger.LogCode, msg string, fields ...logger.Field)
 	Kind() string
+	// Logger returns a logger that attaches the resource and request IDs
+	Logger() *logger.Logger
 	Logs() []logger.Entry
 	Priority() int
 	ReadFile(path string) ([]byte, error)
+	Record(level logger.LogLevel, code logger.LogCode, msg string, fields ...logger.Field)
 	SetCloneTimeout(timeout time.Duration)
 	SetDepth(depth uint16)
 	IncludeLogs(enabled bool)
+	SetLogLevel(level logger.LogLevel)
+	SetRequestID(requestID string)
 	Since() string
 	String() string
 	// Walk is the main way to pick through resource data (except for GitRepo)
 	Walk(WalkFunc) error
-	Warning(code logger.LogCode, msg string, args ...any)
+	Warning(code logger.LogCode, msg string, fields ...logger.Field)
 	IsLocal() bool
 }
 
@@ -127,8 +140,13 @@ func NewResource(kind, resource string, options json.RawMessage) (Resource, erro
 // BaseResource is a mixin to handle some of the common resource related methods
 type BaseResource struct {
 	id          string
+	requestID   string
 	logs        []logger.Entry
+	errors      []response.LeakTKError
 	includeLogs bool
+	// logLevel captures the logs at or above it in the resource logs even
+	// if the global level filters them out (NOTSET means it isn't set)
+	logLevel logger.LogLevel
 }
 
 // ID returns a path-safe, unique id for this resource
@@ -140,68 +158,157 @@ func (r *BaseResource) ID() string {
 	return r.id
 }
 
+// SetRequestID sets the ID of the request for the resource so it's attached
+// to the resource's logs
+func (r *BaseResource) SetRequestID(requestID string) {
+	r.requestID = requestID
+}
+
+// SetLogLevel captures the resource's logs at or above the level in its logs
+// regardless of the global level
+func (r *BaseResource) SetLogLevel(level logger.LogLevel) {
+	r.logLevel = level
+}
+
+// Logger returns a logger that attaches the resource and request IDs. If a
+// log level is set, its entries are captured in the resource logs too.
+func (r *BaseResource) Logger() *logger.Logger {
+	l := logger.With(r.logFields()...)
+	if r.logLevel == logger.NOTSET {
+		return l
+	}
+
+	return l.Capture(r.logLevel, func(entry logger.Entry) {
+		r.logs = append(r.logs, responseEntry(entry))
+	})
+}
+
+func (r *BaseResource) logFields() []logger.Field {
+	fields := []logger.Field{logger.String("resource_id", r.ID())}
+	if len(r.requestID) > 0 {
+		fields = append(fields, logger.String("request_id", r.requestID))
+	}
+
+	return fields
+}
+
 // Logs returns logs collected on the resource
 func (r *BaseResource) Logs() []logger.Entry {
 	return r.logs
 }
 
-// Critical forwards to the logger and adds to the resource logs used for critical errors that interrupt
-// the scanner flow.
-func (r *BaseResource) Critical(code logger.LogCode, msg string, args ...any) {
-	resourceMsg := fmt.Sprintf("resource_id=%s %s", r.id, msg)
-	if entry := logger.Critical(resourceMsg, args...); entry != nil {
-		entry.Message = fmt.Errorf(msg, args...).Error()
-		entry.Code = code.String()
-		r.logs = append(r.logs, *entry)
+// Errors returns the errors recorded on the resource
+func (r *BaseResource) Errors() []response.LeakTKError {
+	return r.errors
+}
+
+// errorCodes are the response error codes for the log codes that are errors
+var errorCodes = map[logger.LogCode]response.ErrorCode{
+	logger.CloneError:           response.CloneError,
+	logger.ScanError:            response.ScanError,
+	logger.ResourceCleanupError: response.ResourceCleanupError,
+	logger.LocalScanDisabled:    response.LocalScanDisabled,
+	logger.CommandError:         response.ScanError,
+}
+
+// addError records an error for the response if it has a code
+func (r *BaseResource) addError(errCode response.ErrorCode, fatal bool, msg string) {
+	if errCode == response.NoErrorCode {
+		return
 	}
+
+	r.errors = append(r.errors, response.LeakTKError{
+		Fatal:   fatal,
+		Code:    errCode,
+		Message: msg,
+	})
 }
 
-// Debug forwards to the logger and adds to the resource logs based on log level
-func (r *BaseResource) Debug(code logger.LogCode, msg string, args ...any) {
-	resourceMsg := fmt.Sprintf("resource_id=%s %s", r.id, msg)
-	if entry := logger.Debug(resourceMsg, args...); entry != nil {
-		if r.includeLogs {
-			entry.Message = fmt.Errorf(msg, args...).Error()
-			entry.Code = code.String()
-			r.logs = append(r.logs, *entry)
-		}
+// log forwards to the logger with the resource_id and request_id fields
+// followed by the fields passed in and adds the entry to the resource logs if
+// always is set or logs are included. It returns the message with the fields
+// for the response errors.
+func (r *BaseResource) log(level logger.LogLevel, always bool, code logger.LogCode, msg string, fields ...logger.Field) string {
+	entryFields := append(r.logFields(), fields...)
+
+	entry := logger.With(entryFields...).Log(level, msg)
+	captured := r.logLevel != logger.NOTSET && level >= r.logLevel
+	if entry == nil && captured {
+		entry = logger.NewEntry(level, msg, entryFields...)
+	}
+
+	if entry != nil && (always || r.includeLogs || captured) {
+		entry.Code = code.String()
+		r.logs = append(r.logs, responseEntry(*entry))
 	}
+
+	return errorMessage(msg, fields)
 }
 
-// Error forwards to the logger and adds to the resource logs based on log level
-func (r *BaseResource) Error(code logger.LogCode, msg string, args ...any) {
-	resourceMsg := fmt.Sprintf("resource_id=%s %s", r.id, msg)
-	if entry := logger.Error(resourceMsg, args...); entry != nil {
-		if r.includeLogs {
-			entry.Message = fmt.Errorf(msg, args...).Error()
-			entry.Code = code.String()
-			r.logs = append(r.logs, *entry)
-		}
+// responseEntry drops the request_id field from an entry kept for the
+// response. The response has its own request_id and a response can be shared
+// by identical requests, so the field could name a different request.
+func responseEntry(entry logger.Entry) logger.Entry {
+	entry.Fields = slices.DeleteFunc(slices.Clone(entry.Fields), func(field logger.Field) bool {
+		return field.Key == "request_id"
+	})
+
+	return entry
+}
+
+// errorMessage renders the message and fields like the HUMAN log format
+func errorMessage(msg string, fields []logger.Field) string {
+	if len(fields) == 0 {
+		return msg
+	}
+
+	pairs := make([]string, len(fields))
+	for i, field := range fields {
+		pairs[i] = field.String()
 	}
+
+	return msg + ": " + strings.Join(pairs, " ")
+}
+
+// Critical forwards to the logger and adds to the resource logs used for critical errors that interrupt
+// the scanner flow. It also records a fatal error for the response.
+func (r *BaseResource) Critical(code logger.LogCode, msg string, fields ...logger.Field) {
+	r.addError(errorCodes[code], true, r.log(logger.CRITICAL, true, code, msg, fields...))
+}
+
+// Fail is like Critical but records the error with a more specific code
+// than the log code gives and whether it was fatal to the request. With
+// NoErrorCode it only logs.
+func (r *BaseResource) Fail(code logger.LogCode, errCode response.ErrorCode, fatal bool, msg string, fields ...logger.Field) {
+	r.addError(errCode, fatal, r.log(logger.CRITICAL, true, code, msg, fields...))
+}
+
+// Debug forwards to the logger and adds to the resource logs based on log level
+func (r *BaseResource) Debug(code logger.LogCode, msg string, fields ...logger.Field) {
+	r.log(logger.DEBUG, false, code, msg, fields...)
+}
+
+// Error forwards to the logger and adds to the resource logs based on log
+// level. It also records a non-fatal error for the response.
+func (r *BaseResource) Error(code logger.LogCode, msg string, fields ...logger.Field) {
+	r.addError(errorCodes[code], false, r.log(logger.ERROR, false, code, msg, fields...))
 }
 
 // Warning forwards to the logger and adds to the resource logs based on log level
-func (r *BaseResource) Warning(code logger.LogCode, msg string, args ...any) {
-	resourceMsg := fmt.Sprintf("resource_id=%s %s", r.id, msg)
-	if entry := logger.Warning(resourceMsg, args...); entry != nil {
-		if r.includeLogs {
-			entry.Message = fmt.Errorf(msg, args...).Error()
-			entry.Code = code.String()
-			r.logs = append(r.logs, *entry)
-		}
-	}
+func (r *BaseResource) Warning(code logger.LogCode, msg string, fields ...logger.Field) {
+	r.log(logger.WARNING, false, code, msg, fields...)
 }
 
 // Info forwards to the logger and adds to the resource logs based on log level
-func (r *BaseResource) Info(code logger.LogCode, msg string, args ...any) {
-	resourceMsg := fmt.Sprintf("resource_id=%s %s", r.id, msg)
-	if entry := logger.Info(resourceMsg, args...); entry != nil {
-		if r.includeLogs {
-			r.logs = append(r.logs, *entry)
-			entry.Message = fmt.Errorf(msg, args...).Error()
-			entry.Code = code.String()
-		}
-	}
+func (r *BaseResource) Info(code logger.LogCode, msg string, fields ...logger.Field) {
+	r.log(logger.INFO, false, code, msg, fields...)
+}
+
+// Record forwards to the logger and always adds to the resource logs. It's
+// for things the response should show even when logs aren't included (e.g.
+// retried clones).
+func (r *BaseResource) Record(level logger.LogLevel, code logger.LogCode, msg string, fields ...logger.Field) {
+	r.log(level, true, code, msg, fields...)
 }
 
 // IncludeLogs sets whether to include non-error logs
@@ -0,0 +1,108 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+func TestBaseResourceLogs(t *testing.T) {
+	resource := &BaseResource{}
+	resource.SetRequestID("request-1")
+
+	// Critical entries are always kept and the rest only when included
+	resource.Info(logger.ScanDetail, "hidden")
+	resource.Critical(logger.CloneError, "clone error", logger.Err(errors.New("offline")))
+	resource.IncludeLogs(true)
+	resource.Warning(logger.ScanDetail, "applied baseline", logger.Int("removed", 2))
+
+	logs := resource.Logs()
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "CRITICAL", logs[0].Severity)
+	assert.Equal(t, "CloneError", logs[0].Code)
+	assert.Equal(t, "clone error", logs[0].Message)
+	// The request_id is left out since a response can be shared by requests
+	assert.Equal(t, []logger.Field{
+		logger.String("resource_id", resource.ID()),
+		logger.Err(errors.New("offline")),
+	}, logs[0].Fields)
+	assert.Equal(t, "applied baseline", logs[1].Message)
+	assert.Contains(t, logs[1].Fields, logger.Int("removed", 2))
+}
+
+func TestBaseResourceLogLevel(t *testing.T) {
+	resource := &BaseResource{}
+	resource.SetRequestID("request-1")
+	resource.SetLogLevel(logger.DEBUG)
+
+	// DEBUG entries are captured even though the global level is higher
+	assert.NoError(t, logger.SetLoggerLevel("INFO"))
+	resource.Debug(logger.CloneDetail, "cloning", logger.Int("depth", 1))
+	resource.Logger().Debug("scan started")
+
+	logs := resource.Logs()
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "DEBUG", logs[0].Severity)
+	assert.Equal(t, "CloneDetail", logs[0].Code)
+	assert.Equal(t, "cloning", logs[0].Message)
+	assert.Contains(t, logs[0].Fields, logger.Int("depth", 1))
+	assert.Equal(t, "scan started", logs[1].Message)
+	assert.NotContains(t, logs[1].Fields, logger.String("request_id", "request-1"))
+}
+
+func TestBaseResourceErrors(t *testing.T) {
+	resource := &BaseResource{}
+
+	resource.Warning(logger.ScanDetail, "not an error")
+	resource.Error(logger.ResourceCleanupError, "could not remove files")
+	resource.Fail(logger.CloneError, response.NotFoundError, true, "clone error", logger.Err(errors.New("not found")))
+
+	assert.Equal(t, []response.LeakTKError{
+		{Fatal: false, Code: response.ResourceCleanupError, Message: "could not remove files"},
+		{Fatal: true, Code: response.NotFoundError, Message: `clone error: error="not found"`},
+	}, resource.Errors())
+}
+
+func TestCloneErrorCode(t *testing.T) {
+	assert.Equal(t, response.TimeoutError, CloneErrorCode(withKind(ErrTimeout, errors.New("clone timeout exceeded"))))
+	assert.Equal(t, response.CloneAuthError, CloneErrorCode(withKind(ErrAuth, errors.New("unexpected status code: status_code=401"))))
+	assert.Equal(t, response.CloneAuthError, CloneErrorCode(errors.New(`git clone: output="fatal: could not read Username for 'https://github.com'"`)))
+	assert.Equal(t, response.NotFoundError, CloneErrorCode(errors.New(`git clone: output="remote: Repository not found."`)))
+	assert.Equal(t, response.NotFoundError, CloneErrorCode(errors.New(`git clone: output="fatal: repository 'https://github.com/leaktk/missing/' not found"`)))
+	assert.Equal(t, response.NotFoundError, CloneErrorCode(errors.New(`git clone: output="warning: Could not find remote branch main to clone.\nfatal: Remote branch main not found in upstream origin"`)))
+	assert.Equal(t, response.NotFoundError, CloneErrorCode(errors.New("could not fetch manifest: manifest unknown")))
+	assert.Equal(t, response.CloneError, CloneErrorCode(errors.New(`git clone: exec: "git": executable file not found in $PATH`)))
+	assert.Equal(t, response.CloneError, CloneErrorCode(errors.New("open /tmp/leaktk/config.toml: file does not exist")))
+	assert.Equal(t, response.CloneError, CloneErrorCode(errors.New("could not create clone directory")))
+
+	// The kind doesn't change the message
+	assert.Equal(t, "remote ref does not exist", withKind(ErrNotFound, errors.New("remote ref does not exist")).Error())
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.False(t, IsRetryable(withKind(ErrTimeout, errors.New("clone timeout exceeded"))))
+	assert.False(t, IsRetryable(fmt.Errorf("could not fetch manifest: %w", context.DeadlineExceeded)))
+	assert.True(t, IsRetryable(&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}))
+	assert.True(t, IsRetryable(withKind(ErrUnavailable, errors.New("unexpected status code: status_code=502"))))
+	assert.True(t, IsRetryable(errors.New(`git clone: output="error: RPC failed; curl 56 Recv failure: Connection reset by peer"`)))
+	assert.True(t, IsRetryable(errors.New(`git clone: output="fatal: unable to access: The requested URL returned error: 503"`)))
+	assert.False(t, IsRetryable(errors.New(`git clone: output="fatal: unable to access: The requested URL returned error: 403"`)))
+	assert.False(t, IsRetryable(errors.New(`git clone: output="remote: Repository not found."`)))
+	assert.False(t, IsRetryable(errors.New("could not create clone directory")))
+	assert.False(t, IsRetryable(errors.New(`git clone: exec: "git": executable file not found in $PATH`)))
+	assert.False(t, IsRetryable(nil))
+}
+
+// timeoutError is a transport level timeout like the ones from net.Conn
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,54 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Retry is how a resource retries the parts of a clone that fail for reasons
+// that may go away on their own
+type Retry struct {
+	// MaxAttempts includes the first attempt
+	MaxAttempts int
+	// Backoff returns how long to wait after the attempt (starting at 1)
+	// failed
+	Backoff func(attempt int) time.Duration
+	// OnRetry is called with the failed attempt before waiting to retry
+	OnRetry func(attempt int, backoff time.Duration, err error)
+}
+
+// Retrier is implemented by resources that retry parts of their clone (e.g.
+// a single image layer) so a failure doesn't start the whole clone over
+type Retrier interface {
+	SetRetry(retry *Retry)
+}
+
+// Do calls fn until it succeeds, fails for a reason that isn't retryable or
+// runs out of attempts. It stops waiting when ctx is done. A nil Retry calls
+// fn once.
+func (r *Retry) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || r == nil || attempt >= r.MaxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		var backoff time.Duration
+		if r.Backoff != nil {
+			backoff = r.Backoff(attempt)
+		}
+
+		if r.OnRetry != nil {
+			r.OnRetry(attempt, backoff, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
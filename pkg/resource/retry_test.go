@@ -0,0 +1,87 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDo(t *testing.T) {
+	transient := errors.New("read: connection reset by peer")
+
+	t.Run("RetriesTransientErrors", func(t *testing.T) {
+		var retried []int
+		retry := &Retry{
+			MaxAttempts: 3,
+			OnRetry: func(attempt int, _ time.Duration, _ error) {
+				retried = append(retried, attempt)
+			},
+		}
+
+		calls := 0
+		err := retry.Do(context.Background(), func() error {
+			if calls++; calls < 3 {
+				return transient
+			}
+
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, []int{1, 2}, retried)
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		calls := 0
+		err := (&Retry{MaxAttempts: 2}).Do(context.Background(), func() error {
+			calls++
+			return transient
+		})
+
+		assert.Equal(t, transient, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		calls := 0
+		err := (&Retry{MaxAttempts: 3}).Do(context.Background(), func() error {
+			calls++
+			return withKind(ErrNotFound, fmt.Errorf("could not fetch manifest: %w", transient))
+		})
+
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		var retry *Retry
+
+		calls := 0
+		err := retry.Do(context.Background(), func() error {
+			calls++
+			return transient
+		})
+
+		assert.Equal(t, transient, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		retry := &Retry{
+			MaxAttempts: 3,
+			Backoff:     func(int) time.Duration { return time.Hour },
+		}
+
+		err := retry.Do(ctx, func() error { return transient })
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, err, transient)
+	})
+}
@@ -42,6 +42,12 @@ func (r *Text) String() string {
 	return r.data
 }
 
+// Identity is empty since the data isn't tied to a location. Results are
+// identified by their path in the data instead.
+func (r *Text) Identity() string {
+	return ""
+}
+
 // Clone the resource to the desired local location and store the path
 func (r *Text) Clone(path string) error {
 	var err error
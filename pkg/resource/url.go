@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -48,6 +49,21 @@ func (r *URL) String() string {
 	return r.url
 }
 
+// Identity returns the URL with a lower case scheme and host and without
+// the fragment
+func (r *URL) Identity() string {
+	u, err := neturl.Parse(strings.TrimSpace(r.url))
+	if err != nil {
+		return r.url
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+
+	return u.String()
+}
+
 // Clone the resource to the desired local location and store the path
 func (r *URL) Clone(path string) error {
 	r.path = path
@@ -55,12 +71,20 @@ func (r *URL) Clone(path string) error {
 	client := httpclient.NewClient()
 	resp, err := client.Get(r.url)
 	if err != nil {
-		return fmt.Errorf("http GET error: error=%q", err)
+		// Keep the client's error so timeouts and dropped connections can be
+		// told apart from other failures
+		return withKind(err, fmt.Errorf("http GET error: error=%q", err))
 	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: status_code=%d", resp.StatusCode)
+		err := fmt.Errorf("unexpected status code: status_code=%d", resp.StatusCode)
+		if kind := statusKind(resp.StatusCode); kind != nil {
+			return withKind(kind, err)
+		}
+
+		return err
 	}
-	defer resp.Body.Close()
 
 	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
 		data, err := io.ReadAll(resp.Body)
@@ -4,9 +4,11 @@ import "fmt"
 
 // LeakTKError expands a normal error to provide additional meta data
 type LeakTKError struct {
-	Fatal   bool      `json:"fatal"`
-	Code    ErrorCode `json:"code"`
-	Message string    `json:"message"`
+	// Fatal means the request couldn't be scanned. Otherwise the results may
+	// only be partial.
+	Fatal   bool      `json:"fatal" toml:"fatal" yaml:"fatal"`
+	Code    ErrorCode `json:"code" toml:"code" yaml:"code"`
+	Message string    `json:"message" toml:"message" yaml:"message"`
 }
 
 // Error is defined to implement the error interface
@@ -22,15 +24,17 @@ func (e LeakTKError) String() string {
 		fatal = "fatal "
 	}
 
-	return fmt.Sprintf("%serror occurred, code %d (%s): %s", fatal, e.Code, errorNames[e.Code], e.Message)
+	return fmt.Sprintf("%serror occurred, code %d (%s): %s", fatal, e.Code, e.Code, e.Message)
 }
 
-// ErrorCode defines the set of error codes that can be set on a LeakTKError
+// ErrorCode defines the set of error codes that can be set on a LeakTKError.
+// The codes are written as their names in responses so only add new codes to
+// the end and don't rename them.
 type ErrorCode int
 
 const (
 	// NoErrorCode means the error code hasn't been set
-	NoErrorCode = iota
+	NoErrorCode ErrorCode = iota
 	// CloneError means we were unable to successfully clone the resource
 	CloneError
 	// ScanError means there was some issue scanning the cloned resource
@@ -39,6 +43,88 @@ const (
 	ResourceCleanupError
 	// LocalScanDisabled means local scans are not enabled
 	LocalScanDisabled
+	// CloneAuthError means the credentials for the clone were missing or rejected
+	CloneAuthError
+	// NotFoundError means the resource (or the requested part of it) doesn't exist
+	NotFoundError
+	// TimeoutError means the clone or scan took longer than it was allowed to
+	TimeoutError
+	// PatternsUnavailable means the patterns needed for the scan couldn't be loaded
+	PatternsUnavailable
+	// RequestRejected means the scanner was at one of its limits and didn't queue the request
+	RequestRejected
+	// ReloadError means the config or patterns couldn't be reloaded
+	ReloadError
 )
 
-var errorNames = [...]string{"NoErrorCode", "CloneError", "ScanError", "ResourceCleanupError"}
+var errorNames = [...]string{
+	"NoErrorCode",
+	"CloneError",
+	"ScanError",
+	"ResourceCleanupError",
+	"LocalScanDisabled",
+	"CloneAuthError",
+	"NotFoundError",
+	"TimeoutError",
+	"PatternsUnavailable",
+	"RequestRejected",
+	"ReloadError",
+}
+
+// String returns the name of the code
+func (c ErrorCode) String() string {
+	if c < 0 || int(c) >= len(errorNames) {
+		return errorNames[NoErrorCode]
+	}
+
+	return errorNames[c]
+}
+
+// MarshalText writes the code as its name
+func (c ErrorCode) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText reads the code from its name. Unknown names (e.g. from a
+// newer version) become NoErrorCode instead of failing.
+func (c *ErrorCode) UnmarshalText(text []byte) error {
+	*c = NoErrorCode
+
+	for code, name := range errorNames {
+		if name == string(text) {
+			*c = ErrorCode(code)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Response statuses
+const (
+	// StatusSuccess means the request was scanned without errors
+	StatusSuccess = "success"
+	// StatusPartial means the request was scanned but there were errors so
+	// the results may be incomplete
+	StatusPartial = "partial"
+	// StatusFailed means the request couldn't be scanned
+	StatusFailed = "failed"
+	// StatusRejected is the status of a response to a request the scanner
+	// wouldn't queue
+	StatusRejected = "rejected"
+)
+
+// ErrorStatus returns the status for a response with these errors
+func ErrorStatus(errs []LeakTKError) string {
+	status := StatusSuccess
+
+	for _, err := range errs {
+		if err.Fatal {
+			return StatusFailed
+		}
+
+		status = StatusPartial
+	}
+
+	return status
+}
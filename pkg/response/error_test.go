@@ -1,6 +1,7 @@
 package response
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,3 +22,22 @@ func TestL(t *testing.T) {
 		assert.Equal(t, "fatal error occurred, code 2 (ScanError): test error message", e.String())
 	})
 }
+
+func TestErrorCodeJSON(t *testing.T) {
+	data, err := json.Marshal(LeakTKError{Fatal: true, Code: CloneAuthError, Message: "denied"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"fatal":true,"code":"CloneAuthError","message":"denied"}`, string(data))
+
+	var e LeakTKError
+	assert.NoError(t, json.Unmarshal(data, &e))
+	assert.Equal(t, CloneAuthError, e.Code)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"code":"SomethingNew"}`), &e))
+	assert.Equal(t, NoErrorCode, e.Code)
+}
+
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, StatusSuccess, ErrorStatus(nil))
+	assert.Equal(t, StatusPartial, ErrorStatus([]LeakTKError{{Code: ResourceCleanupError}}))
+	assert.Equal(t, StatusFailed, ErrorStatus([]LeakTKError{{Code: ScanError}, {Fatal: true, Code: CloneError}}))
+}
@@ -166,12 +166,14 @@ func flattenedResponse(response *Response) ([]string, [][]string) {
 			fmt.Sprintf("L%dC%d-L%dC%d", result.Location.Start.Line,
 				result.Location.Start.Column, result.Location.End.Line, result.Location.End.Column),
 			strings.Join(result.Rule.Tags, ", "),
+			result.SecretHash,
+			result.Fingerprint,
 		})
 	}
 
 	return []string{"ID", "REQUEST.ID", "RESULT.ID", "RESULT.KIND", "RESULT.RULE.ID", "RESULT.RULE.DESCRIPTION",
 		"RESULT.CONTACT", "RESULT.SECRET", "RESULT.MATCH", "RESULT.ENTROPY", "RESULT.DATE", "RESULT.LOCATION.VERSION",
-		"RESULT.LOCATION.PATH", "RESULT.LOCATION.RANGE", "RESULT.RULE.TAGS"}, flattened
+		"RESULT.LOCATION.PATH", "RESULT.LOCATION.RANGE", "RESULT.RULE.TAGS", "RESULT.SECRET_HASH", "RESULT.FINGERPRINT"}, flattened
 }
 
 // flattenContact creates a single string with Contact information as "Name <Email>"
@@ -1,7 +1,12 @@
 package response
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"math"
+	"strings"
 
 	"github.com/leaktk/leaktk/pkg/logger"
 )
@@ -17,28 +22,132 @@ const (
 	TextResultKind             = "Text"
 )
 
+// Event names in the order they happen for a request
+const (
+	// EventQueued means the request is waiting for a clone worker
+	EventQueued = "queued"
+	// EventCloneStarted means the resource is being cloned or downloaded
+	EventCloneStarted = "clone_started"
+	// EventCloneFinished means the clone is done (even if it failed)
+	EventCloneFinished = "clone_finished"
+	// EventScanStarted means a scan worker has started on the request
+	EventScanStarted = "scan_started"
+	// EventProgress reports how far a backend is through the resource
+	EventProgress = "progress"
+	// EventCompleted means the response is about to be sent
+	EventCompleted = "completed"
+)
+
+// Verification statuses for results. An empty status means verification
+// wasn't requested.
+const (
+	// VerificationValid means the secret was confirmed to be live
+	VerificationValid = "valid"
+	// VerificationInvalid means the secret was rejected by the service
+	VerificationInvalid = "invalid"
+	// VerificationUnknown means there was no verifier for the result or the
+	// service's response didn't match the valid or invalid conditions
+	VerificationUnknown = "unknown"
+	// VerificationError means the verifier couldn't complete the check
+	VerificationError = "error"
+)
+
 type (
 	// Response from the scanner with the scan results
 	Response struct {
-		ID        string         `json:"id" toml:"id" yaml:"id"`
-		Logs      []logger.Entry `json:"logs" toml:"logs" yaml:"logs"`
-		RequestID string         `json:"request_id" toml:"request_id" yaml:"request_id"`
-		Results   []*Result      `json:"results" toml:"results" yaml:"results"`
+		ID         string         `json:"id" toml:"id" yaml:"id"`
+		Logs       []logger.Entry `json:"logs" toml:"logs" yaml:"logs"`
+		RequestID  string         `json:"request_id" toml:"request_id" yaml:"request_id"`
+		Results    []*Result      `json:"results" toml:"results" yaml:"results"`
+		Suppressed int            `json:"suppressed" toml:"suppressed" yaml:"suppressed"`
+		Baselined  int            `json:"baselined" toml:"baselined" yaml:"baselined"`
+		Scanner    *ScannerInfo   `json:"scanner,omitempty" toml:"scanner,omitempty" yaml:"scanner,omitempty"`
+		// Sequence orders the responses for a streamed request starting at 1
+		Sequence int `json:"sequence,omitempty" toml:"sequence,omitempty" yaml:"sequence,omitempty"`
+		// Partial is true for the chunks of results for a streamed request.
+		// The summary response after the last chunk doesn't set it.
+		Partial bool `json:"partial,omitempty" toml:"partial,omitempty" yaml:"partial,omitempty"`
+		// Streamed is how many results were sent in chunks before the summary
+		Streamed int `json:"streamed,omitempty" toml:"streamed,omitempty" yaml:"streamed,omitempty"`
+		// Status is success, partial, failed or rejected. It's left out of
+		// the chunks for a streamed request.
+		Status string `json:"status,omitempty" toml:"status,omitempty" yaml:"status,omitempty"`
+		// Errors are the problems that kept the request from being fully
+		// scanned
+		Errors []LeakTKError `json:"errors,omitempty" toml:"errors,omitempty" yaml:"errors,omitempty"`
+	}
+
+	// Event is a lifecycle or progress update for a request. Events have the
+	// type "event" so they can be told apart from responses.
+	Event struct {
+		Type      string `json:"type" toml:"type" yaml:"type"`
+		Event     string `json:"event" toml:"event" yaml:"event"`
+		Time      string `json:"time" toml:"time" yaml:"time"`
+		RequestID string `json:"request_id" toml:"request_id" yaml:"request_id"`
+		// Backend is set for progress events
+		Backend string `json:"backend,omitempty" toml:"backend,omitempty" yaml:"backend,omitempty"`
+		// Files is how many files the backend has processed when it's known
+		Files int `json:"files,omitempty" toml:"files,omitempty" yaml:"files,omitempty"`
+		// Commits is how many commits the backend has processed when it's
+		// scanning git history
+		Commits int `json:"commits,omitempty" toml:"commits,omitempty" yaml:"commits,omitempty"`
+		// Results is set for completed events
+		Results int `json:"results,omitempty" toml:"results,omitempty" yaml:"results,omitempty"`
+	}
+
+	// ScannerInfo describes what produced the response so changes in the
+	// results can be traced back to changes in the scanner or its patterns
+	ScannerInfo struct {
+		Version  string        `json:"version" toml:"version" yaml:"version"`
+		Backends []string      `json:"backends" toml:"backends" yaml:"backends"`
+		Patterns *PatternsInfo `json:"patterns,omitempty" toml:"patterns,omitempty" yaml:"patterns,omitempty"`
+		Timing   Timing        `json:"timing" toml:"timing" yaml:"timing"`
+	}
+
+	// PatternsInfo identifies the gitleaks patterns used for the scan
+	PatternsInfo struct {
+		URL             string `json:"url" toml:"url" yaml:"url"`
+		GitleaksVersion string `json:"gitleaks_version" toml:"gitleaks_version" yaml:"gitleaks_version"`
+		Hash            string `json:"hash" toml:"hash" yaml:"hash"`
+		// Sources are in the order they're layered starting with the server
+		Sources []PatternSourceInfo `json:"sources" toml:"sources" yaml:"sources"`
+	}
+
+	// PatternSourceInfo identifies one of the sources merged into the
+	// patterns. Hash is empty (all zeros) if nothing from it was merged.
+	PatternSourceInfo struct {
+		Name string `json:"name" toml:"name" yaml:"name"`
+		Kind string `json:"kind" toml:"kind" yaml:"kind"`
+		URL  string `json:"url,omitempty" toml:"url,omitempty" yaml:"url,omitempty"`
+		Path string `json:"path" toml:"path" yaml:"path"`
+		Hash string `json:"hash" toml:"hash" yaml:"hash"`
+	}
+
+	// Timing is how long the request spent in each stage in milliseconds.
+	// Queued covers the time waiting in both the clone and scan queues.
+	Timing struct {
+		QueuedMS int64 `json:"queued_ms" toml:"queued_ms" yaml:"queued_ms"`
+		CloneMS  int64 `json:"clone_ms" toml:"clone_ms" yaml:"clone_ms"`
+		ScanMS   int64 `json:"scan_ms" toml:"scan_ms" yaml:"scan_ms"`
 	}
 
 	// Result of a scan
 	Result struct {
-		ID       string            `json:"id" toml:"id" yaml:"id"`
-		Kind     string            `json:"kind" toml:"kind" yaml:"kind"`
-		Secret   string            `json:"secret" toml:"secret" yaml:"secret"`
-		Match    string            `json:"match" toml:"match" yaml:"match"`
-		Context  string            `json:"context" toml:"context" yaml:"context"`
-		Entropy  float32           `json:"entropy" toml:"entropy" yaml:"entropy"`
-		Date     string            `json:"date" toml:"date" yaml:"date"`
-		Rule     Rule              `json:"rule" toml:"rule" yaml:"rule"`
-		Contact  Contact           `json:"contact" toml:"contact" yaml:"contact"`
-		Location Location          `json:"location" toml:"location" yaml:"location"`
-		Notes    map[string]string `json:"notes" toml:"notes" yaml:"notes"`
+		ID           string            `json:"id" toml:"id" yaml:"id"`
+		Fingerprint  string            `json:"fingerprint" toml:"fingerprint" yaml:"fingerprint"`
+		Kind         string            `json:"kind" toml:"kind" yaml:"kind"`
+		Secret       string            `json:"secret" toml:"secret" yaml:"secret"`
+		SecretHash   string            `json:"secret_hash" toml:"secret_hash" yaml:"secret_hash"`
+		Match        string            `json:"match" toml:"match" yaml:"match"`
+		Context      string            `json:"context" toml:"context" yaml:"context"`
+		Entropy      float32           `json:"entropy" toml:"entropy" yaml:"entropy"`
+		Date         string            `json:"date" toml:"date" yaml:"date"`
+		Rule         Rule              `json:"rule" toml:"rule" yaml:"rule"`
+		RuleFilter   string            `json:"rule_filter" toml:"rule_filter" yaml:"rule_filter"`
+		Contact      Contact           `json:"contact" toml:"contact" yaml:"contact"`
+		Location     Location          `json:"location" toml:"location" yaml:"location"`
+		Notes        map[string]string `json:"notes" toml:"notes" yaml:"notes"`
+		Verification string            `json:"verification" toml:"verification" yaml:"verification"`
 	}
 
 	// Location in the specific resource being scanned
@@ -82,3 +191,54 @@ func (r *Response) String() string {
 
 	return string(out)
 }
+
+// String renders an event to the JSON format
+func (e *Event) String() string {
+	out, err := json.Marshal(e)
+	if err != nil {
+		logger.Error("could not marshal event: error=%q", err)
+	}
+
+	return string(out)
+}
+
+// HashSecret returns a hex encoded HMAC-SHA256 of the secret keyed with the
+// salt so that the same secret can be correlated across results without
+// storing the secret itself. If the salt is empty it is a plain SHA-256.
+func HashSecret(salt, secret string) string {
+	if len(salt) == 0 {
+		hash := sha256.Sum256([]byte(secret))
+		return hex.EncodeToString(hash[:])
+	}
+
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Redact masks the secret in the result's Secret, Match and Context fields.
+// A percent of 0 leaves the result alone, 100 fully redacts the secret and
+// anything in between keeps that percent of the secret hidden.
+func (r *Result) Redact(percent uint) {
+	if percent == 0 || len(r.Secret) == 0 {
+		return
+	}
+
+	masked := maskSecret(r.Secret, percent)
+	r.Match = strings.ReplaceAll(r.Match, r.Secret, masked)
+	r.Context = strings.ReplaceAll(r.Context, r.Secret, masked)
+	r.Secret = masked
+}
+
+// maskSecret follows the same rules as gitleaks' --redact flag
+func maskSecret(secret string, percent uint) string {
+	if percent >= 100 {
+		return "REDACTED"
+	}
+
+	// Count runes so multi-byte characters aren't split
+	runes := []rune(secret)
+	visible := int(math.RoundToEven(float64(len(runes)) * float64(100-percent) / 100))
+
+	return string(runes[:visible]) + "..."
+}
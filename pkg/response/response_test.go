@@ -0,0 +1,59 @@
+package response
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashSecret(t *testing.T) {
+	t.Run("Unsalted", func(t *testing.T) {
+		assert.Equal(t, "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", HashSecret("", "secret"))
+	})
+
+	t.Run("Salted", func(t *testing.T) {
+		assert.NotEqual(t, HashSecret("", "secret"), HashSecret("salt", "secret"))
+		assert.Equal(t, HashSecret("salt", "secret"), HashSecret("salt", "secret"))
+		assert.NotEqual(t, HashSecret("salt", "secret"), HashSecret("other-salt", "secret"))
+	})
+}
+
+func TestResultRedact(t *testing.T) {
+	newResult := func() *Result {
+		return &Result{
+			Secret:  "abcdefghij",
+			Match:   "token=abcdefghij",
+			Context: "export token=abcdefghij # test",
+		}
+	}
+
+	t.Run("None", func(t *testing.T) {
+		result := newResult()
+		result.Redact(0)
+		assert.Equal(t, newResult(), result)
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		result := newResult()
+		result.Redact(70)
+		assert.Equal(t, "abc...", result.Secret)
+		assert.Equal(t, "token=abc...", result.Match)
+		assert.Equal(t, "export token=abc... # test", result.Context)
+	})
+
+	t.Run("PartialMultiByte", func(t *testing.T) {
+		result := &Result{Secret: "пароль1234"}
+		result.Redact(70)
+		assert.Equal(t, "пар...", result.Secret)
+		assert.True(t, utf8.ValidString(result.Secret))
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		result := newResult()
+		result.Redact(100)
+		assert.Equal(t, "REDACTED", result.Secret)
+		assert.Equal(t, "token=REDACTED", result.Match)
+		assert.Equal(t, "export token=REDACTED # test", result.Context)
+	})
+}
@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/fs"
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// diskUsageInterval is how long a measurement of the resource dir is reused
+// since walking it for every request would be slow
+const diskUsageInterval = time.Second
+
+// diskUsage caches the size of a directory and estimates how much the clones
+// that were admitted but haven't finished will add to it
+type diskUsage struct {
+	lock    sync.Mutex
+	bytes   int64
+	checked time.Time
+	// pending counts the clones that were admitted but haven't finished
+	pending int64
+	// clones and cloneBytes are the count and total size of the finished
+	// clones, used to estimate the size of a pending one
+	clones     int64
+	cloneBytes int64
+}
+
+// size returns the size of path, measuring it again if the last measurement
+// is too old
+func (d *diskUsage) size(path string) int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if time.Since(d.checked) < diskUsageInterval {
+		return d.bytes
+	}
+
+	bytes, err := fs.DirSize(path)
+	if err != nil {
+		// Keep using the last measurement rather than blocking every request
+		logger.Warning("could not measure resource dir: path=%q error=%q", path, err)
+	} else {
+		d.bytes = bytes
+	}
+
+	d.checked = time.Now()
+	return d.bytes
+}
+
+// projected returns the size of path plus the estimated size of the pending
+// clones. Each pending clone is counted as the average size of the finished
+// ones.
+func (d *diskUsage) projected(path string) int64 {
+	used := d.size(path)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.clones == 0 {
+		return used
+	}
+
+	return used + d.pending*(d.cloneBytes/d.clones)
+}
+
+// reserve counts a clone that was admitted
+func (d *diskUsage) reserve() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.pending++
+}
+
+// release marks a reserved clone as finished. bytes is how much it wrote,
+// which is added to the cached size so it's counted before the next
+// measurement.
+func (d *diskUsage) release(bytes int64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.pending--
+	if bytes > 0 {
+		d.clones++
+		d.cloneBytes += bytes
+		d.bytes += bytes
+	}
+}
+
+// admit returns an error if queueing the request would go over one of the
+// configured limits
+func (s *Scanner) admit(request *Request) error {
+	settings := request.settings
+
+	if size := request.size(); settings.maxRequestSize > 0 && size > int(settings.maxRequestSize) {
+		return fmt.Errorf("request too large: size=%d max_request_size=%d", size, settings.maxRequestSize)
+	}
+
+	if depth := s.pending.Load(); settings.maxQueueDepth > 0 && depth >= int64(settings.maxQueueDepth) {
+		return fmt.Errorf("queue full: depth=%d max_queue_depth=%d", depth, settings.maxQueueDepth)
+	}
+
+	if settings.maxResourceBytes > 0 {
+		if used := s.diskUsage.projected(s.resourceDir); used >= int64(settings.maxResourceBytes) {
+			return fmt.Errorf("resource disk limit reached: bytes=%d max_resource_bytes=%d", used, settings.maxResourceBytes)
+		}
+	}
+
+	return nil
+}
+
+// MaxRequestSize returns the current max_request_size (0 means no limit)
+func (s *Scanner) MaxRequestSize() uint32 {
+	return s.settings.Load().maxRequestSize
+}
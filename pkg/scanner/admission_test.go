@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/resource"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+func TestScannerAdmission(t *testing.T) {
+	t.Run("MaxQueueDepth", func(t *testing.T) {
+		backend := newMockCountingBackend()
+		scanner := newTestScanner(t, nil, backend)
+		updateSettings(scanner, func(settings *settings) { settings.maxQueueDepth = 1 })
+
+		var wg sync.WaitGroup
+		go scanner.Recv(func(response *response.Response) {
+			wg.Done()
+		})
+
+		wg.Add(1)
+		assert.NoError(t, scanner.Send(&Request{ID: "first", Resource: &mockResource{}}))
+		assert.ErrorContains(t, scanner.Send(&Request{ID: "second", Resource: &mockResource{}}), "queue full")
+
+		close(backend.release)
+		wg.Wait()
+
+		// There's room again once the first response is sent
+		wg.Add(1)
+		assert.NoError(t, scanner.Send(&Request{ID: "third", Resource: &mockResource{}}))
+		wg.Wait()
+	})
+
+	t.Run("MaxRequestSize", func(t *testing.T) {
+		scanner := newTestScanner(t, nil, newMockCountingBackend())
+		updateSettings(scanner, func(settings *settings) { settings.maxRequestSize = 8 })
+
+		err := scanner.Send(&Request{ID: "large", Resource: resource.NewText("too much text", &resource.TextOptions{})})
+		assert.ErrorContains(t, err, "request too large")
+	})
+
+	t.Run("MaxResourceBytes", func(t *testing.T) {
+		scanner := newTestScanner(t, nil, newMockCountingBackend())
+		updateSettings(scanner, func(settings *settings) { settings.maxResourceBytes = 4 })
+
+		leftover := filepath.Join(scanner.resourceDir, "leftover")
+		assert.NoError(t, os.MkdirAll(leftover, 0700))
+		assert.NoError(t, os.WriteFile(filepath.Join(leftover, "file"), []byte("12345"), 0600))
+
+		err := scanner.Send(&Request{ID: "full", Resource: &mockResource{}})
+		assert.ErrorContains(t, err, "resource disk limit reached")
+	})
+
+	t.Run("PendingClones", func(t *testing.T) {
+		scanner := newTestScanner(t, nil, newMockCountingBackend())
+		updateSettings(scanner, func(settings *settings) { settings.maxResourceBytes = 10 })
+
+		// A finished 6 byte clone makes the estimate 6 bytes per clone
+		scanner.diskUsage.reserve()
+		scanner.diskUsage.release(6)
+		assert.NoError(t, scanner.admit(&Request{ID: "first", Resource: &mockResource{}, settings: scanner.settings.Load()}))
+
+		// Two clones that were admitted but haven't written anything yet
+		scanner.diskUsage.reserve()
+		scanner.diskUsage.reserve()
+		err := scanner.admit(&Request{ID: "full", Resource: &mockResource{}, settings: scanner.settings.Load()})
+		assert.ErrorContains(t, err, "resource disk limit reached")
+	})
+}
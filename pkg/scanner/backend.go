@@ -1,12 +1,31 @@
 package scanner
 
 import (
+	"context"
+	"errors"
+
 	"github.com/leaktk/leaktk/pkg/resource"
 	"github.com/leaktk/leaktk/pkg/response"
 )
 
+// ErrPatternsUnavailable is wrapped by backends when they can't load the
+// patterns they need to scan
+var ErrPatternsUnavailable = errors.New("patterns unavailable")
+
 // Backend is an interface for a scanner backend leveraged by leaktk
 type Backend interface {
 	Name() string
-	Scan(resource resource.Resource) ([]*response.Result, error)
+	Scan(resource resource.Resource, options *RequestOptions) ([]*response.Result, error)
+}
+
+// scanErrorCode returns the response error code for an error from a backend
+func scanErrorCode(err error) response.ErrorCode {
+	switch {
+	case errors.Is(err, ErrPatternsUnavailable):
+		return response.PatternsUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return response.TimeoutError
+	default:
+		return response.ScanError
+	}
 }
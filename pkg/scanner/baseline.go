@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// Baseline holds a set of known results that should not be reported again
+type Baseline struct {
+	keys map[string]struct{}
+}
+
+// BaselineDiff breaks down the changes between two sets of results
+type BaselineDiff struct {
+	New       []*response.Result `json:"new"`
+	Fixed     []*response.Result `json:"fixed"`
+	Unchanged []*response.Result `json:"unchanged"`
+}
+
+// NewBaseline returns a baseline containing the results
+func NewBaseline(results []*response.Result) *Baseline {
+	baseline := &Baseline{
+		keys: make(map[string]struct{}, len(results)),
+	}
+
+	for _, result := range results {
+		baseline.keys[baselineKey(result)] = struct{}{}
+	}
+
+	return baseline
+}
+
+// LoadBaseline reads a baseline from a results file
+func LoadBaseline(path string) (*Baseline, error) {
+	results, err := ReadResultsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBaseline(results), nil
+}
+
+// ReadResultsFile reads the results out of a file containing one or more
+// JSON formatted responses (e.g. the output of scan or listen)
+func ReadResultsFile(path string) ([]*response.Result, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("could not open results file: path=%q error=%q", path, err)
+	}
+	defer file.Close()
+
+	results := make([]*response.Result, 0)
+	decoder := json.NewDecoder(file)
+
+	for {
+		var resp response.Response
+
+		if err := decoder.Decode(&resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, fmt.Errorf("could not decode results file: path=%q error=%q", path, err)
+		}
+
+		results = append(results, resp.Results...)
+	}
+
+	return results, nil
+}
+
+// Contains returns true if the result is in the baseline
+func (b *Baseline) Contains(result *response.Result) bool {
+	_, ok := b.keys[baselineKey(result)]
+	return ok
+}
+
+// Filter returns the results that aren't in the baseline and how many
+// results were removed
+func (b *Baseline) Filter(results []*response.Result) ([]*response.Result, int) {
+	filtered := make([]*response.Result, 0, len(results))
+
+	for _, result := range results {
+		if !b.Contains(result) {
+			filtered = append(filtered, result)
+		}
+	}
+
+	return filtered, len(results) - len(filtered)
+}
+
+// DiffResults compares the current results against the previous results
+func DiffResults(previous, current []*response.Result) *BaselineDiff {
+	diff := &BaselineDiff{
+		New:       make([]*response.Result, 0),
+		Fixed:     make([]*response.Result, 0),
+		Unchanged: make([]*response.Result, 0),
+	}
+
+	previousBaseline := NewBaseline(previous)
+	for _, result := range current {
+		if previousBaseline.Contains(result) {
+			diff.Unchanged = append(diff.Unchanged, result)
+		} else {
+			diff.New = append(diff.New, result)
+		}
+	}
+
+	currentBaseline := NewBaseline(current)
+	for _, result := range previous {
+		if !currentBaseline.Contains(result) {
+			diff.Fixed = append(diff.Fixed, result)
+		}
+	}
+
+	return diff
+}
+
+// baselineKey prefers the fingerprint but falls back on the result ID for
+// results generated before fingerprints existed
+func baselineKey(result *response.Result) string {
+	if len(result.Fingerprint) > 0 {
+		return result.Fingerprint
+	}
+
+	return result.ID
+}
+
+// WriteBaseline saves the response to a file that can be loaded with
+// LoadBaseline
+func WriteBaseline(path string, resp *response.Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("could not marshal baseline: error=%q", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create baseline dir: error=%q", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("could not write baseline: path=%q error=%q", path, err)
+	}
+
+	return nil
+}
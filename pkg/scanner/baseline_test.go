@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+func TestBaseline(t *testing.T) {
+	resultA := &response.Result{ID: "a", Fingerprint: "fp-a"}
+	resultB := &response.Result{ID: "b", Fingerprint: "fp-b"}
+	resultC := &response.Result{ID: "c", Fingerprint: "fp-c"}
+	// Results from before fingerprints existed fall back on the ID
+	resultD := &response.Result{ID: "d"}
+
+	t.Run("Filter", func(t *testing.T) {
+		baseline := NewBaseline([]*response.Result{resultA, resultD})
+		filtered, removed := baseline.Filter([]*response.Result{resultA, resultB, resultD})
+		assert.Equal(t, []*response.Result{resultB}, filtered)
+		assert.Equal(t, 2, removed)
+	})
+
+	t.Run("WriteAndLoad", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "baseline.json")
+		err := WriteBaseline(path, &response.Response{
+			ID:      "response",
+			Results: []*response.Result{resultA, resultB},
+		})
+		assert.NoError(t, err)
+
+		baseline, err := LoadBaseline(path)
+		assert.NoError(t, err)
+		assert.True(t, baseline.Contains(resultA))
+		assert.True(t, baseline.Contains(resultB))
+		assert.False(t, baseline.Contains(resultC))
+	})
+
+	t.Run("ReadResultsFileJSONL", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.jsonl")
+		data := `{"id": "1", "results": [{"id": "a", "fingerprint": "fp-a"}]}
+{"id": "2", "results": [{"id": "b", "fingerprint": "fp-b"}]}
+`
+		assert.NoError(t, os.WriteFile(path, []byte(data), 0600))
+
+		results, err := ReadResultsFile(path)
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		assert.Equal(t, "fp-b", results[1].Fingerprint)
+	})
+
+	t.Run("ReadResultsFileInvalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.json")
+		assert.NoError(t, os.WriteFile(path, []byte("not json"), 0600))
+
+		_, err := ReadResultsFile(path)
+		assert.Error(t, err)
+	})
+
+	t.Run("LoadedOncePerRequest", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "baseline.json")
+		assert.NoError(t, WriteBaseline(path, &response.Response{Results: []*response.Result{resultA}}))
+
+		scanner := &Scanner{}
+		request := &Request{
+			Options:  RequestOptions{Baseline: path},
+			Resource: &mockResource{},
+			settings: &settings{allowLocal: true},
+		}
+
+		results, removed := scanner.applyBaseline(request, []*response.Result{resultA, resultB})
+		assert.Equal(t, []*response.Result{resultB}, results)
+		assert.Equal(t, 1, removed)
+
+		// Later chunks of a streamed request reuse the loaded baseline
+		assert.NoError(t, os.Remove(path))
+		results, removed = scanner.applyBaseline(request, []*response.Result{resultA, resultC})
+		assert.Equal(t, []*response.Result{resultC}, results)
+		assert.Equal(t, 1, removed)
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+		diff := DiffResults(
+			[]*response.Result{resultA, resultB},
+			[]*response.Result{resultB, resultC},
+		)
+		assert.Equal(t, []*response.Result{resultC}, diff.New)
+		assert.Equal(t, []*response.Result{resultA}, diff.Fixed)
+		assert.Equal(t, []*response.Result{resultB}, diff.Unchanged)
+	})
+}
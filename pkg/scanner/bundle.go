@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/fs"
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// patternBundleVersion should only change for breaking format changes
+const patternBundleVersion = 1
+
+// PatternBundle holds the cached patterns from every url source so they can
+// be moved to scanners that can't fetch patterns themselves
+type PatternBundle struct {
+	Version         int                   `json:"version"`
+	CreatedAt       time.Time             `json:"created_at"`
+	GitleaksVersion string                `json:"gitleaks_version"`
+	Sources         []PatternBundleSource `json:"sources"`
+}
+
+// PatternBundleSource is the cached patterns for one source
+type PatternBundleSource struct {
+	Name         string    `json:"name"`
+	URL          string    `json:"url"`
+	Config       string    `json:"config"`
+	Signature    string    `json:"signature,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// ExportBundle loads the patterns (fetching them if needed) and writes the
+// cached patterns for each url source as a bundle
+func (p *Patterns) ExportBundle(w io.Writer) error {
+	if _, err := p.Gitleaks(); err != nil {
+		return fmt.Errorf("could not load patterns: error=%q", err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	bundle := PatternBundle{
+		Version:         patternBundleVersion,
+		CreatedAt:       time.Now().UTC(),
+		GitleaksVersion: p.config.Gitleaks.Version,
+	}
+
+	for _, source := range p.sources {
+		if source.kind != patternSourceURL {
+			continue
+		}
+
+		rawConfig, err := os.ReadFile(source.path)
+		if err != nil {
+			return fmt.Errorf("could not read cached patterns: source=%q error=%q", source.name, err)
+		}
+
+		bundleSource := PatternBundleSource{
+			Name:   source.name,
+			URL:    source.url,
+			Config: string(rawConfig),
+		}
+
+		if signature, err := os.ReadFile(source.path + signatureExt); err == nil {
+			bundleSource.Signature = string(signature)
+		}
+
+		if metadata := readPatternMetadata(source.path); metadata != nil {
+			bundleSource.ETag = metadata.ETag
+			bundleSource.LastModified = metadata.LastModified
+			bundleSource.FetchedAt = metadata.FetchedAt
+		}
+
+		bundle.Sources = append(bundle.Sources, bundleSource)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(bundle)
+}
+
+// ImportBundle validates a bundle and replaces the cached patterns for the
+// url sources with the same names. Signatures are checked the same way as
+// fetched patterns and nothing is written unless every source is valid.
+func (p *Patterns) ImportBundle(r io.Reader) (int, error) {
+	var bundle PatternBundle
+
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return 0, fmt.Errorf("could not decode pattern bundle: error=%q", err)
+	}
+
+	if bundle.Version != patternBundleVersion {
+		return 0, fmt.Errorf("unsupported pattern bundle version: version=%d", bundle.Version)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.configErr != nil {
+		return 0, p.configErr
+	}
+
+	type bundleImport struct {
+		source       *patternSource
+		bundleSource PatternBundleSource
+	}
+
+	var imports []bundleImport
+	for _, bundleSource := range bundle.Sources {
+		source := p.urlSource(bundleSource.Name)
+		if source == nil {
+			logger.Warning("skipping unknown pattern source in bundle: source=%q", bundleSource.Name)
+			continue
+		}
+
+		// The server's patterns are specific to a gitleaks version
+		if source.name == "server" && bundle.GitleaksVersion != p.config.Gitleaks.Version {
+			return 0, fmt.Errorf(
+				"pattern bundle is for a different gitleaks version: bundle_version=%q config_version=%q",
+				bundle.GitleaksVersion, p.config.Gitleaks.Version,
+			)
+		}
+
+		if source.verifier != nil {
+			if err := source.verifier.Verify([]byte(bundleSource.Config), []byte(bundleSource.Signature)); err != nil {
+				return 0, fmt.Errorf("could not verify bundled patterns: source=%q error=%q", source.name, err)
+			}
+		}
+
+		if _, err := ParseGitleaksConfig(bundleSource.Config); err != nil {
+			return 0, fmt.Errorf("could not parse bundled patterns: source=%q error=%q", source.name, err)
+		}
+
+		imports = append(imports, bundleImport{source, bundleSource})
+	}
+
+	if len(imports) == 0 {
+		return 0, errors.New("pattern bundle has no sources for this config")
+	}
+
+	for _, item := range imports {
+		if err := item.source.writeCache(item.bundleSource); err != nil {
+			return 0, err
+		}
+
+		// Force the source to reload from the new cache
+		item.source.layers = nil
+		logger.Info("imported patterns: source=%q", item.source.name)
+	}
+
+	return len(imports), nil
+}
+
+// urlSource returns the url source with this name if there is one
+func (p *Patterns) urlSource(name string) *patternSource {
+	for _, source := range p.sources {
+		if source.kind == patternSourceURL && source.name == name {
+			return source
+		}
+	}
+
+	return nil
+}
+
+// writeCache replaces the source's cache with the bundled patterns
+func (s *patternSource) writeCache(bundleSource PatternBundleSource) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("could not create config dir: error=%q", err)
+	}
+
+	signaturePath := s.path + signatureExt
+	if len(bundleSource.Signature) > 0 {
+		if err := os.WriteFile(signaturePath, []byte(bundleSource.Signature), 0600); err != nil {
+			return fmt.Errorf("could not write signature: path=%q error=%q", signaturePath, err)
+		}
+	} else if fs.FileExists(signaturePath) {
+		// Don't leave a signature for different patterns behind
+		if err := os.Remove(signaturePath); err != nil {
+			return fmt.Errorf("could not remove signature: path=%q error=%q", signaturePath, err)
+		}
+	}
+
+	if err := os.WriteFile(s.path, []byte(bundleSource.Config), 0600); err != nil {
+		return fmt.Errorf("could not write config: path=%q error=%q", s.path, err)
+	}
+
+	writePatternMetadata(s.path, &patternMetadata{
+		URL:          bundleSource.URL,
+		ETag:         bundleSource.ETag,
+		LastModified: bundleSource.LastModified,
+		FetchedAt:    bundleSource.FetchedAt,
+		CheckedAt:    time.Now().UTC(),
+	})
+
+	return nil
+}
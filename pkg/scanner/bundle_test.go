@@ -0,0 +1,153 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	httpclient "github.com/leaktk/leaktk/pkg/http"
+)
+
+func TestPatternsConditionalFetch(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = io.WriteString(w, mockConfig)
+	}))
+	defer ts.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Patterns.Server.URL = ts.URL
+	cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(t.TempDir(), "gitleaks.toml")
+	cfg.Scanner.Patterns.RefreshAfter = 5
+	configPath := cfg.Scanner.Patterns.Gitleaks.ConfigPath
+
+	patterns := NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient())
+	gitleaksConfig, err := patterns.Gitleaks()
+	assert.NoError(t, err)
+
+	metadata := readPatternMetadata(configPath)
+	assert.NotNil(t, metadata)
+	assert.Equal(t, `"v1"`, metadata.ETag)
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", metadata.LastModified)
+	assert.False(t, metadata.FetchedAt.IsZero())
+
+	// Make the cache stale so the next call checks the server again
+	staleTime := time.Now().Add(-time.Minute)
+	assert.NoError(t, os.Chtimes(configPath, staleTime, staleTime))
+
+	unchanged, err := patterns.Gitleaks()
+	assert.NoError(t, err)
+	assert.Same(t, gitleaksConfig, unchanged)
+	assert.Equal(t, 2, requests)
+	assert.False(t, modTimeExceeds(configPath, 5))
+
+	// A fresh scanner can use the cache after a 304 too
+	assert.NoError(t, os.Chtimes(configPath, staleTime, staleTime))
+	_, err = NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient()).Gitleaks()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, requests)
+}
+
+func TestPatternBundles(t *testing.T) {
+	publicKey, sign := minisignKeyPair(t, "Ed")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/patterns/gitleaks/x.y.z":
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = io.WriteString(w, mockConfig)
+		case "/patterns/gitleaks/x.y.z.sig":
+			_, _ = w.Write(sign([]byte(mockConfig)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	newConfig := func(t *testing.T) *config.Config {
+		cfg := config.DefaultConfig()
+		cfg.Scanner.Patterns.Server.URL = ts.URL
+		cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
+		cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(t.TempDir(), "gitleaks.toml")
+		cfg.Scanner.Patterns.TrustedKeys = []string{publicKey}
+		return cfg
+	}
+
+	var bundle bytes.Buffer
+	exportCfg := newConfig(t)
+	assert.NoError(t, NewPatterns(&exportCfg.Scanner.Patterns, httpclient.NewClient()).ExportBundle(&bundle))
+
+	var decoded PatternBundle
+	assert.NoError(t, json.Unmarshal(bundle.Bytes(), &decoded))
+	assert.Equal(t, patternBundleVersion, decoded.Version)
+	assert.Equal(t, "x.y.z", decoded.GitleaksVersion)
+	assert.Len(t, decoded.Sources, 1)
+	assert.Equal(t, "server", decoded.Sources[0].Name)
+	assert.Equal(t, `"v1"`, decoded.Sources[0].ETag)
+	assert.NotEmpty(t, decoded.Sources[0].Signature)
+
+	t.Run("Import", func(t *testing.T) {
+		// An air-gapped scanner can't reach the server
+		cfg := newConfig(t)
+		cfg.Scanner.Patterns.Autofetch = false
+		cfg.Scanner.Patterns.Server.URL = "http://127.0.0.1:0"
+
+		patterns := NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient())
+		_, err := patterns.Gitleaks()
+		assert.Error(t, err)
+
+		imported, err := patterns.ImportBundle(bytes.NewReader(bundle.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, imported)
+
+		gitleaksConfig, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+		assert.Contains(t, gitleaksConfig.Rules, "test-rule")
+		assert.Equal(t, "9c88490b8b230ef6cf0d25b23a63679557cbe8cca1cc6703e55ca9d52331d0a9", patterns.GitleaksConfigHash())
+		assert.FileExists(t, cfg.Scanner.Patterns.Gitleaks.ConfigPath+".sig")
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := decoded
+		tampered.Sources = []PatternBundleSource{decoded.Sources[0]}
+		tampered.Sources[0].Config = mockAllowlistOnlyConfig
+		data, err := json.Marshal(tampered)
+		assert.NoError(t, err)
+
+		cfg := newConfig(t)
+		_, err = NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient()).ImportBundle(bytes.NewReader(data))
+		assert.ErrorContains(t, err, "could not verify bundled patterns")
+		assert.NoFileExists(t, cfg.Scanner.Patterns.Gitleaks.ConfigPath)
+	})
+
+	t.Run("WrongGitleaksVersion", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.Scanner.Patterns.Gitleaks.Version = "1.2.3"
+		_, err := NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient()).ImportBundle(bytes.NewReader(bundle.Bytes()))
+		assert.ErrorContains(t, err, "different gitleaks version")
+	})
+
+	t.Run("UnsupportedVersion", func(t *testing.T) {
+		cfg := newConfig(t)
+		_, err := NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient()).ImportBundle(bytes.NewReader([]byte(`{"version": 99}`)))
+		assert.ErrorContains(t, err, "unsupported pattern bundle version")
+	})
+}
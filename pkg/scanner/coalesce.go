@@ -0,0 +1,190 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/queue"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// coalescer shares one clone and scan between identical requests and keeps
+// recent responses so repeated requests can be answered without a scan
+type coalescer struct {
+	lock sync.Mutex
+	// inFlight maps a request key to the requests waiting on the one that's
+	// being scanned
+	inFlight map[string][]*Request
+	cache    map[string]cachedResponse
+	cacheTTL time.Duration
+}
+
+// cachedResponse is a response that can be reused until it expires
+type cachedResponse struct {
+	response *response.Response
+	expires  time.Time
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{
+		inFlight: make(map[string][]*Request),
+		cache:    make(map[string]cachedResponse),
+	}
+}
+
+// setCacheTTL changes how long responses are kept and clears the cache since
+// the settings the responses were made with may have changed
+func (c *coalescer) setCacheTTL(ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.cacheTTL = ttl
+	clear(c.cache)
+}
+
+// join returns a cached response for the key or adds the request to the
+// requests waiting on the key. If it returns (nil, false) the caller should
+// scan the request and pass its response to done.
+func (c *coalescer) join(key string, request *Request) (*response.Response, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cached, ok := c.cache[key]; ok {
+		if time.Now().Before(cached.expires) {
+			return cached.response, true
+		}
+
+		delete(c.cache, key)
+	}
+
+	if followers, ok := c.inFlight[key]; ok {
+		c.inFlight[key] = append(followers, request)
+		return nil, true
+	}
+
+	c.inFlight[key] = nil
+	return nil, false
+}
+
+// done caches the response if it's cacheable and returns the requests that
+// were waiting on it
+func (c *coalescer) done(key string, resp *response.Response) []*Request {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	followers := c.inFlight[key]
+	delete(c.inFlight, key)
+
+	if c.cacheTTL > 0 && cacheable(resp) {
+		now := time.Now()
+		for cachedKey, cached := range c.cache {
+			if now.After(cached.expires) {
+				delete(c.cache, cachedKey)
+			}
+		}
+
+		c.cache[key] = cachedResponse{response: resp, expires: now.Add(c.cacheTTL)}
+	}
+
+	return followers
+}
+
+// cacheable is false for responses from scans that didn't complete
+func cacheable(resp *response.Response) bool {
+	return resp.Status == response.StatusSuccess
+}
+
+// requestKey identifies requests that would produce the same results or
+// returns an empty string if the request shouldn't be shared. Requests that
+// stream results, send events or scan local resources are never shared. The
+// full resource string is used instead of its identity so that requests with
+// different credentials, tags or digests aren't shared, and the tenant is
+// included so one tenant's results are never sent to another.
+func (s *Scanner) requestKey(request *Request) string {
+	if len(request.optionsKey) == 0 || request.Options.Stream || request.Options.Events || request.Resource.IsLocal() {
+		return ""
+	}
+
+	patternsHash := ""
+	if patterns := request.settings.patterns; patterns != nil {
+		patternsHash = patterns.GitleaksConfigHash()
+	}
+
+	// The baseline option is a path so the key needs what's in it
+	baselineHash := ""
+	if len(request.Options.Baseline) > 0 && request.settings.allowLocal {
+		data, err := os.ReadFile(filepath.Clean(request.Options.Baseline))
+		if err != nil {
+			return ""
+		}
+
+		baselineHash = fmt.Sprintf("%x", sha256.Sum256(data))
+	}
+
+	// This uses sha256 instead of id.ID since a collision would hand one
+	// resource's results to another
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		request.Resource.Kind(),
+		request.Resource.String(),
+		request.Tenant,
+		request.optionsKey,
+		patternsHash,
+		baselineHash,
+	}, "\n")))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// canonicalOptions returns the options as JSON with sorted keys and without
+// the ones that don't change the results
+func canonicalOptions(rawOptions json.RawMessage) (string, error) {
+	options := make(map[string]any)
+	if len(rawOptions) > 0 {
+		if err := json.Unmarshal(rawOptions, &options); err != nil {
+			return "", err
+		}
+	}
+
+	delete(options, "priority")
+
+	out, err := json.Marshal(options)
+	return string(out), err
+}
+
+// sendResponse queues the response for the request and a copy for each
+// request that was waiting on it
+func (s *Scanner) sendResponse(request *Request, priority int, resp *response.Response) {
+	s.pending.Add(-1)
+	s.responseQueue.Send(&queue.Message[*response.Response]{
+		Priority: priority,
+		Value:    resp,
+	})
+
+	if len(request.coalesceKey) == 0 {
+		return
+	}
+
+	for _, follower := range s.coalescer.done(request.coalesceKey, resp) {
+		s.sendSharedResponse(follower, resp)
+	}
+}
+
+// sendSharedResponse queues a copy of a response for another request
+func (s *Scanner) sendSharedResponse(request *Request, resp *response.Response) {
+	shared := *resp
+	shared.ID = id.ID()
+	shared.RequestID = request.ID
+
+	s.responseQueue.Send(&queue.Message[*response.Response]{
+		Priority: request.Priority(),
+		Value:    &shared,
+	})
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// progressInterval limits how often progress events are sent for a backend
+const progressInterval = time.Second
+
+// EventHandler receives the events for requests that ask for them
+type EventHandler func(*response.Event)
+
+// OnEvent sets the function that receives events. It's called from the
+// scanner's workers so it should return quickly.
+func (s *Scanner) OnEvent(fn EventHandler) {
+	s.eventsLock.Lock()
+	defer s.eventsLock.Unlock()
+
+	s.eventHandler = fn
+}
+
+// emit sends an event for the request if it asked for events
+func (s *Scanner) emit(request *Request, event *response.Event) {
+	if !request.Options.Events {
+		return
+	}
+
+	s.eventsLock.RLock()
+	handler := s.eventHandler
+	s.eventsLock.RUnlock()
+
+	if handler == nil {
+		return
+	}
+
+	event.Type = "event"
+	event.Time = time.Now().UTC().Format(time.RFC3339)
+	event.RequestID = request.ID
+	handler(event)
+}
+
+// scanProgress tracks how much of a resource a backend has processed. A nil
+// scanProgress ignores updates so backends don't have to check for it.
+type scanProgress struct {
+	emit    func(files, commits int)
+	files   int
+	commits int
+	last    time.Time
+}
+
+// newScanProgress returns the progress tracker for a backend or nil if the
+// request didn't ask for events
+func (s *Scanner) newScanProgress(request *Request, backend Backend) *scanProgress {
+	if !request.Options.Events {
+		return nil
+	}
+
+	return &scanProgress{
+		emit: func(files, commits int) {
+			s.emit(request, &response.Event{
+				Event:   response.EventProgress,
+				Backend: backend.Name(),
+				Files:   files,
+				Commits: commits,
+			})
+		},
+		last: time.Now(),
+	}
+}
+
+// fileDone counts a processed file and sends a progress event if it's been
+// long enough since the last one
+func (p *scanProgress) fileDone() {
+	if p == nil {
+		return
+	}
+
+	p.files++
+	p.update()
+}
+
+// commitDone counts a processed commit and sends a progress event if it's
+// been long enough since the last one
+func (p *scanProgress) commitDone() {
+	if p == nil {
+		return
+	}
+
+	p.commits++
+	p.update()
+}
+
+// update sends a progress event if it's been long enough since the last one
+func (p *scanProgress) update() {
+	if time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.emit(p.files, p.commits)
+	}
+}
+
+// done sends the final progress event for the backend
+func (p *scanProgress) done() {
+	if p == nil {
+		return
+	}
+
+	p.emit(p.files, p.commits)
+}
@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+func TestScannerEvents(t *testing.T) {
+	scanner := newTestScanner(t, nil, &mockBackend{})
+
+	var eventsLock sync.Mutex
+	events := make(map[string][]*response.Event)
+	scanner.OnEvent(func(event *response.Event) {
+		eventsLock.Lock()
+		defer eventsLock.Unlock()
+
+		events[event.RequestID] = append(events[event.RequestID], event)
+	})
+
+	var wg sync.WaitGroup
+	go scanner.Recv(func(response *response.Response) {
+		wg.Done()
+	})
+
+	wg.Add(2)
+	assert.NoError(t, scanner.Send(&Request{ID: "with-events", Options: RequestOptions{Events: true}, Resource: &mockResource{}}))
+	assert.NoError(t, scanner.Send(&Request{ID: "without-events", Resource: &mockResource{}}))
+	wg.Wait()
+
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+
+	names := make([]string, 0, len(events["with-events"]))
+	for _, event := range events["with-events"] {
+		assert.Equal(t, "event", event.Type)
+		assert.NotEmpty(t, event.Time)
+		names = append(names, event.Event)
+	}
+
+	assert.Equal(t, []string{
+		response.EventQueued,
+		response.EventCloneStarted,
+		response.EventCloneFinished,
+		response.EventScanStarted,
+		response.EventProgress,
+		response.EventCompleted,
+	}, names)
+
+	assert.Equal(t, "mock", events["with-events"][4].Backend)
+	assert.Equal(t, 1, events["with-events"][5].Results)
+	assert.Empty(t, events["without-events"])
+}
+
+func TestScanProgress(t *testing.T) {
+	// A nil tracker ignores updates
+	var progress *scanProgress
+	progress.fileDone()
+	progress.commitDone()
+	progress.done()
+
+	var reported [][2]int
+	progress = &scanProgress{emit: func(files, commits int) { reported = append(reported, [2]int{files, commits}) }}
+	progress.commitDone()
+	progress.fileDone()
+	progress.fileDone()
+	progress.done()
+
+	// The first update is sent since the last one was never, and the final
+	// count is always sent
+	assert.Equal(t, [][2]int{{0, 1}, {2, 1}}, reported)
+}
@@ -0,0 +1,336 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/resource"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+const (
+	// externalProtocolVersion is sent to plugins in the start message and
+	// should only change for breaking protocol changes
+	externalProtocolVersion = 1
+	defaultExternalTimeout  = 10 * time.Minute
+	// externalStderrLimit is how much plugin stderr is kept for error messages
+	externalStderrLimit = 4096
+	// externalWaitDelay is how long to wait for the plugin's pipes to close
+	// after it has been killed
+	externalWaitDelay = 5 * time.Second
+)
+
+// externalInput is a message sent from leaktk to the plugin's stdin
+type externalInput struct {
+	Type     string `json:"type"`
+	Protocol int    `json:"protocol,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Resource string `json:"resource,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// externalOutput is a message read from the plugin's stdout
+type externalOutput struct {
+	Type string `json:"type"`
+
+	// Set on "finding" messages
+	Path    string            `json:"path"`
+	Rule    response.Rule     `json:"rule"`
+	Secret  string            `json:"secret"`
+	Match   string            `json:"match"`
+	Context string            `json:"context"`
+	Start   response.Point    `json:"start"`
+	End     response.Point    `json:"end"`
+	Notes   map[string]string `json:"notes"`
+
+	// Set on "log" messages
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// External is a scanner backend that runs a separate executable and talks to
+// it over the JSONL protocol described in docs/external-backends.md
+type External struct {
+	name    string
+	path    string
+	args    []string
+	env     []string
+	timeout time.Duration
+}
+
+// NewExternal returns a configured external backend instance
+func NewExternal(name string, cfg config.ExternalBackend) (*External, error) {
+	if len(cfg.Path) == 0 {
+		return nil, errors.New("external backend path is required")
+	}
+
+	path, err := exec.LookPath(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not find external backend executable: path=%q error=%q", cfg.Path, err)
+	}
+
+	if len(name) == 0 {
+		name = cfg.Path
+	}
+
+	external := &External{
+		name:    name,
+		path:    path,
+		args:    cfg.Args,
+		env:     os.Environ(),
+		timeout: time.Duration(cfg.Timeout) * time.Second,
+	}
+
+	for key, value := range cfg.Env {
+		external.env = append(external.env, key+"="+value)
+	}
+
+	if external.timeout == 0 {
+		external.timeout = defaultExternalTimeout
+	}
+
+	return external, nil
+}
+
+// Name returns the human readable name of the backend for logging details
+func (e *External) Name() string {
+	return fmt.Sprintf("External(%s)", e.name)
+}
+
+// Scan starts the plugin, streams the resource's files to it and collects the
+// findings it reports. Any findings read before a crash or timeout are
+// returned along with the error.
+func (e *External) Scan(scanResource resource.Resource, options *RequestOptions) ([]*response.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, e.path, e.args...)
+	cmd.Env = e.env
+	cmd.WaitDelay = externalWaitDelay
+
+	stderr := &limitedBuffer{limit: externalStderrLimit}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start external backend: name=%q error=%q", e.name, err)
+	}
+
+	var writeErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer stdin.Close()
+		writeErr = e.writeResource(stdin, scanResource, options.progress)
+	}()
+
+	results := e.readResults(stdout, scanResource, options)
+	wg.Wait()
+	waitErr := cmd.Wait()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return results, fmt.Errorf("external backend timed out: name=%q timeout=%q", e.name, e.timeout)
+	}
+
+	if waitErr != nil {
+		return results, fmt.Errorf("external backend failed: name=%q error=%q stderr=%q", e.name, waitErr, stderr.String())
+	}
+
+	if writeErr != nil {
+		return results, fmt.Errorf("could not send resource to external backend: name=%q error=%q", e.name, writeErr)
+	}
+
+	return results, nil
+}
+
+// writeResource sends the start message, each text file and the end message
+func (e *External) writeResource(w io.Writer, scanResource resource.Resource, progress *scanProgress) error {
+	encoder := json.NewEncoder(w)
+
+	err := encoder.Encode(externalInput{
+		Type:     "start",
+		Protocol: externalProtocolVersion,
+		Kind:     scanResource.Kind(),
+		Resource: scanResource.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = scanResource.Walk(func(path string, reader io.Reader) error {
+		progress.fileDone()
+		bufReader := bufio.NewReader(reader)
+
+		binary, err := isBinary(bufReader)
+		if err != nil {
+			scanResource.Error(logger.ScanError, "could not read file", logger.String("path", path), logger.Err(err))
+			return nil
+		}
+
+		if binary {
+			scanResource.Debug(logger.ScanDetail, "skipping binary file", logger.String("path", path))
+			return nil
+		}
+
+		content, err := io.ReadAll(bufReader)
+		if err != nil {
+			scanResource.Error(logger.ScanError, "could not read file", logger.String("path", path), logger.Err(err))
+			return nil
+		}
+
+		// Returning the error stops the walk since the plugin can't take
+		// any more input. Invalid UTF-8 in the content is replaced with
+		// U+FFFD when it's encoded.
+		return encoder.Encode(externalInput{
+			Type:    "file",
+			Path:    path,
+			Content: string(content),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return encoder.Encode(externalInput{Type: "end"})
+}
+
+// readResults reads messages from the plugin until its stdout closes
+func (e *External) readResults(r io.Reader, scanResource resource.Resource, options *RequestOptions) []*response.Result {
+	results := make([]*response.Result, 0)
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var msg externalOutput
+
+			if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+				scanResource.Error(logger.ScanError, "invalid external backend message", logger.String("name", e.name), logger.Err(jsonErr))
+			} else {
+				switch msg.Type {
+				case "finding":
+					// The plugin doesn't know about the filter so it's applied here
+					if options.Match(msg.Rule.ID, msg.Rule.Tags) {
+						results = options.collect(results, scanResource.EnrichResult(e.newResult(scanResource, &msg)))
+					}
+				case "log":
+					e.log(scanResource, &msg)
+				default:
+					scanResource.Warning(logger.ScanDetail, "unsupported external backend message", logger.String("name", e.name), logger.String("type", msg.Type))
+				}
+			}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				scanResource.Error(logger.ScanError, "could not read from external backend", logger.String("name", e.name), logger.Err(err))
+			}
+
+			// Drain anything left so the plugin doesn't block on a full pipe
+			_, _ = io.Copy(io.Discard, reader)
+			return results
+		}
+	}
+}
+
+// log forwards a plugin log message to the resource's logs
+func (e *External) log(scanResource resource.Resource, msg *externalOutput) {
+	switch strings.ToUpper(msg.Level) {
+	case "CRITICAL", "ERROR":
+		scanResource.Error(logger.ScanError, "external backend", logger.String("name", e.name), logger.String("message", msg.Message))
+	case "WARN", "WARNING":
+		scanResource.Warning(logger.ScanDetail, "external backend", logger.String("name", e.name), logger.String("message", msg.Message))
+	case "DEBUG":
+		scanResource.Debug(logger.ScanDetail, "external backend", logger.String("name", e.name), logger.String("message", msg.Message))
+	default:
+		scanResource.Info(logger.ScanDetail, "external backend", logger.String("name", e.name), logger.String("message", msg.Message))
+	}
+}
+
+func (e *External) newResult(scanResource resource.Resource, msg *externalOutput) *response.Result {
+	if msg.Notes == nil {
+		msg.Notes = map[string]string{}
+	}
+
+	if msg.Rule.Tags == nil {
+		msg.Rule.Tags = []string{}
+	}
+
+	if len(msg.Match) == 0 {
+		msg.Match = msg.Secret
+	}
+
+	return &response.Result{
+		// Be careful changing how this is generated, this could result in
+		// duplicate alerts
+		ID: id.ID(
+			scanResource.String(),
+			e.name,
+			msg.Path,
+			fmt.Sprint(msg.Start.Line),
+			fmt.Sprint(msg.Start.Column),
+			fmt.Sprint(msg.End.Line),
+			fmt.Sprint(msg.End.Column),
+			msg.Rule.ID,
+		),
+		Secret:  msg.Secret,
+		Match:   msg.Match,
+		Context: msg.Context,
+		Entropy: float32(shannonEntropy(msg.Secret)),
+		Notes:   msg.Notes,
+		Rule:    msg.Rule,
+		Location: response.Location{
+			Path:  msg.Path,
+			Start: msg.Start,
+			End:   msg.End,
+		},
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest
+type limitedBuffer struct {
+	mutex sync.Mutex
+	data  []byte
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if remaining := b.limit - len(b.data); remaining > 0 {
+		b.data = append(b.data, p[:min(len(p), remaining)]...)
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return strings.TrimSpace(string(b.data))
+}
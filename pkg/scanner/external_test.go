@@ -0,0 +1,150 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/resource"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// TestExternalPlugin isn't a real test. It's a reference plugin that the
+// other tests run by re-executing the test binary with LEAKTK_TEST_PLUGIN set.
+func TestExternalPlugin(t *testing.T) {
+	mode := os.Getenv("LEAKTK_TEST_PLUGIN")
+	if len(mode) == 0 {
+		t.Skip("only runs as a plugin")
+	}
+
+	// Report "internal tokens" that look like itk_ followed by 16 hex chars
+	tokenRegex := regexp.MustCompile(`itk_[0-9a-f]{16}`)
+	encoder := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		var msg map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			fmt.Fprintf(os.Stderr, "bad input: %v\n", err)
+			os.Exit(2)
+		}
+
+		switch msg["type"] {
+		case "start":
+			_ = encoder.Encode(map[string]any{"type": "log", "level": "INFO", "message": "scanning " + msg["kind"].(string)})
+		case "file":
+			switch mode {
+			case "crash":
+				_ = encoder.Encode(map[string]any{"type": "finding", "path": msg["path"], "secret": "partial", "rule": map[string]any{"id": "partial"}})
+				fmt.Fprintln(os.Stderr, "plugin crashed")
+				os.Exit(3)
+			case "hang":
+				time.Sleep(time.Minute)
+			case "garbage":
+				fmt.Println("not json")
+				_ = encoder.Encode(map[string]any{"type": "unknown"})
+			}
+
+			for i, line := range strings.Split(msg["content"].(string), "\n") {
+				for _, loc := range tokenRegex.FindAllStringIndex(line, -1) {
+					_ = encoder.Encode(map[string]any{
+						"type":    "finding",
+						"path":    msg["path"],
+						"secret":  line[loc[0]:loc[1]],
+						"context": line,
+						"rule": map[string]any{
+							"id":          "internal-token",
+							"description": "Internal Token",
+							"tags":        []string{"type:secret"},
+						},
+						"start": map[string]int{"line": i + 1, "column": loc[0] + 1},
+						"end":   map[string]int{"line": i + 1, "column": loc[1]},
+					})
+				}
+			}
+		case "end":
+			os.Exit(0)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func newTestExternal(t *testing.T, mode string, timeout uint16) *External {
+	external, err := NewExternal("test-plugin", config.ExternalBackend{
+		Path:    os.Args[0],
+		Args:    []string{"-test.run=^TestExternalPlugin$"},
+		Env:     map[string]string{"LEAKTK_TEST_PLUGIN": mode},
+		Timeout: timeout,
+	})
+	assert.NoError(t, err)
+
+	return external
+}
+
+func TestExternalScan(t *testing.T) {
+	data := "first line\ntoken = itk_0123456789abcdef\n"
+
+	t.Run("Success", func(t *testing.T) {
+		text := resource.NewText(data, &resource.TextOptions{})
+		text.IncludeLogs(true)
+		results, err := newTestExternal(t, "scan", 0).Scan(text, &RequestOptions{})
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+
+		assert.Equal(t, "itk_0123456789abcdef", results[0].Secret)
+		assert.Equal(t, "itk_0123456789abcdef", results[0].Match)
+		assert.Equal(t, "internal-token", results[0].Rule.ID)
+		assert.Equal(t, response.TextResultKind, results[0].Kind)
+		assert.Equal(t, response.Point{Line: 2, Column: 9}, results[0].Location.Start)
+		assert.Equal(t, response.Point{Line: 2, Column: 28}, results[0].Location.End)
+
+		assert.Contains(t, text.Logs()[0].Fields, logger.String("message", "scanning Text"))
+	})
+
+	t.Run("InvalidMessages", func(t *testing.T) {
+		text := resource.NewText(data, &resource.TextOptions{})
+		text.IncludeLogs(true)
+		results, err := newTestExternal(t, "garbage", 0).Scan(text, &RequestOptions{})
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+
+		var messages []string
+		var fields []logger.Field
+		for _, entry := range text.Logs() {
+			messages = append(messages, entry.Message)
+			fields = append(fields, entry.Fields...)
+		}
+
+		assert.Contains(t, messages, "invalid external backend message")
+		assert.Contains(t, fields, logger.String("type", "unknown"))
+	})
+
+	t.Run("Crash", func(t *testing.T) {
+		results, err := newTestExternal(t, "crash", 0).Scan(resource.NewText(data, &resource.TextOptions{}), &RequestOptions{})
+		assert.ErrorContains(t, err, "external backend failed")
+		assert.ErrorContains(t, err, "plugin crashed")
+		// Findings before the crash are kept
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		_, err := newTestExternal(t, "hang", 1).Scan(resource.NewText(data, &resource.TextOptions{}), &RequestOptions{})
+		assert.ErrorContains(t, err, "external backend timed out")
+	})
+
+	t.Run("MissingExecutable", func(t *testing.T) {
+		_, err := NewExternal("missing", config.ExternalBackend{Path: "leaktk-plugin-that-does-not-exist"})
+		assert.ErrorContains(t, err, "could not find external backend executable")
+	})
+}
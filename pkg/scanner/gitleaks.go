@@ -1,14 +1,19 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"maps"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/leaktk/leaktk/pkg/response"
 
 	"github.com/h2non/filetype"
+	gitleaksconfig "github.com/zricethezav/gitleaks/v8/config"
 	"github.com/zricethezav/gitleaks/v8/detect"
 	"github.com/zricethezav/gitleaks/v8/report"
 	"github.com/zricethezav/gitleaks/v8/sources"
@@ -23,19 +28,26 @@ const (
 	chunkSize = 1024 * 1024 // 1 MiB
 )
 
-var defaultRemote *detect.RemoteInfo = &detect.RemoteInfo{}
+var defaultRemote *sources.RemoteInfo = &sources.RemoteInfo{}
 
 // Gitleaks wraps gitleaks as a scanner backend
 type Gitleaks struct {
 	maxDecodeDepth uint16
 	patterns       *Patterns
+
+	// filteredConfigs caches the configs built for rule filters. It's reset
+	// when the patterns change.
+	filteredConfigs     map[string]*gitleaksconfig.Config
+	filteredConfigsBase *gitleaksconfig.Config
+	filteredConfigsLock sync.Mutex
 }
 
 // NewGitleaks returns a configured gitleaks backend instance
 func NewGitleaks(maxDecodeDepth uint16, patterns *Patterns) *Gitleaks {
 	return &Gitleaks{
-		maxDecodeDepth: maxDecodeDepth,
-		patterns:       patterns,
+		maxDecodeDepth:  maxDecodeDepth,
+		patterns:        patterns,
+		filteredConfigs: make(map[string]*gitleaksconfig.Config),
 	}
 }
 
@@ -44,12 +56,95 @@ func (g *Gitleaks) Name() string {
 	return "Gitleaks"
 }
 
-// newDetector creates and configures a detector object for this resource
-func (g *Gitleaks) newDetector(scanResource resource.Resource) (*detect.Detector, error) {
-	cfg, err := g.patterns.Gitleaks()
+// filteredConfig returns the config with only the rules allowed by the filter
+func (g *Gitleaks) filteredConfig(log *logger.Logger, cfg *gitleaksconfig.Config, filter *RuleFilter) *gitleaksconfig.Config {
+	if filter.Empty() {
+		return cfg
+	}
+
+	g.filteredConfigsLock.Lock()
+	defer g.filteredConfigsLock.Unlock()
+
+	if g.filteredConfigsBase != cfg {
+		g.filteredConfigsBase = cfg
+		clear(g.filteredConfigs)
+	}
+
+	key := filter.Key()
+	if filtered, ok := g.filteredConfigs[key]; ok {
+		return filtered
+	}
+
+	filtered := filter.Apply(cfg)
+	log.Debug("built filtered gitleaks config", logger.String("rule_filter", key), logger.Int("rules", len(filtered.Rules)))
+	g.filteredConfigs[key] = filtered
+
+	return filtered
+}
+
+// mergeGitleaksConfig returns a copy of cfg with the rules that match the
+// filter and the allowlists from extra added to it. Rules in extra replace
+// rules in cfg with the same ID.
+func mergeGitleaksConfig(cfg, extra *gitleaksconfig.Config, filter *RuleFilter) *gitleaksconfig.Config {
+	merged := *cfg
+	merged.Rules = maps.Clone(cfg.Rules)
+	merged.Keywords = maps.Clone(cfg.Keywords)
+	merged.OrderedRules = slices.Clone(cfg.OrderedRules)
+	merged.Allowlists = append(slices.Clone(cfg.Allowlists), extra.Allowlists...)
+
+	if merged.Rules == nil {
+		merged.Rules = make(map[string]gitleaksconfig.Rule)
+	}
+
+	if merged.Keywords == nil {
+		merged.Keywords = make(map[string]struct{})
+	}
+
+	for _, ruleID := range extra.OrderedRules {
+		rule, ok := extra.Rules[ruleID]
+		if !ok || !filter.Match(rule.RuleID, rule.Tags) {
+			continue
+		}
+
+		if _, exists := merged.Rules[ruleID]; !exists {
+			merged.OrderedRules = append(merged.OrderedRules, ruleID)
+		}
+
+		merged.Rules[ruleID] = rule
+
+		for _, keyword := range rule.Keywords {
+			merged.Keywords[strings.ToLower(keyword)] = struct{}{}
+		}
+	}
+
+	return &merged
+}
+
+// newDetector creates and configures a detector object for this resource. It
+// returns a nil detector if none of the gitleaks rules match the request's
+// rule filter (e.g. it only selects native or external rules).
+func (g *Gitleaks) newDetector(scanResource resource.Resource, options *RequestOptions) (*detect.Detector, error) {
+	log := scanResource.Logger()
+	cfg, err := g.patterns.loadGitleaks(log)
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: error=%q", ErrPatternsUnavailable, err)
+	}
+
+	cfg = g.filteredConfig(log, cfg, &options.RuleFilter)
+
+	if len(options.GitleaksConfig) > 0 {
+		inlineConfig, err := ParseGitleaksConfig(string(options.GitleaksConfig))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gitleaks_config option: error=%q", err)
+		}
+
+		cfg = mergeGitleaksConfig(cfg, inlineConfig, &options.RuleFilter)
+	}
+
+	if len(cfg.Rules) == 0 {
+		log.Debug("no gitleaks rules match the rule filter", logger.String("rule_filter", options.RuleFilter.Key()))
+		return nil, nil
 	}
 
 	detector := detect.NewDetector(*cfg)
@@ -79,24 +174,25 @@ func (g *Gitleaks) newDetector(scanResource resource.Resource) (*detect.Detector
 
 	rawClonedConfig, err := scanResource.ReadFile(".gitleaks.toml")
 	if err == nil {
-		logger.Debug("gitleaks config: resource_id=%q config=%q", scanResource.ID(), rawClonedConfig)
+		log.Debug("gitleaks config", logger.String("config", string(rawClonedConfig)))
 		clonedConfig, err := ParseGitleaksConfig(string(rawClonedConfig))
 
 		if err != nil {
-			logger.Error("could not load cloned .gitleaks.toml: resource_id=%q error=%q", scanResource.ID(), err)
+			log.Error("could not load cloned .gitleaks.toml", logger.Err(err))
 		} else {
-			logger.Debug("loading cloned .gitleaks.toml")
+			log.Debug("loading cloned .gitleaks.toml")
 			detector.Config.Allowlists = append(detector.Config.Allowlists, clonedConfig.Allowlists...)
 		}
 	} else {
-		logger.Debug("no cloned .gitleaks.toml")
+		log.Debug("no cloned .gitleaks.toml")
 	}
 
 	return detector, nil
 }
 
-// gitScan handles when the resource is a gitRepo type
-func (g *Gitleaks) gitScan(detector *detect.Detector, gitRepo *resource.GitRepo) ([]report.Finding, error) {
+// gitScan handles when the resource is a gitRepo type. Each finding is passed
+// to collect as it's found.
+func (g *Gitleaks) gitScan(detector *detect.Detector, gitRepo *resource.GitRepo, options *RequestOptions, collect func(report.Finding)) error {
 	gitLogOpts := []string{"--full-history", "--ignore-missing"}
 
 	if len(gitRepo.Since()) > 0 {
@@ -131,15 +227,58 @@ func (g *Gitleaks) gitScan(detector *detect.Detector, gitRepo *resource.GitRepo)
 	}
 
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	source := &sources.Git{
+		Cmd:             gitCmd,
+		Config:          &detector.Config,
+		Remote:          defaultRemote,
+		Sema:            detector.Sema,
+		MaxArchiveDepth: detector.MaxArchiveDepth,
 	}
 
-	return detector.DetectGit(gitCmd, defaultRemote)
+	// This reads the fragments instead of calling detector.DetectSource so
+	// that progress can be reported and findings sent as the commits are
+	// scanned. The fragments are yielded from several goroutines.
+	var progressLock sync.Mutex
+	commits := make(map[string]struct{})
+	files := make(map[string]struct{})
+
+	return source.Fragments(context.Background(), func(fragment sources.Fragment, err error) error {
+		if err != nil {
+			return err
+		}
+
+		progressLock.Lock()
+		if _, ok := commits[fragment.CommitSHA]; !ok {
+			commits[fragment.CommitSHA] = struct{}{}
+			options.progress.commitDone()
+		}
+
+		// A file's changes can be split across several fragments
+		file := fragment.CommitSHA + ":" + fragment.FilePath
+		if _, ok := files[file]; !ok {
+			files[file] = struct{}{}
+			options.progress.fileDone()
+		}
+		progressLock.Unlock()
+
+		for _, finding := range detector.Detect(detect.Fragment(fragment)) {
+			collect(finding)
+		}
+
+		return nil
+	})
 }
 
-// walkScan is the default way to scan most resources
-func (g *Gitleaks) walkScan(detector *detect.Detector, scanResource resource.Resource) ([]report.Finding, error) {
-	err := scanResource.Walk(func(path string, reader io.Reader) error {
+// walkScan is the default way to scan most resources. Each finding is passed
+// to collect as it's found.
+func (g *Gitleaks) walkScan(detector *detect.Detector, scanResource resource.Resource, options *RequestOptions, collect func(report.Finding)) error {
+	log := scanResource.Logger()
+	return scanResource.Walk(func(path string, reader io.Reader) error {
+		options.progress.fileDone()
+
 		// Source: https://github.com/gitleaks/gitleaks/blob/master/detect/directory.go
 		buf := make([]byte, chunkSize)
 		totalLines := 0
@@ -147,7 +286,7 @@ func (g *Gitleaks) walkScan(detector *detect.Detector, scanResource resource.Res
 		for {
 			n, err := reader.Read(buf)
 			if err != nil && err != io.EOF {
-				logger.Error("could not read file: path=%q", path)
+				log.Error("could not read file", logger.String("path", path), logger.Err(err))
 				return nil
 			}
 
@@ -158,11 +297,11 @@ func (g *Gitleaks) walkScan(detector *detect.Detector, scanResource resource.Res
 			// TODO: optimization could be introduced here
 			mimetype, err := filetype.Match(buf[:n])
 			if err != nil {
-				logger.Error("could not determine file type: path=%q", path)
+				log.Error("could not determine file type", logger.String("path", path), logger.Err(err))
 				return nil
 			}
 			if mimetype.MIME.Type == "application" {
-				logger.Warning("skipping binary file: path=%q", path)
+				log.Warning("skipping binary file", logger.String("path", path))
 				return nil // skip binary files
 			}
 
@@ -178,98 +317,118 @@ func (g *Gitleaks) walkScan(detector *detect.Detector, scanResource resource.Res
 				// need to add 1 since line counting starts at 1
 				finding.StartLine += (totalLines - linesInChunk) + 1
 				finding.EndLine += (totalLines - linesInChunk) + 1
-				detector.AddFinding(finding)
+				collect(finding)
 			}
 		}
 
 		return nil
 	})
-
-	return detector.Findings(), err
 }
 
 // Scan does the gitleaks scan on the resource
-func (g *Gitleaks) Scan(scanResource resource.Resource) ([]*response.Result, error) {
-	var findings []report.Finding
-	var err error
-	var resultKind string
+func (g *Gitleaks) Scan(scanResource resource.Resource, options *RequestOptions) ([]*response.Result, error) {
+	results := make([]*response.Result, 0)
 
-	detector, err := g.newDetector(scanResource)
+	detector, err := g.newDetector(scanResource, options)
 	if err != nil {
 		return nil, err
 	}
 
+	if detector == nil {
+		return results, nil
+	}
+
+	// Findings are converted as they're found so they can be streamed.
+	// AddFinding sets the fingerprint and drops the finding if it's in the
+	// resource's .gitleaksignore or .gitleaksbaseline, so only the findings
+	// it keeps are sent.
+	var collectLock sync.Mutex
+	collected := 0
+	collect := func(finding report.Finding) {
+		collectLock.Lock()
+		defer collectLock.Unlock()
+
+		detector.AddFinding(finding)
+		findings := detector.Findings()
+		for _, kept := range findings[collected:] {
+			results = options.collect(results, g.newResult(scanResource, kept))
+		}
+
+		collected = len(findings)
+	}
+
 	switch scanResource := scanResource.(type) {
 	case *resource.GitRepo:
-		findings, err = g.gitScan(detector, scanResource)
+		err = g.gitScan(detector, scanResource, options, collect)
 	default:
-		findings, err = g.walkScan(detector, scanResource)
+		err = g.walkScan(detector, scanResource, options, collect)
 	}
 
 	if err != nil {
-		logger.Error("gitleaks error: error=%q", err)
+		scanResource.Logger().Error("gitleaks error", logger.Err(err))
 	}
 
-	results := make([]*response.Result, len(findings))
+	return results, err
+}
 
-	for i, finding := range findings {
-		notes := map[string]string{}
+// newResult converts a gitleaks finding to a result
+func (g *Gitleaks) newResult(scanResource resource.Resource, finding report.Finding) *response.Result {
+	var resultKind string
+	notes := map[string]string{}
 
-		switch scanResource.(type) {
-		case *resource.GitRepo:
-			notes["message"] = finding.Message
-			notes["gitleaks_fingerprint"] = finding.Fingerprint
-		}
+	switch scanResource.(type) {
+	case *resource.GitRepo:
+		notes["message"] = finding.Message
+		notes["gitleaks_fingerprint"] = finding.Fingerprint
+	}
 
-		result := &response.Result{
-			// Be careful changing how this is generated, this could result in
-			// duplicate alerts
-			ID: id.ID(
-				// What: Uniquely identify the kind of thing that's being scanned
-				resultKind,
-				scanResource.String(),
-
-				// Where: Uniquely identify where in that resource it was being scanned
-				finding.Commit,
-				finding.File,
-				fmt.Sprint(finding.StartLine),
-				fmt.Sprint(finding.StartColumn),
-				fmt.Sprint(finding.EndLine),
-				fmt.Sprint(finding.EndColumn),
-
-				// How: Uniquely identify what was used to find it
-				finding.RuleID,
-			),
-			Secret:  finding.Secret,
-			Match:   finding.Match,
-			Context: finding.Line,
-			Entropy: finding.Entropy,
-			Date:    finding.Date,
-			Notes:   notes,
-			Contact: response.Contact{
-				Name:  finding.Author,
-				Email: finding.Email,
-			},
-			Rule: response.Rule{
-				ID:          finding.RuleID,
-				Description: finding.Description,
-				Tags:        finding.Tags,
+	result := &response.Result{
+		// Be careful changing how this is generated, this could result in
+		// duplicate alerts
+		ID: id.ID(
+			// What: Uniquely identify the kind of thing that's being scanned
+			resultKind,
+			scanResource.String(),
+
+			// Where: Uniquely identify where in that resource it was being scanned
+			finding.Commit,
+			finding.File,
+			fmt.Sprint(finding.StartLine),
+			fmt.Sprint(finding.StartColumn),
+			fmt.Sprint(finding.EndLine),
+			fmt.Sprint(finding.EndColumn),
+
+			// How: Uniquely identify what was used to find it
+			finding.RuleID,
+		),
+		Secret:  finding.Secret,
+		Match:   finding.Match,
+		Context: finding.Line,
+		Entropy: finding.Entropy,
+		Date:    finding.Date,
+		Notes:   notes,
+		Contact: response.Contact{
+			Name:  finding.Author,
+			Email: finding.Email,
+		},
+		Rule: response.Rule{
+			ID:          finding.RuleID,
+			Description: finding.Description,
+			Tags:        finding.Tags,
+		},
+		Location: response.Location{
+			Version: finding.Commit,
+			Path:    finding.File,
+			Start: response.Point{
+				Line:   finding.StartLine,
+				Column: finding.StartColumn,
 			},
-			Location: response.Location{
-				Version: finding.Commit,
-				Path:    finding.File,
-				Start: response.Point{
-					Line:   finding.StartLine,
-					Column: finding.StartColumn,
-				},
-				End: response.Point{
-					Line:   finding.EndLine,
-					Column: finding.EndColumn,
-				},
+			End: response.Point{
+				Line:   finding.EndLine,
+				Column: finding.EndColumn,
 			},
-		}
-		results[i] = scanResource.EnrichResult(result)
+		},
 	}
 
-	return results, err
+	return scanResource.EnrichResult(result)
 }
@@ -1,12 +1,15 @@
 package scanner
 
 import (
+	"encoding/json"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zricethezav/gitleaks/v8/detect"
 
 	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/logger"
@@ -57,7 +60,7 @@ func TestGitleaksScan(t *testing.T) {
 		err = gitRepo.Clone(filepath.Join(tempDir, "clone"))
 		assert.NoError(t, err)
 
-		results, err := NewGitleaks(1, patterns).Scan(gitRepo)
+		results, err := NewGitleaks(1, patterns).Scan(gitRepo, &RequestOptions{})
 		assert.NoError(t, err)
 		assert.Greater(t, len(results), 0)
 		// This should at least be defined on git responses
@@ -90,8 +93,160 @@ func TestGitleaksScan(t *testing.T) {
 		err = gitRepo.Clone(filepath.Join(tempDir, "clone"))
 		assert.NoError(t, err)
 
-		results, err := NewGitleaks(1, patterns).Scan(gitRepo)
+		results, err := NewGitleaks(1, patterns).Scan(gitRepo, &RequestOptions{})
 		assert.Error(t, err)
 		assert.Equal(t, len(results), 0)
 	})
 }
+
+func TestGitleaksInlineConfig(t *testing.T) {
+	cfg, err := ParseGitleaksConfig(mockRuleFilterConfig)
+	assert.NoError(t, err)
+
+	patterns := &Patterns{config: &config.Patterns{}, gitleaksConfig: cfg}
+	data := "password=hunter2\ninternal=itk_0123456789abcdef\n"
+
+	t.Run("TOML", func(t *testing.T) {
+		options := &RequestOptions{GitleaksConfig: `
+[[rules]]
+id = "internal-token"
+regex = '''itk_[0-9a-f]{16}'''
+keywords = ["itk_"]
+
+[[allowlists]]
+regexes = ['''hunter2''']
+`}
+		results, err := NewGitleaks(0, patterns).Scan(resource.NewText(data, &resource.TextOptions{}), options)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "internal-token", results[0].Rule.ID)
+
+		// The shared config isn't changed
+		assert.Len(t, cfg.Rules, 3)
+		assert.Len(t, cfg.Allowlists, 0)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var request Request
+		err := json.Unmarshal([]byte(`{"kind": "Text", "resource": "x", "options": {"gitleaks_config": {
+			"rules": [{"id": "internal-token", "regex": "itk_[0-9a-f]{16}", "secretGroup": 0, "tags": ["internal"]}]
+		}}}`), &request)
+		assert.NoError(t, err)
+
+		results, err := NewGitleaks(0, patterns).Scan(resource.NewText(data, &resource.TextOptions{}), &request.Options)
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+	})
+
+	t.Run("RuleFilter", func(t *testing.T) {
+		options := &RequestOptions{
+			GitleaksConfig: "[[rules]]\nid = \"internal-token\"\nregex = '''itk_[0-9a-f]{16}'''\n",
+			RuleFilter:     RuleFilter{Rules: []string{"internal-token"}},
+		}
+		results, err := NewGitleaks(0, patterns).Scan(resource.NewText(data, &resource.TextOptions{}), options)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "internal-token", results[0].Rule.ID)
+	})
+
+	t.Run("NoGitleaksRules", func(t *testing.T) {
+		// Only selects a native rule so there's nothing for gitleaks to do
+		options := &RequestOptions{RuleFilter: RuleFilter{Rules: []string{highEntropyRuleID}}}
+		results, err := NewGitleaks(0, patterns).Scan(resource.NewText(data, &resource.TextOptions{}), options)
+		assert.NoError(t, err)
+		assert.Len(t, results, 0)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		options := &RequestOptions{GitleaksConfig: "[[rules]]\nid = \"bad\"\nregex = '''(?!x)'''\n"}
+		_, err := NewGitleaks(0, patterns).Scan(resource.NewText(data, &resource.TextOptions{}), options)
+		assert.ErrorContains(t, err, "invalid gitleaks_config option")
+	})
+}
+
+// newLocalGitRepo commits each file in its own commit and returns the repo
+func newLocalGitRepo(t *testing.T, files ...[2]string) *resource.GitRepo {
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	assert.NoError(t, exec.Command("git", "init", repoDir).Run())
+
+	for _, file := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(repoDir, file[0]), []byte(file[1]), 0600))
+		assert.NoError(t, exec.Command("git", "-C", repoDir, "add", file[0]).Run())
+		assert.NoError(t, exec.Command("git", "-C", repoDir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-m", "add "+file[0]).Run())
+	}
+
+	return resource.NewGitRepo(repoDir, &resource.GitRepoOptions{Local: true})
+}
+
+func TestGitleaksGitScan(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "gitleaks.toml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(mockGitleaksTestConfig), 0600))
+
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = configPath
+	patterns := NewPatterns(&cfg.Scanner.Patterns, nil)
+
+	gitRepo := newLocalGitRepo(t,
+		[2]string{"a.txt", "nothing here\nfake\n"},
+		[2]string{"b.txt", "fake\n"},
+		[2]string{"c.txt", "nothing here\n"},
+	)
+
+	var reported [][2]int
+	options := &RequestOptions{
+		progress: &scanProgress{emit: func(files, commits int) { reported = append(reported, [2]int{files, commits}) }},
+	}
+
+	results, err := NewGitleaks(0, patterns).Scan(gitRepo, options)
+	assert.NoError(t, err)
+	options.progress.done()
+
+	// Every commit is counted even if it has nothing in it
+	assert.Equal(t, [2]int{3, 3}, reported[len(reported)-1])
+
+	lines := make(map[string]int, len(results))
+	for _, result := range results {
+		assert.NotEmpty(t, result.Location.Version)
+		assert.Equal(t, "test@example.com", result.Contact.Email)
+		lines[result.Location.Path] = result.Location.Start.Line
+	}
+
+	assert.Equal(t, map[string]int{"a.txt": 2, "b.txt": 1}, lines)
+}
+
+func TestGitleaksIgnoreAndBaseline(t *testing.T) {
+	cfg, err := ParseGitleaksConfig(mockGitleaksTestConfig)
+	assert.NoError(t, err)
+
+	patterns := &Patterns{config: &config.Patterns{}, gitleaksConfig: cfg}
+	tempDir := t.TempDir()
+
+	for path, content := range map[string]string{
+		"kept.txt":        "fake\n",
+		"ignored.txt":     "fake\n",
+		"dir/ignored.txt": "fake\n",
+		"baselined.txt":   "fake\n",
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tempDir, path)), 0700))
+		assert.NoError(t, os.WriteFile(filepath.Join(tempDir, path), []byte(content), 0600))
+	}
+
+	// Build the baseline the same way the scan finds it
+	baselined := detect.NewDetector(*cfg).Detect(detect.Fragment{Raw: "fake\n", FilePath: "baselined.txt"})
+	assert.Len(t, baselined, 1)
+	baselined[0].StartLine++
+	baselined[0].EndLine++
+	baseline, err := json.Marshal(baselined)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, ".gitleaksbaseline"), baseline, 0600))
+	// The ignore paths are normalized to forward slashes
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, ".gitleaksignore"), []byte(
+		"# comment\n\nignored.txt:test-rule:1\ndir\\ignored.txt:test-rule:1\n",
+	), 0600))
+
+	results, err := NewGitleaks(0, patterns).Scan(resource.NewFiles(tempDir, &resource.FilesOptions{}), &RequestOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "kept.txt", results[0].Location.Path)
+}
@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/metrics"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// Outcomes for the leaktk_requests_total metric
+const (
+	requestQueued   = "queued"
+	requestRejected = "rejected"
+	requestShared   = "shared"
+	requestCached   = "cached"
+)
+
+// otherRule is the leaktk_findings_total rule for results from rules that
+// aren't in the loaded patterns or built into the native backend (e.g. inline
+// or external rules), so requests can't add series
+const otherRule = "other"
+
+// scannerMetrics are the metrics a scanner reports about itself
+type scannerMetrics struct {
+	registry       *metrics.Registry
+	requests       *metrics.Counter
+	queueDepth     *metrics.Gauge
+	workers        *metrics.Gauge
+	busyWorkers    *metrics.Gauge
+	cloneDuration  *metrics.Histogram
+	cloneRetries   *metrics.Counter
+	scanDuration   *metrics.Histogram
+	findings       *metrics.Counter
+	patternFetches *metrics.Counter
+	patternAge     *metrics.Gauge
+}
+
+// newScannerMetrics registers the scanner's metrics. The queue depths and
+// pattern ages are read when the metrics are collected.
+func (s *Scanner) newScannerMetrics() *scannerMetrics {
+	registry := metrics.NewRegistry()
+	m := &scannerMetrics{
+		registry:       registry,
+		requests:       registry.NewCounter("leaktk_requests_total", "Requests sent to the scanner by outcome (queued, rejected, shared with an in-flight scan or served from the cache)", "outcome"),
+		queueDepth:     registry.NewGauge("leaktk_queue_depth", "Messages waiting in each scanner queue", "queue"),
+		workers:        registry.NewGauge("leaktk_workers", "Configured workers per stage", "stage"),
+		busyWorkers:    registry.NewGauge("leaktk_workers_busy", "Workers handling a request per stage", "stage"),
+		cloneDuration:  registry.NewHistogram("leaktk_clone_duration_seconds", "How long clones took by resource kind", metrics.DefaultDurationBuckets, "kind"),
+		cloneRetries:   registry.NewCounter("leaktk_clone_retries_total", "Clones retried after a transient failure by resource kind", "kind"),
+		scanDuration:   registry.NewHistogram("leaktk_scan_duration_seconds", "How long scans took by resource kind", metrics.DefaultDurationBuckets, "kind"),
+		findings:       registry.NewCounter("leaktk_findings_total", "Results reported by rule ID (other for rules not in the loaded patterns)", "rule"),
+		patternFetches: registry.NewCounter("leaktk_pattern_fetches_total", "Pattern fetches by source and outcome (success or failure)", "source", "outcome"),
+		patternAge:     registry.NewGauge("leaktk_patterns_age_seconds", "Seconds since each pattern source was last fetched or confirmed current", "source"),
+	}
+
+	m.workers.Set(float64(s.cloneWorkers), "clone")
+	m.workers.Set(float64(s.scanWorkers), "scan")
+	m.busyWorkers.Set(0, "clone")
+	m.busyWorkers.Set(0, "scan")
+
+	registry.OnCollect(func() {
+		m.queueDepth.Set(float64(s.cloneQueue.Len()), "clone")
+		m.queueDepth.Set(float64(s.scanQueue.Len()), "scan")
+		m.queueDepth.Set(float64(s.responseQueue.Len()), "response")
+
+		// The settings aren't set until after the metrics are created
+		settings := s.settings.Load()
+		if settings == nil || settings.patterns == nil {
+			return
+		}
+
+		for source, modTime := range settings.patterns.modTimes() {
+			m.patternAge.Set(time.Since(modTime).Seconds(), source)
+		}
+	})
+
+	return m
+}
+
+// Metrics returns the scanner's metrics so they can be served
+func (s *Scanner) Metrics() *metrics.Registry {
+	return s.metrics.registry
+}
+
+// patternFetched records the outcome of a pattern fetch
+func (m *scannerMetrics) patternFetched(source string, err error) {
+	if err != nil {
+		m.patternFetches.Inc(source, "failure")
+	} else {
+		m.patternFetches.Inc(source, "success")
+	}
+}
+
+// observeFindings counts the results by rule
+func (m *scannerMetrics) observeFindings(patterns *Patterns, results []*response.Result) {
+	for _, result := range results {
+		m.findings.Inc(findingRule(patterns, result.Rule.ID))
+	}
+}
+
+// findingRule returns the rule label for a result's rule ID
+func findingRule(patterns *Patterns, ruleID string) string {
+	if isNativeRule(ruleID) || (patterns != nil && patterns.hasRule(ruleID)) {
+		return ruleID
+	}
+
+	return otherRule
+}
+
+// watchPatterns records the fetches for patterns
+func (m *scannerMetrics) watchPatterns(patterns *Patterns) {
+	if patterns != nil {
+		patterns.OnFetch(m.patternFetched)
+	}
+}
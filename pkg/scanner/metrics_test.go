@@ -0,0 +1,89 @@
+package scanner
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+func TestScannerMetrics(t *testing.T) {
+	scanner := newTestScanner(t, nil, &mockBackend{})
+
+	var wg sync.WaitGroup
+	go scanner.Recv(func(response *response.Response) {
+		wg.Done()
+	})
+
+	wg.Add(1)
+	assert.NoError(t, scanner.Send(&Request{ID: "1", Resource: &mockResource{}}))
+	wg.Wait()
+
+	scanner.metrics.patternFetched("server", nil)
+	scanner.metrics.patternFetched("server", errors.New("offline"))
+
+	// Scrape it the way Prometheus would
+	recorder := httptest.NewRecorder()
+	scanner.Metrics().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Result().Body)
+	assert.NoError(t, err)
+
+	for _, line := range []string{
+		`leaktk_requests_total{outcome="queued"} 1`,
+		`leaktk_queue_depth{queue="clone"} 0`,
+		`leaktk_queue_depth{queue="scan"} 0`,
+		`leaktk_workers{stage="scan"} 1`,
+		`leaktk_workers_busy{stage="clone"} 0`,
+		`leaktk_clone_duration_seconds_count{kind="Mock"} 1`,
+		`leaktk_scan_duration_seconds_count{kind="Mock"} 1`,
+		`leaktk_findings_total{rule="other"} 1`,
+		`leaktk_pattern_fetches_total{source="server",outcome="success"} 1`,
+		`leaktk_pattern_fetches_total{source="server",outcome="failure"} 1`,
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
+
+// newMetricsTestPatterns returns patterns loaded from mockGitleaksTestConfig
+func newMetricsTestPatterns(t *testing.T) *Patterns {
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(t.TempDir(), "gitleaks.toml")
+	assert.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte(mockGitleaksTestConfig), 0600))
+
+	return NewPatterns(&cfg.Scanner.Patterns, nil)
+}
+
+func TestFindingRule(t *testing.T) {
+	patterns := newMetricsTestPatterns(t)
+	// Nothing is counted by rule until the patterns are loaded
+	assert.Equal(t, otherRule, findingRule(patterns, "test-rule"))
+
+	_, err := patterns.Gitleaks()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "test-rule", findingRule(patterns, "test-rule"))
+	assert.Equal(t, "github-token", findingRule(patterns, "github-token"))
+	assert.Equal(t, highEntropyRuleID, findingRule(patterns, highEntropyRuleID))
+	// Inline and external rules are chosen by the caller
+	assert.Equal(t, otherRule, findingRule(patterns, "caller-chosen-rule"))
+	assert.Equal(t, otherRule, findingRule(nil, "test-rule"))
+}
+
+func TestPatternModTimesDuringFetch(t *testing.T) {
+	patterns := newMetricsTestPatterns(t)
+
+	// A fetch holds the mutex for as long as the download takes
+	patterns.mutex.Lock()
+	defer patterns.mutex.Unlock()
+
+	modTimes := patterns.modTimes()
+	assert.Contains(t, modTimes, "server")
+}
@@ -0,0 +1,311 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/h2non/filetype"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/resource"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+const (
+	defaultEntropyMinLength = 20
+	defaultEntropyThreshold = 4.5
+	// highEntropyRuleID is the rule ID for results from entropy detection
+	highEntropyRuleID = "high-entropy-string"
+	// fileTypeHeaderSize is enough of a file to detect its type
+	fileTypeHeaderSize = 8192
+)
+
+// nativeRule is a pattern built into the Native backend
+type nativeRule struct {
+	id          string
+	description string
+	regex       *regexp.Regexp
+	// secretGroup is the regex group holding the secret (0 for the match)
+	secretGroup int
+}
+
+// nativeRules is a small set of high confidence patterns that don't depend
+// on fetching patterns from a pattern server
+var nativeRules = []nativeRule{
+	{
+		id:          "aws-access-key-id",
+		description: "AWS Access Key ID",
+		regex:       regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`),
+		secretGroup: 1,
+	},
+	{
+		id:          "github-token",
+		description: "GitHub Token",
+		regex:       regexp.MustCompile(`\b(gh[pousr]_[0-9A-Za-z]{36,255})\b`),
+		secretGroup: 1,
+	},
+	{
+		id:          "github-fine-grained-pat",
+		description: "GitHub Fine-Grained Personal Access Token",
+		regex:       regexp.MustCompile(`\b(github_pat_[0-9A-Za-z_]{82})\b`),
+		secretGroup: 1,
+	},
+	{
+		id:          "gitlab-pat",
+		description: "GitLab Personal Access Token",
+		regex:       regexp.MustCompile(`\b(glpat-[0-9A-Za-z_-]{20})\b`),
+		secretGroup: 1,
+	},
+	{
+		id:          "google-api-key",
+		description: "Google API Key",
+		regex:       regexp.MustCompile(`\b(AIza[0-9A-Za-z_-]{35})\b`),
+		secretGroup: 1,
+	},
+	{
+		id:          "slack-token",
+		description: "Slack Token",
+		regex:       regexp.MustCompile(`\b(xox[abposr]-[0-9A-Za-z-]{10,})\b`),
+		secretGroup: 1,
+	},
+	{
+		id:          "stripe-secret-key",
+		description: "Stripe Secret Key",
+		regex:       regexp.MustCompile(`\b((?:sk|rk)_live_[0-9A-Za-z]{24,99})\b`),
+		secretGroup: 1,
+	},
+	{
+		id:          "private-key",
+		description: "Private Key",
+		regex:       regexp.MustCompile(`-----BEGIN[A-Z ]{0,32} PRIVATE KEY-----`),
+	},
+}
+
+// nativeRuleTags are the tags on every native rule
+var nativeRuleTags = []string{"type:secret"}
+
+// isNativeRule returns true if the rule ID is built into the native backend
+func isNativeRule(ruleID string) bool {
+	if ruleID == highEntropyRuleID {
+		return true
+	}
+
+	return slices.ContainsFunc(nativeRules, func(rule nativeRule) bool {
+		return rule.id == ruleID
+	})
+}
+
+// entropyCandidateRegex finds strings that could be tokens or keys
+var entropyCandidateRegex = regexp.MustCompile(`[A-Za-z0-9+/=_-]+`)
+
+// Native is a scanner backend that runs a built in rule set and high entropy
+// string detection directly over the resource's files
+type Native struct {
+	entropy          bool
+	entropyMinLength int
+	entropyThreshold float64
+}
+
+// NewNative returns a configured native backend instance
+func NewNative(cfg config.NativeBackend) *Native {
+	native := &Native{
+		entropy:          !cfg.DisableEntropy,
+		entropyMinLength: int(cfg.EntropyMinLength),
+		entropyThreshold: cfg.EntropyThreshold,
+	}
+
+	if native.entropyMinLength == 0 {
+		native.entropyMinLength = defaultEntropyMinLength
+	}
+
+	if native.entropyThreshold == 0 {
+		native.entropyThreshold = defaultEntropyThreshold
+	}
+
+	return native
+}
+
+// Name returns the human readable name of the backend for logging details
+func (n *Native) Name() string {
+	return "Native"
+}
+
+// Scan walks the resource and checks each line of each file. For git repos
+// this only covers the files at HEAD and not the history.
+func (n *Native) Scan(scanResource resource.Resource, options *RequestOptions) ([]*response.Result, error) {
+	results := make([]*response.Result, 0)
+	rules := make([]nativeRule, 0, len(nativeRules))
+
+	for _, rule := range nativeRules {
+		if options.Match(rule.id, nativeRuleTags) {
+			rules = append(rules, rule)
+		}
+	}
+
+	entropy := n.entropy && options.Match(highEntropyRuleID, nativeRuleTags)
+
+	log := scanResource.Logger()
+	err := scanResource.Walk(func(path string, reader io.Reader) error {
+		options.progress.fileDone()
+		bufReader := bufio.NewReader(reader)
+
+		binary, err := isBinary(bufReader)
+		if err != nil {
+			log.Error("could not read file", logger.String("path", path), logger.Err(err))
+			return nil
+		}
+
+		if binary {
+			log.Debug("skipping binary file", logger.String("path", path))
+			return nil
+		}
+
+		for lineNumber := 1; ; lineNumber++ {
+			line, err := bufReader.ReadString('\n')
+			if len(line) > 0 {
+				for _, result := range n.scanLine(scanResource, rules, entropy, path, lineNumber, strings.TrimRight(line, "\r\n")) {
+					results = options.collect(results, scanResource.EnrichResult(result))
+				}
+			}
+
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				log.Error("could not read file", logger.String("path", path), logger.Err(err))
+				return nil
+			}
+		}
+	})
+
+	return results, err
+}
+
+// scanLine runs the rules and entropy detection against a single line
+func (n *Native) scanLine(scanResource resource.Resource, rules []nativeRule, entropy bool, path string, lineNumber int, line string) []*response.Result {
+	var results []*response.Result
+	// matched tracks spans already reported so entropy detection doesn't
+	// report the same secret again
+	var matched [][]int
+
+	for _, rule := range rules {
+		for _, loc := range rule.regex.FindAllStringSubmatchIndex(line, -1) {
+			start, end := loc[2*rule.secretGroup], loc[2*rule.secretGroup+1]
+			if start < 0 {
+				continue
+			}
+
+			matched = append(matched, []int{start, end})
+			results = append(results, n.newResult(scanResource, path, lineNumber, line, loc[0], loc[1], start, end, rule.id, rule.description))
+		}
+	}
+
+	if !entropy {
+		return results
+	}
+
+	for _, loc := range entropyCandidateRegex.FindAllStringIndex(line, -1) {
+		start, end := loc[0], loc[1]
+		if end-start < n.entropyMinLength || overlaps(matched, start, end) {
+			continue
+		}
+
+		candidate := line[start:end]
+		if !strings.ContainsAny(candidate, "0123456789") || shannonEntropy(candidate) < n.entropyThreshold {
+			continue
+		}
+
+		results = append(results, n.newResult(scanResource, path, lineNumber, line, start, end, start, end, highEntropyRuleID, "High Entropy String"))
+	}
+
+	return results
+}
+
+func (n *Native) newResult(scanResource resource.Resource, path string, lineNumber int, line string, matchStart, matchEnd, secretStart, secretEnd int, ruleID, description string) *response.Result {
+	secret := line[secretStart:secretEnd]
+
+	return &response.Result{
+		// Be careful changing how this is generated, this could result in
+		// duplicate alerts
+		ID: id.ID(
+			scanResource.String(),
+			path,
+			fmt.Sprint(lineNumber),
+			fmt.Sprint(matchStart+1),
+			fmt.Sprint(matchEnd),
+			ruleID,
+		),
+		Secret:  secret,
+		Match:   line[matchStart:matchEnd],
+		Context: line,
+		Entropy: float32(shannonEntropy(secret)),
+		Notes:   map[string]string{},
+		Rule: response.Rule{
+			ID:          ruleID,
+			Description: description,
+			Tags:        nativeRuleTags,
+		},
+		Location: response.Location{
+			Path: path,
+			Start: response.Point{
+				Line:   lineNumber,
+				Column: matchStart + 1,
+			},
+			End: response.Point{
+				Line:   lineNumber,
+				Column: matchEnd,
+			},
+		},
+	}
+}
+
+// isBinary peeks at the start of the reader to detect binary files
+func isBinary(reader *bufio.Reader) (bool, error) {
+	header, err := reader.Peek(fileTypeHeaderSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+
+	mimetype, err := filetype.Match(header)
+	return err == nil && mimetype.MIME.Type == "application", nil
+}
+
+// overlaps returns true if start:end overlaps any of the spans
+func overlaps(spans [][]int, start, end int) bool {
+	for _, span := range spans {
+		if start < span[1] && span[0] < end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shannonEntropy returns the bits of entropy per character in the string
+func shannonEntropy(value string) float64 {
+	if len(value) == 0 {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	for _, char := range value {
+		counts[char]++
+	}
+
+	entropy := 0.0
+	length := float64(len(value))
+	for _, count := range counts {
+		freq := float64(count) / length
+		entropy -= freq * math.Log2(freq)
+	}
+
+	return entropy
+}
@@ -0,0 +1,198 @@
+package scanner
+
+import (
+	"os"
+	"time"
+
+	gitleaksconfig "github.com/zricethezav/gitleaks/v8/config"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// PatternsStatus describes the loaded patterns and where they came from
+type PatternsStatus struct {
+	Hash            string                `json:"hash"`
+	GitleaksVersion string                `json:"gitleaks_version"`
+	Rules           int                   `json:"rules"`
+	Error           string                `json:"error,omitempty"`
+	Sources         []PatternSourceStatus `json:"sources"`
+}
+
+// PatternSourceStatus describes one pattern source. The times are only set
+// when they're known.
+type PatternSourceStatus struct {
+	Name       string     `json:"name"`
+	Kind       string     `json:"kind"`
+	URL        string     `json:"url,omitempty"`
+	Path       string     `json:"path"`
+	Layers     int        `json:"layers"`
+	Autofetch  bool       `json:"autofetch"`
+	Signed     bool       `json:"signed"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	FetchedAt  *time.Time `json:"fetched_at,omitempty"`
+	CheckedAt  *time.Time `json:"checked_at,omitempty"`
+	// NeedsRefresh is true when refresh_after has passed for a url source
+	NeedsRefresh bool `json:"needs_refresh"`
+	// Expired is true when expired_after has passed for a url source
+	Expired bool `json:"expired"`
+	// Error is why the source couldn't be loaded the last time it was tried
+	Error string `json:"error,omitempty"`
+}
+
+// RuleInfo is a summary of a gitleaks rule for displaying
+type RuleInfo struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Regex       string   `json:"regex,omitempty"`
+	Path        string   `json:"path,omitempty"`
+	SecretGroup int      `json:"secret_group,omitempty"`
+	Entropy     float64  `json:"entropy,omitempty"`
+	Allowlists  int      `json:"allowlists,omitempty"`
+}
+
+// NewRuleInfo summarizes a gitleaks rule
+func NewRuleInfo(rule gitleaksconfig.Rule) *RuleInfo {
+	info := &RuleInfo{
+		ID:          rule.RuleID,
+		Description: rule.Description,
+		Tags:        rule.Tags,
+		Keywords:    rule.Keywords,
+		SecretGroup: rule.SecretGroup,
+		Entropy:     rule.Entropy,
+		Allowlists:  len(rule.Allowlists),
+	}
+
+	if rule.Regex != nil {
+		info.Regex = rule.Regex.String()
+	}
+
+	if rule.Path != nil {
+		info.Path = rule.Path.String()
+	}
+
+	return info
+}
+
+// Fetch fetches the patterns for every url source even if refresh_after
+// hasn't passed or autofetch is disabled, and then reloads the patterns
+func (p *Patterns) Fetch() error {
+	p.mutex.Lock()
+
+	if p.configErr != nil {
+		p.mutex.Unlock()
+		return p.configErr
+	}
+
+	for _, source := range p.sources {
+		if source.kind != patternSourceURL {
+			continue
+		}
+
+		log := logger.With()
+		_, err := source.fetchURL(log)
+		source.setLoadErr(log, err)
+
+		if err != nil {
+			if source.optional {
+				continue
+			}
+
+			p.mutex.Unlock()
+			return err
+		}
+	}
+
+	// Force the sources to be merged again
+	p.gitleaksConfig = nil
+	p.mutex.Unlock()
+
+	_, err := p.Gitleaks()
+	return err
+}
+
+// OnFetch sets a function that's called with the outcome each time a source
+// fetches its patterns
+func (p *Patterns) OnFetch(fn func(source string, err error)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, source := range p.sources {
+		source.onFetch = fn
+	}
+}
+
+// modTimes returns when each source's patterns were last written or
+// confirmed to be current. Unlike Status it never loads or fetches anything
+// and it doesn't wait for a fetch in progress. The sources and their paths
+// don't change after NewPatterns so the mutex isn't needed.
+func (p *Patterns) modTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(p.sources))
+	for _, source := range p.sources {
+		if fileInfo, err := os.Stat(source.path); err == nil {
+			modTimes[source.name] = fileInfo.ModTime()
+		}
+	}
+
+	return modTimes
+}
+
+// Status loads the patterns the same way a scan would and reports on them.
+// Errors loading the patterns are included in the status.
+func (p *Patterns) Status() *PatternsStatus {
+	cfg, err := p.Gitleaks()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	status := &PatternsStatus{
+		Hash:            p.gitleaksConfigHashString(),
+		GitleaksVersion: p.config.Gitleaks.Version,
+	}
+
+	if cfg != nil {
+		status.Rules = len(cfg.Rules)
+	}
+
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	for _, source := range p.sources {
+		sourceStatus := PatternSourceStatus{
+			Name:      source.name,
+			Kind:      source.kind,
+			URL:       source.url,
+			Path:      source.path,
+			Layers:    len(source.layers),
+			Autofetch: source.autofetch,
+			Signed:    source.verifier != nil,
+			Error:     source.loadErr,
+		}
+
+		if fileInfo, err := os.Stat(source.path); err == nil {
+			modTime := fileInfo.ModTime().UTC()
+			sourceStatus.ModifiedAt = &modTime
+		}
+
+		if source.kind == patternSourceURL {
+			sourceStatus.NeedsRefresh = modTimeExceeds(source.path, source.refreshAfter)
+			sourceStatus.Expired = modTimeExceeds(source.path, source.expiredAfter)
+
+			if metadata := readPatternMetadata(source.path); metadata != nil {
+				if !metadata.FetchedAt.IsZero() {
+					sourceStatus.FetchedAt = &metadata.FetchedAt
+				}
+
+				if !metadata.CheckedAt.IsZero() {
+					sourceStatus.CheckedAt = &metadata.CheckedAt
+				}
+			}
+		}
+
+		status.Sources = append(status.Sources, sourceStatus)
+	}
+
+	return status
+}
@@ -0,0 +1,54 @@
+package scanner
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	httpclient "github.com/leaktk/leaktk/pkg/http"
+)
+
+func TestPatternsFetchAndStatus(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = io.WriteString(w, mockConfig)
+	}))
+	defer ts.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Patterns.Server.URL = ts.URL
+	cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(t.TempDir(), "gitleaks.toml")
+	cfg.Scanner.Patterns.RefreshAfter = 60
+	cfg.Scanner.Patterns.ExpiredAfter = 120
+
+	patterns := NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient())
+	status := patterns.Status()
+	assert.Empty(t, status.Error)
+	assert.Equal(t, 1, status.Rules)
+	assert.Equal(t, "x.y.z", status.GitleaksVersion)
+	assert.Equal(t, patterns.GitleaksConfigHash(), status.Hash)
+	assert.Len(t, status.Sources, 1)
+	assert.Equal(t, "server", status.Sources[0].Name)
+	assert.Equal(t, 1, status.Sources[0].Layers)
+	assert.NotNil(t, status.Sources[0].FetchedAt)
+	assert.False(t, status.Sources[0].NeedsRefresh)
+	assert.False(t, status.Sources[0].Expired)
+	assert.Equal(t, 1, requests)
+
+	// Fetch ignores refresh_after
+	assert.NoError(t, patterns.Fetch())
+	assert.Equal(t, 2, requests)
+
+	gitleaksConfig, err := patterns.Gitleaks()
+	assert.NoError(t, err)
+	info := NewRuleInfo(gitleaksConfig.Rules["test-rule"])
+	assert.Equal(t, "test-rule", info.ID)
+	assert.Equal(t, "test-rule", info.Regex)
+}
@@ -2,20 +2,20 @@ package scanner
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
+	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/BurntSushi/toml"
 	gitleaksconfig "github.com/zricethezav/gitleaks/v8/config"
 
 	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/response"
 )
 
 // Patterns acts as an abstraction for fetching different scanner patterns
@@ -26,131 +26,317 @@ type Patterns struct {
 	gitleaksConfigHash [32]byte
 	gitleaksConfig     *gitleaksconfig.Config
 	mutex              sync.Mutex
+	// ruleIDs are the rule IDs in gitleaksConfig. They can be read without
+	// the mutex, which is held while patterns are fetched.
+	ruleIDs atomic.Pointer[map[string]struct{}]
+	// sources are layered in order starting with the pattern server
+	sources []*patternSource
+	// configErr is set when the patterns config is unusable (e.g. invalid
+	// trusted keys) so that nothing is loaded without the expected checks
+	configErr error
 }
 
 // NewPatterns returns a configured instance of Patterns
 func NewPatterns(cfg *config.Patterns, client *http.Client) *Patterns {
-	return &Patterns{
+	patterns := &Patterns{
 		client: client,
 		config: cfg,
 	}
-}
 
-func (p *Patterns) fetchGitleaksConfig() (string, error) {
-	logger.Info("fetching gitleaks patterns")
-	patternURL, err := url.JoinPath(
-		p.config.Server.URL, "patterns", "gitleaks", p.config.Gitleaks.Version,
-	)
-
-	logger.Debug("patterns url: url=%q", patternURL)
-	if err != nil {
-		return "", err
+	var verifier *SignatureVerifier
+	if len(cfg.TrustedKeys) > 0 {
+		var err error
+		if verifier, err = NewSignatureVerifier(cfg.TrustedKeys); err != nil {
+			logger.Error("could not load trusted keys: error=%q", err)
+			patterns.configErr = fmt.Errorf("could not load trusted keys: error=%q", err)
+		}
 	}
 
-	request, err := http.NewRequest("GET", patternURL, nil)
-	if err != nil {
-		return "", err
-	}
+	// An invalid URL is reported when fetching
+	serverURL, _ := patterns.gitleaksConfigURL()
+
+	patterns.sources = append(patterns.sources, &patternSource{
+		name:           "server",
+		url:            serverURL,
+		kind:           patternSourceURL,
+		authToken:      cfg.Server.AuthToken,
+		path:           cfg.Gitleaks.ConfigPath,
+		autofetch:      cfg.Autofetch,
+		refreshAfter:   cfg.RefreshAfter,
+		expiredAfter:   cfg.ExpiredAfter,
+		fetch:          patterns.fetchGitleaksConfig,
+		fetchSignature: patterns.fetchGitleaksSignature,
+		verifier:       verifier,
+	})
+
+	for _, sourceCfg := range cfg.Sources {
+		source, err := newPatternSource(cfg, sourceCfg, client, verifier)
+		if err != nil {
+			logger.Error("could not configure pattern source: name=%q error=%q", sourceCfg.Name, err)
+			continue
+		}
 
-	if len(p.config.Server.AuthToken) > 0 {
-		logger.Debug("setting authorization header")
-		request.Header.Add(
-			"Authorization",
-			fmt.Sprintf("Bearer %s", p.config.Server.AuthToken),
-		)
+		patterns.sources = append(patterns.sources, source)
 	}
 
-	response, err := p.client.Do(request)
-	if err != nil {
-		return "", err
-	}
-	defer response.Body.Close()
+	return patterns
+}
 
-	if response.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: status_code=%d", response.StatusCode)
-	}
+func (p *Patterns) gitleaksConfigURL() (string, error) {
+	return url.JoinPath(
+		p.config.Server.URL, "patterns", "gitleaks", p.config.Gitleaks.Version,
+	)
+}
+
+func (p *Patterns) fetchGitleaksConfig(log *logger.Logger, metadata *patternMetadata) (*patternResponse, error) {
+	log.Info("fetching gitleaks patterns")
+	patternURL, err := p.gitleaksConfigURL()
 
-	body, err := io.ReadAll(response.Body)
+	log.Debug("patterns url", logger.String("url", patternURL))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(body), err
+	return fetchPatternsIfModified(p.client, patternURL, p.config.Server.AuthToken, metadata)
 }
 
-// gitleaksConfigModTimeExceeds returns true if the file is older than
-// `modTimeLimit` seconds
-func (p *Patterns) gitleaksConfigModTimeExceeds(modTimeLimit uint32) bool {
-	if fileInfo, err := os.Stat(p.config.Gitleaks.ConfigPath); err == nil {
-		return uint32(time.Since(fileInfo.ModTime()).Seconds()) > modTimeLimit
+// fetchGitleaksSignature fetches the detached signature that is served next
+// to the gitleaks config
+func (p *Patterns) fetchGitleaksSignature() ([]byte, error) {
+	patternURL, err := p.gitleaksConfigURL()
+	if err != nil {
+		return nil, err
 	}
 
-	return true
+	signature, err := fetchPatterns(p.client, patternURL+signatureExt, p.config.Server.AuthToken)
+	return []byte(signature), err
 }
 
 // Gitleaks returns a Gitleaks config object if it's able to
 func (p *Patterns) Gitleaks() (*gitleaksconfig.Config, error) {
+	return p.loadGitleaks(logger.With())
+}
+
+// loadGitleaks is Gitleaks with the loading logged to log so a request's
+// logs show why its patterns were fetched or skipped
+func (p *Patterns) loadGitleaks(log *logger.Logger) (*gitleaksconfig.Config, error) {
 	// Lock since this updates the value of p.gitleaksConfig on the fly
 	// and updates files on the filesystem
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	if p.config.Autofetch && p.gitleaksConfigModTimeExceeds(p.config.RefreshAfter) {
-		rawConfig, err := p.fetchGitleaksConfig()
+	if p.configErr != nil {
+		return nil, p.configErr
+	}
+
+	changed := false
+	for _, source := range p.sources {
+		sourceChanged, err := source.load(log)
+		source.setLoadErr(log, err)
+
 		if err != nil {
+			// A broken extra source shouldn't stop every scan so use what it
+			// last loaded (if anything) and keep going
+			if source.optional {
+				continue
+			}
+
 			return p.gitleaksConfig, err
 		}
 
-		p.gitleaksConfig, err = ParseGitleaksConfig(rawConfig)
+		changed = changed || sourceChanged
+	}
+
+	if changed || p.gitleaksConfig == nil {
+		cfg, hash, err := p.mergeSources(log)
 		if err != nil {
-			logger.Debug("fetched config:\n%s", rawConfig)
-			return p.gitleaksConfig, fmt.Errorf("could not parse config: error=%q", err)
+			return p.gitleaksConfig, err
 		}
 
-		if err := os.MkdirAll(filepath.Dir(p.config.Gitleaks.ConfigPath), 0700); err != nil {
-			return p.gitleaksConfig, fmt.Errorf("could not create config dir: error=%q", err)
+		p.gitleaksConfig = cfg
+		p.updateGitleaksConfigHash(log, hash)
+
+		ruleIDs := make(map[string]struct{}, len(cfg.Rules))
+		for ruleID := range cfg.Rules {
+			ruleIDs[ruleID] = struct{}{}
+		}
+
+		p.ruleIDs.Store(&ruleIDs)
+	}
+
+	return p.gitleaksConfig, nil
+}
+
+// hasRule returns true if the rule is in the patterns that were last loaded
+func (p *Patterns) hasRule(ruleID string) bool {
+	ruleIDs := p.ruleIDs.Load()
+	if ruleIDs == nil {
+		return false
+	}
+
+	_, ok := (*ruleIDs)[ruleID]
+	return ok
+}
+
+// mergeSources parses each layer from each source and merges them in order.
+// Layers from extra sources that can't be parsed are logged and skipped. The
+// hash covers the layers that were merged in the same order.
+func (p *Patterns) mergeSources(log *logger.Logger) (*gitleaksconfig.Config, [32]byte, error) {
+	var merged *gitleaksconfig.Config
+	var digests [][32]byte
+	sourceHashes := make([][32]byte, len(p.sources))
+
+	for i, source := range p.sources {
+		var sourceDigests [][32]byte
+
+		for _, layer := range source.layers {
+			cfg, err := ParseGitleaksConfig(string(layer.raw))
+			if err != nil {
+				log.Debug("loaded config", logger.String("config", string(layer.raw)))
+
+				if source.optional {
+					log.Error("skipping pattern layer", logger.String("source", source.name), logger.String("layer", layer.name), logger.Err(err))
+					continue
+				}
+
+				return nil, [32]byte{}, fmt.Errorf("could not parse config: source=%q layer=%q error=%q", source.name, layer.name, err)
+			}
+
+			digest := sha256.Sum256(layer.raw)
+			digests = append(digests, digest)
+			sourceDigests = append(sourceDigests, digest)
+
+			if merged == nil {
+				merged = cfg
+				continue
+			}
+
+			if err := layerGitleaksConfig(log, merged, cfg, p.config.RuleCollision, layer.name); err != nil {
+				return nil, [32]byte{}, err
+			}
 		}
 
-		// only write the config after parsing it, that way we don't break a good
-		// existing config if the server returns an invalid response
-		if err := os.WriteFile(p.config.Gitleaks.ConfigPath, []byte(rawConfig), 0600); err != nil {
-			return p.gitleaksConfig, fmt.Errorf("could not write config: path=%q error=%q", p.config.Gitleaks.ConfigPath, err)
+		if len(sourceDigests) > 0 {
+			sourceHashes[i] = layersHash(sourceDigests)
 		}
-		p.updateGitleaksConfigHash(sha256.Sum256([]byte(rawConfig)))
-	} else if p.gitleaksConfig == nil {
-		if p.gitleaksConfigModTimeExceeds(p.config.ExpiredAfter) {
-			return nil, fmt.Errorf(
-				"gitleaks config is expired and autofetch is disabled: config_path=%q",
-				p.config.Gitleaks.ConfigPath,
-			)
+	}
+
+	if merged == nil {
+		return nil, [32]byte{}, errors.New("no gitleaks patterns loaded")
+	}
+
+	// Only update the source hashes once the merge worked so they always
+	// match the merged config
+	for i, source := range p.sources {
+		source.hash = sourceHashes[i]
+	}
+
+	return merged, layersHash(digests), nil
+}
+
+// layersHash combines the digests of the layers. A single layer's hash is
+// the same as the hash of its file. Since each digest is a fixed size,
+// different splits of the same bytes across layers get different hashes.
+func layersHash(digests [][32]byte) [32]byte {
+	if len(digests) == 1 {
+		return digests[0]
+	}
+
+	hash := sha256.New()
+	for _, digest := range digests {
+		hash.Write(digest[:])
+	}
+
+	return [32]byte(hash.Sum(nil))
+}
+
+// layerGitleaksConfig adds the rules and allowlists from layer to cfg. How a
+// rule with the same ID as an existing one is handled depends on collision:
+// "replace" (the default) uses the layer's rule, "keep" keeps the existing one
+// and "error" refuses to load the patterns.
+func layerGitleaksConfig(log *logger.Logger, cfg, layer *gitleaksconfig.Config, collision, layerName string) error {
+	cfg.Allowlists = append(cfg.Allowlists, layer.Allowlists...)
+
+	for _, ruleID := range layer.OrderedRules {
+		rule, ok := layer.Rules[ruleID]
+		if !ok {
+			continue
 		}
 
-		rawConfig, err := os.ReadFile(p.config.Gitleaks.ConfigPath)
-		if err != nil {
-			return p.gitleaksConfig, err
+		if _, exists := cfg.Rules[ruleID]; exists {
+			switch strings.ToLower(collision) {
+			case "keep":
+				log.Debug("keeping existing rule", logger.String("rule_id", ruleID), logger.String("layer", layerName))
+				continue
+			case "error":
+				return fmt.Errorf("rule ID collision: rule_id=%q layer=%q", ruleID, layerName)
+			default:
+				log.Debug("replacing existing rule", logger.String("rule_id", ruleID), logger.String("layer", layerName))
+			}
+		} else {
+			cfg.OrderedRules = append(cfg.OrderedRules, ruleID)
 		}
 
-		p.gitleaksConfig, err = ParseGitleaksConfig(string(rawConfig))
-		if err != nil {
-			logger.Debug("loaded config:\n%s\n", rawConfig)
-			return p.gitleaksConfig, fmt.Errorf("could not parse config: error=%q", err)
+		cfg.Rules[ruleID] = rule
+	}
+
+	// Rebuild the keywords since replaced rules may have dropped some
+	cfg.Keywords = make(map[string]struct{})
+	for _, rule := range cfg.Rules {
+		for _, keyword := range rule.Keywords {
+			cfg.Keywords[strings.ToLower(keyword)] = struct{}{}
 		}
-		p.updateGitleaksConfigHash(sha256.Sum256(rawConfig))
 	}
 
-	return p.gitleaksConfig, nil
+	return nil
 }
 
 // GitleaksConfigHash returns the sha256 hash for the current gitleaks config
 func (p *Patterns) GitleaksConfigHash() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.gitleaksConfigHashString()
+}
+
+// gitleaksConfigHashString formats the hash. The caller must hold the mutex.
+func (p *Patterns) gitleaksConfigHashString() string {
 	return fmt.Sprintf("%x", p.gitleaksConfigHash)
 }
 
+// Info identifies the loaded patterns for responses
+func (p *Patterns) Info() *response.PatternsInfo {
+	// An invalid URL is reported when fetching
+	patternURL, _ := p.gitleaksConfigURL()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	info := &response.PatternsInfo{
+		URL:             patternURL,
+		GitleaksVersion: p.config.Gitleaks.Version,
+		Hash:            p.gitleaksConfigHashString(),
+		Sources:         make([]response.PatternSourceInfo, 0, len(p.sources)),
+	}
+
+	for _, source := range p.sources {
+		info.Sources = append(info.Sources, response.PatternSourceInfo{
+			Name: source.name,
+			Kind: source.kind,
+			URL:  source.url,
+			Path: source.path,
+			Hash: fmt.Sprintf("%x", source.hash),
+		})
+	}
+
+	return info
+}
+
 // updateGitleaksConfigHash updated value and logs only on a change
-func (p *Patterns) updateGitleaksConfigHash(hash [32]byte) {
+func (p *Patterns) updateGitleaksConfigHash(log *logger.Logger, hash [32]byte) {
 	if hash != p.gitleaksConfigHash {
 		p.gitleaksConfigHash = hash
-		logger.Info("updated gitleaks patterns: hash=%s", p.GitleaksConfigHash())
+		log.Info("updated gitleaks patterns", logger.String("hash", p.gitleaksConfigHashString()))
 	}
 }
 
@@ -13,6 +13,7 @@ import (
 
 	"github.com/leaktk/leaktk/pkg/config"
 	httpclient "github.com/leaktk/leaktk/pkg/http"
+	"github.com/leaktk/leaktk/pkg/logger"
 )
 
 const mockConfig = `
@@ -48,9 +49,9 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 		client := httpclient.NewClient()
 		p := NewPatterns(&cfg.Scanner.Patterns, client)
 
-		rawConfig, err := p.fetchGitleaksConfig()
+		response, err := p.fetchGitleaksConfig(logger.With(), nil)
 		assert.NoError(t, err)
-		assert.Contains(t, rawConfig, "test-rule")
+		assert.Contains(t, response.Raw, "test-rule")
 	})
 
 	t.Run("InvalidURL", func(t *testing.T) {
@@ -61,7 +62,7 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 		client := httpclient.NewClient()
 		p := NewPatterns(&cfg.Scanner.Patterns, client)
 
-		_, err := p.fetchGitleaksConfig()
+		_, err := p.fetchGitleaksConfig(logger.With(), nil)
 		assert.Error(t, err)
 	})
 
@@ -79,7 +80,7 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 		client := httpclient.NewClient()
 		p := NewPatterns(&cfg.Scanner.Patterns, client)
 
-		_, err := p.fetchGitleaksConfig()
+		_, err := p.fetchGitleaksConfig(logger.With(), nil)
 		assert.Error(t, err)
 	})
 
@@ -103,13 +104,13 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 		client := httpclient.NewClient()
 		p := NewPatterns(&cfg.Scanner.Patterns, client)
 
-		rawConfig, err := p.fetchGitleaksConfig()
+		response, err := p.fetchGitleaksConfig(logger.With(), nil)
 		assert.NoError(t, err)
-		assert.Contains(t, rawConfig, "test-rule")
+		assert.Contains(t, response.Raw, "test-rule")
 	})
 }
 
-func TestGitleaksConfigModTimeExceeds(t *testing.T) {
+func TestModTimeExceeds(t *testing.T) {
 	t.Run("FileExistsAndOlderThanLimit", func(t *testing.T) {
 		tempDir := t.TempDir()
 
@@ -121,47 +122,23 @@ func TestGitleaksConfigModTimeExceeds(t *testing.T) {
 		err = os.Chtimes(tempFilePath, time.Now().Add(-10*time.Second), time.Now().Add(-10*time.Second))
 		assert.NoError(t, err)
 
-		// Create a Patterns instance with the temporary file path
-		cfg := config.DefaultConfig()
-		cfg.Scanner.Patterns.Gitleaks.ConfigPath = tempFilePath
-
-		patterns := &Patterns{
-			config: &cfg.Scanner.Patterns,
-		}
-
 		// Test with a modTimeLimit of 5 seconds
-		assert.True(t, patterns.gitleaksConfigModTimeExceeds(5))
+		assert.True(t, modTimeExceeds(tempFilePath, 5))
 
 		// Test with a modTimeLimit of 15 seconds
-		assert.False(t, patterns.gitleaksConfigModTimeExceeds(15))
+		assert.False(t, modTimeExceeds(tempFilePath, 15))
 	})
 
 	t.Run("FileDoesNotExist", func(t *testing.T) {
-		cfg := config.DefaultConfig()
-		cfg.Scanner.Patterns.Gitleaks.ConfigPath = "/path/to/nonexistent/file.toml"
-
-		// Create a Patterns instance with a non-existent file path
-		patterns := &Patterns{
-			config: &cfg.Scanner.Patterns,
-		}
-
 		// Test with any modTimeLimit
-		assert.True(t, patterns.gitleaksConfigModTimeExceeds(5))
-		assert.True(t, patterns.gitleaksConfigModTimeExceeds(15))
+		assert.True(t, modTimeExceeds("/path/to/nonexistent/file.toml", 5))
+		assert.True(t, modTimeExceeds("/path/to/nonexistent/file.toml", 15))
 	})
 
 	t.Run("FileExistsButErrorOnStat", func(t *testing.T) {
-		// Create a Patterns instance with a file path that causes an error on Stat
-		cfg := config.DefaultConfig()
-		cfg.Scanner.Patterns.Gitleaks.ConfigPath = "/dev/zero"
-
-		patterns := &Patterns{
-			config: &cfg.Scanner.Patterns,
-		}
-
 		// Test with any modTimeLimit
-		assert.True(t, patterns.gitleaksConfigModTimeExceeds(5))
-		assert.True(t, patterns.gitleaksConfigModTimeExceeds(15))
+		assert.True(t, modTimeExceeds("/dev/zero", 5))
+		assert.True(t, modTimeExceeds("/dev/zero", 15))
 	})
 }
 
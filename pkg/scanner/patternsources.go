@@ -0,0 +1,458 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/fs"
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+const (
+	// patternSourceURL fetches a gitleaks config from a URL and caches it
+	patternSourceURL = "url"
+	// patternSourceFile reads a local gitleaks config file
+	patternSourceFile = "file"
+	// patternSourceDir reads each *.toml file in a local directory in order
+	patternSourceDir = "dir"
+	// signatureExt is added to pattern URLs and cache paths for their
+	// detached signatures
+	signatureExt = ".sig"
+	// metadataExt is added to cache paths for the fetch metadata
+	metadataExt = ".meta.json"
+)
+
+// patternMetadata is stored next to cached patterns to make conditional
+// requests and report when the patterns were fetched
+type patternMetadata struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// patternResponse is the result of fetching patterns. If NotModified is true
+// the cached patterns are still current and Raw is empty.
+type patternResponse struct {
+	Raw          string
+	NotModified  bool
+	ETag         string
+	LastModified string
+}
+
+// patternLayer is one raw gitleaks config from a source
+type patternLayer struct {
+	name string
+	raw  []byte
+}
+
+// patternSource is somewhere gitleaks patterns are loaded from
+type patternSource struct {
+	name string
+	kind string
+	// path is the cache path for url sources and the file or directory for
+	// the others
+	path         string
+	url          string
+	authToken    string
+	autofetch    bool
+	refreshAfter uint32
+	expiredAfter uint32
+	fetch        func(log *logger.Logger, metadata *patternMetadata) (*patternResponse, error)
+	// When verifier is set, fetched and cached patterns must have a valid
+	// signature from fetchSignature or the cached signature file
+	fetchSignature func() ([]byte, error)
+	verifier       *SignatureVerifier
+	// onFetch is called with the outcome of each fetch when it's set
+	onFetch func(source string, err error)
+	// optional sources are skipped when they can't be loaded instead of
+	// failing the scan
+	optional bool
+	// loadErr is the error from the last load or empty if it worked
+	loadErr string
+	// hash covers the layers from this source that were last merged
+	hash [32]byte
+
+	layers []patternLayer
+	// state tracks the file sizes and mod times for local sources so they're
+	// only reloaded when they change
+	state string
+}
+
+// newPatternSource configures an extra pattern source. Unset refresh and
+// expiration settings come from the main patterns config.
+func newPatternSource(cfg *config.Patterns, sourceCfg config.PatternSource, client *http.Client, verifier *SignatureVerifier) (*patternSource, error) {
+	source := &patternSource{
+		name:         sourceCfg.Name,
+		kind:         strings.ToLower(sourceCfg.Kind),
+		path:         sourceCfg.Path,
+		autofetch:    cfg.Autofetch && !sourceCfg.DisableAutofetch,
+		refreshAfter: sourceCfg.RefreshAfter,
+		expiredAfter: sourceCfg.ExpiredAfter,
+		optional:     true,
+	}
+
+	if source.refreshAfter == 0 {
+		source.refreshAfter = cfg.RefreshAfter
+	}
+
+	if source.expiredAfter == 0 {
+		source.expiredAfter = cfg.ExpiredAfter
+	}
+
+	switch source.kind {
+	case patternSourceURL:
+		if len(sourceCfg.Name) == 0 || len(sourceCfg.URL) == 0 {
+			return nil, errors.New("url pattern sources require a name and url")
+		}
+
+		source.path = sourceCfg.ConfigPath
+		source.url = sourceCfg.URL
+		source.authToken = sourceCfg.AuthToken
+		source.fetch = func(log *logger.Logger, metadata *patternMetadata) (*patternResponse, error) {
+			log.Info("fetching gitleaks patterns", logger.String("source", source.name))
+			return fetchPatternsIfModified(client, source.url, source.authToken, metadata)
+		}
+		source.fetchSignature = func() ([]byte, error) {
+			signature, err := fetchPatterns(client, source.url+signatureExt, source.authToken)
+			return []byte(signature), err
+		}
+		source.verifier = verifier
+	case patternSourceFile, patternSourceDir:
+		if len(sourceCfg.Path) == 0 {
+			return nil, fmt.Errorf("%s pattern sources require a path", source.kind)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported pattern source kind: kind=%q", sourceCfg.Kind)
+	}
+
+	return source, nil
+}
+
+// load refreshes the source's layers if needed and returns true if they
+// changed
+func (s *patternSource) load(log *logger.Logger) (bool, error) {
+	switch s.kind {
+	case patternSourceURL:
+		return s.loadURL(log)
+	case patternSourceFile:
+		return s.loadFiles([]string{s.path})
+	case patternSourceDir:
+		paths, err := filepath.Glob(filepath.Join(s.path, "*.toml"))
+		if err != nil {
+			return false, err
+		}
+
+		// Glob sorts the paths so the layer order is stable
+		return s.loadFiles(paths)
+	}
+
+	return false, fmt.Errorf("unsupported pattern source kind: kind=%q", s.kind)
+}
+
+// setLoadErr records the outcome of a load and logs optional sources when it
+// changes since they don't fail the scan
+func (s *patternSource) setLoadErr(log *logger.Logger, err error) {
+	loadErr := ""
+	if err != nil {
+		loadErr = err.Error()
+	}
+
+	if s.optional && loadErr != s.loadErr {
+		if err != nil {
+			log.Error("skipping pattern source", logger.String("source", s.name), logger.Err(err))
+		} else if len(s.loadErr) > 0 {
+			log.Info("pattern source recovered", logger.String("source", s.name))
+		}
+	}
+
+	s.loadErr = loadErr
+}
+
+// loadURL fetches the patterns when the cache needs a refresh and otherwise
+// falls back to the cache
+func (s *patternSource) loadURL(log *logger.Logger) (bool, error) {
+	if s.autofetch && modTimeExceeds(s.path, s.refreshAfter) {
+		return s.fetchURL(log)
+	}
+
+	if len(s.layers) > 0 {
+		return false, nil
+	}
+
+	return s.loadCache()
+}
+
+// fetchURL fetches the patterns, verifies them and updates the cache
+func (s *patternSource) fetchURL(log *logger.Logger) (changed bool, err error) {
+	if s.onFetch != nil {
+		defer func() { s.onFetch(s.name, err) }()
+	}
+
+	// Only make a conditional request if there's a cache to fall back on
+	var metadata *patternMetadata
+	if fs.FileExists(s.path) {
+		metadata = readPatternMetadata(s.path)
+	}
+
+	response, err := s.fetch(log, metadata)
+	if err != nil {
+		return false, err
+	}
+
+	if response.NotModified {
+		return s.notModified(log, metadata)
+	}
+
+	rawConfig := response.Raw
+
+	var signature []byte
+	if s.verifier != nil {
+		if signature, err = s.fetchSignature(); err != nil {
+			return false, fmt.Errorf("could not fetch pattern signature: source=%q error=%q", s.name, err)
+		}
+
+		// Verify before parsing or caching so tampered patterns never
+		// replace a good cache
+		if err := s.verifier.Verify([]byte(rawConfig), signature); err != nil {
+			return false, fmt.Errorf("could not verify patterns: source=%q error=%q", s.name, err)
+		}
+	}
+
+	if _, err := ParseGitleaksConfig(rawConfig); err != nil {
+		log.Debug("fetched config", logger.String("config", rawConfig))
+		return false, fmt.Errorf("could not parse config: source=%q error=%q", s.name, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return false, fmt.Errorf("could not create config dir: error=%q", err)
+	}
+
+	// The signature is written first so a failed config write leaves a
+	// cache that fails verification instead of one that passes
+	if s.verifier != nil {
+		if err := os.WriteFile(s.path+signatureExt, signature, 0600); err != nil {
+			return false, fmt.Errorf("could not write signature: path=%q error=%q", s.path+signatureExt, err)
+		}
+	}
+
+	// only write the config after parsing it, that way we don't break a good
+	// existing config if the server returns an invalid response
+	if err := os.WriteFile(s.path, []byte(rawConfig), 0600); err != nil {
+		return false, fmt.Errorf("could not write config: path=%q error=%q", s.path, err)
+	}
+
+	now := time.Now().UTC()
+	writePatternMetadata(s.path, &patternMetadata{
+		URL:          s.url,
+		ETag:         response.ETag,
+		LastModified: response.LastModified,
+		FetchedAt:    now,
+		CheckedAt:    now,
+	})
+
+	return s.setLayers([]patternLayer{{name: s.name, raw: []byte(rawConfig)}}), nil
+}
+
+// notModified marks the cache as fresh after the server says it hasn't
+// changed
+func (s *patternSource) notModified(log *logger.Logger, metadata *patternMetadata) (bool, error) {
+	log.Debug("patterns not modified", logger.String("source", s.name))
+
+	// The mod time is what refresh_after and expired_after are based on
+	now := time.Now()
+	if err := os.Chtimes(s.path, now, now); err != nil {
+		return false, fmt.Errorf("could not update config mod time: path=%q error=%q", s.path, err)
+	}
+
+	metadata.CheckedAt = now.UTC()
+	writePatternMetadata(s.path, metadata)
+
+	if len(s.layers) > 0 {
+		return false, nil
+	}
+
+	return s.loadCache()
+}
+
+// loadCache reads the cached patterns as long as they haven't expired
+func (s *patternSource) loadCache() (bool, error) {
+	if modTimeExceeds(s.path, s.expiredAfter) {
+		return false, fmt.Errorf(
+			"gitleaks config is expired and autofetch is disabled: config_path=%q",
+			s.path,
+		)
+	}
+
+	rawConfig, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, err
+	}
+
+	if s.verifier != nil {
+		signature, err := os.ReadFile(s.path + signatureExt)
+		if err != nil {
+			return false, fmt.Errorf("could not read cached pattern signature: source=%q error=%q", s.name, err)
+		}
+
+		if err := s.verifier.Verify(rawConfig, signature); err != nil {
+			return false, fmt.Errorf("could not verify cached patterns: source=%q error=%q", s.name, err)
+		}
+	}
+
+	return s.setLayers([]patternLayer{{name: s.name, raw: rawConfig}}), nil
+}
+
+// loadFiles reads the files if any of them changed since the last load
+func (s *patternSource) loadFiles(paths []string) (bool, error) {
+	var state strings.Builder
+	for _, path := range paths {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return false, fmt.Errorf("could not read pattern source: source=%q error=%q", s.name, err)
+		}
+
+		fmt.Fprintf(&state, "%s:%d:%d\n", path, fileInfo.Size(), fileInfo.ModTime().UnixNano())
+	}
+
+	if state.String() == s.state && len(s.layers) > 0 {
+		return false, nil
+	}
+
+	layers := make([]patternLayer, 0, len(paths))
+	for _, path := range paths {
+		rawConfig, err := os.ReadFile(path)
+		if err != nil {
+			return false, fmt.Errorf("could not read pattern source: source=%q error=%q", s.name, err)
+		}
+
+		layers = append(layers, patternLayer{name: path, raw: rawConfig})
+	}
+
+	s.state = state.String()
+	return s.setLayers(layers), nil
+}
+
+// setLayers updates the layers and returns true if they changed
+func (s *patternSource) setLayers(layers []patternLayer) bool {
+	changed := !slices.EqualFunc(s.layers, layers, func(a, b patternLayer) bool {
+		return a.name == b.name && bytes.Equal(a.raw, b.raw)
+	})
+
+	s.layers = layers
+	return changed
+}
+
+// fetchPatterns downloads a pattern file with an optional bearer token
+func fetchPatterns(client *http.Client, patternURL, authToken string) (string, error) {
+	response, err := fetchPatternsIfModified(client, patternURL, authToken, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Raw, nil
+}
+
+// fetchPatternsIfModified downloads a pattern file unless the metadata from
+// the last fetch shows that it hasn't changed
+func fetchPatternsIfModified(client *http.Client, patternURL, authToken string, metadata *patternMetadata) (*patternResponse, error) {
+	request, err := http.NewRequest("GET", patternURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only trust the metadata if it was for the same URL
+	if metadata != nil && metadata.URL == patternURL {
+		if len(metadata.ETag) > 0 {
+			request.Header.Set("If-None-Match", metadata.ETag)
+		}
+
+		if len(metadata.LastModified) > 0 {
+			request.Header.Set("If-Modified-Since", metadata.LastModified)
+		}
+	}
+
+	if len(authToken) > 0 {
+		logger.Debug("setting authorization header")
+		request.Header.Add(
+			"Authorization",
+			fmt.Sprintf("Bearer %s", authToken),
+		)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && request.Header.Get("If-None-Match")+request.Header.Get("If-Modified-Since") != "" {
+		return &patternResponse{NotModified: true}, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: status_code=%d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &patternResponse{
+		Raw:          string(body),
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// readPatternMetadata returns the metadata for the cached patterns at path
+// or nil if there isn't any
+func readPatternMetadata(path string) *patternMetadata {
+	data, err := os.ReadFile(path + metadataExt)
+	if err != nil {
+		return nil
+	}
+
+	var metadata patternMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		logger.Warning("could not parse pattern metadata: path=%q error=%q", path+metadataExt, err)
+		return nil
+	}
+
+	return &metadata
+}
+
+// writePatternMetadata saves the metadata next to the cached patterns. The
+// metadata is only an optimization so failures are logged and ignored.
+func writePatternMetadata(path string, metadata *patternMetadata) {
+	data, err := json.Marshal(metadata)
+	if err == nil {
+		err = os.WriteFile(path+metadataExt, data, 0600)
+	}
+
+	if err != nil {
+		logger.Warning("could not write pattern metadata: path=%q error=%q", path+metadataExt, err)
+	}
+}
+
+// modTimeExceeds returns true if the file is older than `modTimeLimit`
+// seconds or can't be checked
+func modTimeExceeds(path string, modTimeLimit uint32) bool {
+	if fileInfo, err := os.Stat(path); err == nil {
+		return uint32(time.Since(fileInfo.ModTime()).Seconds()) > modTimeLimit
+	}
+
+	return true
+}
@@ -0,0 +1,200 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	httpclient "github.com/leaktk/leaktk/pkg/http"
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+const mockInternalConfig = `
+[[rules]]
+id = "internal-token"
+regex = '''itk_[0-9a-f]{16}'''
+keywords = ["itk_"]
+
+[[rules]]
+id = "test-rule"
+description = "internal version of test-rule"
+regex = '''internal-test-rule'''
+`
+
+const mockOverridesConfig = `
+[allowlist]
+paths = ['''fixtures''']
+`
+
+func TestPatternSources(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/patterns/gitleaks/x.y.z":
+			_, _ = io.WriteString(w, mockConfig)
+		case "/internal.toml":
+			assert.Equal(t, "Bearer internal-token", r.Header.Get("Authorization"))
+			_, _ = io.WriteString(w, mockInternalConfig)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	getPatterns := func(t *testing.T, collision string) (*Patterns, string) {
+		tempDir := t.TempDir()
+		overridesDir := filepath.Join(tempDir, "overrides.d")
+		assert.NoError(t, os.MkdirAll(overridesDir, 0700))
+		assert.NoError(t, os.WriteFile(filepath.Join(overridesDir, "10-paths.toml"), []byte(mockOverridesConfig), 0600))
+
+		cfg := config.DefaultConfig()
+		cfg.Scanner.Patterns.Server.URL = ts.URL
+		cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
+		cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(tempDir, "gitleaks.toml")
+		cfg.Scanner.Patterns.RuleCollision = collision
+		cfg.Scanner.Patterns.Sources = []config.PatternSource{
+			{
+				Name:       "internal",
+				Kind:       "url",
+				URL:        ts.URL + "/internal.toml",
+				AuthToken:  "internal-token",
+				ConfigPath: filepath.Join(tempDir, "internal.toml"),
+			},
+			{
+				Name: "overrides",
+				Kind: "dir",
+				Path: overridesDir,
+			},
+		}
+
+		return NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient()), overridesDir
+	}
+
+	t.Run("Merge", func(t *testing.T) {
+		patterns, _ := getPatterns(t, "")
+		cfg, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"test-rule", "internal-token"}, cfg.OrderedRules)
+		// Later sources replace rules by default
+		assert.Equal(t, "internal version of test-rule", cfg.Rules["test-rule"].Description)
+		assert.Contains(t, cfg.Keywords, "itk_")
+		assert.Len(t, cfg.Allowlists, 2)
+
+		// The internal patterns were cached
+		data, err := os.ReadFile(patterns.sources[1].path)
+		assert.NoError(t, err)
+		assert.Equal(t, mockInternalConfig, string(data))
+
+		// The hash covers every layer
+		assert.NotEqual(t, "9c88490b8b230ef6cf0d25b23a63679557cbe8cca1cc6703e55ca9d52331d0a9", patterns.GitleaksConfigHash())
+	})
+
+	t.Run("Info", func(t *testing.T) {
+		patterns, overridesDir := getPatterns(t, "")
+		_, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+
+		info := patterns.Info()
+		assert.Equal(t, patterns.GitleaksConfigHash(), info.Hash)
+		assert.Len(t, info.Sources, 3)
+
+		// A source with one layer has the hash of its file
+		assert.Equal(t, "server", info.Sources[0].Name)
+		assert.Equal(t, "9c88490b8b230ef6cf0d25b23a63679557cbe8cca1cc6703e55ca9d52331d0a9", info.Sources[0].Hash)
+		assert.Equal(t, ts.URL+"/internal.toml", info.Sources[1].URL)
+		assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte(mockInternalConfig))), info.Sources[1].Hash)
+		assert.Equal(t, "dir", info.Sources[2].Kind)
+		assert.Equal(t, overridesDir, info.Sources[2].Path)
+		assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte(mockOverridesConfig))), info.Sources[2].Hash)
+	})
+
+	t.Run("KeepOnCollision", func(t *testing.T) {
+		patterns, _ := getPatterns(t, "keep")
+		cfg, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+		assert.Equal(t, "test-rule", cfg.Rules["test-rule"].Description)
+		assert.Contains(t, cfg.Rules, "internal-token")
+	})
+
+	t.Run("ErrorOnCollision", func(t *testing.T) {
+		patterns, _ := getPatterns(t, "error")
+		_, err := patterns.Gitleaks()
+		assert.ErrorContains(t, err, "rule ID collision")
+	})
+
+	t.Run("ReloadOnChange", func(t *testing.T) {
+		patterns, overridesDir := getPatterns(t, "")
+		cfg, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+
+		// Nothing changed so the same config is returned
+		unchanged, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+		assert.Same(t, cfg, unchanged)
+
+		hash := patterns.GitleaksConfigHash()
+		newFile := filepath.Join(overridesDir, "20-rules.toml")
+		assert.NoError(t, os.WriteFile(newFile, []byte("[[rules]]\nid = \"local-rule\"\nregex = '''local'''\n"), 0600))
+		assert.NoError(t, os.Chtimes(newFile, time.Now(), time.Now()))
+
+		changed, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+		assert.NotSame(t, cfg, changed)
+		assert.Contains(t, changed.Rules, "local-rule")
+		assert.NotEqual(t, hash, patterns.GitleaksConfigHash())
+	})
+
+	t.Run("BrokenOptionalSources", func(t *testing.T) {
+		patterns, overridesDir := getPatterns(t, "")
+		assert.NoError(t, os.WriteFile(filepath.Join(overridesDir, "20-broken.toml"), []byte("[[rules]]\nid = 'broken'\nregex = '''(?!x)'''\n"), 0600))
+		patterns.sources = append(patterns.sources, &patternSource{name: "missing", kind: patternSourceFile, path: "/path/to/nonexistent/file.toml", optional: true})
+
+		cfg, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+		assert.Contains(t, cfg.Rules, "internal-token")
+		assert.NotContains(t, cfg.Rules, "broken")
+
+		status := patterns.Status()
+		assert.Empty(t, status.Error)
+		assert.Contains(t, status.Sources[3].Error, "could not read pattern source")
+	})
+
+	t.Run("LayersHash", func(t *testing.T) {
+		// The same bytes split differently across layers hash differently
+		assert.NotEqual(t,
+			layersHash([][32]byte{sha256.Sum256([]byte("ab")), sha256.Sum256([]byte("c"))}),
+			layersHash([][32]byte{sha256.Sum256([]byte("a")), sha256.Sum256([]byte("bc"))}),
+		)
+		assert.Equal(t, sha256.Sum256([]byte("abc")), layersHash([][32]byte{sha256.Sum256([]byte("abc"))}))
+	})
+
+	t.Run("InvalidSources", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		_, err := newPatternSource(&cfg.Scanner.Patterns, config.PatternSource{Kind: "ftp"}, nil, nil)
+		assert.ErrorContains(t, err, "unsupported pattern source kind")
+
+		_, err = newPatternSource(&cfg.Scanner.Patterns, config.PatternSource{Kind: "url", Name: "x"}, nil, nil)
+		assert.ErrorContains(t, err, "require a name and url")
+
+		_, err = newPatternSource(&cfg.Scanner.Patterns, config.PatternSource{Kind: "file"}, nil, nil)
+		assert.ErrorContains(t, err, "require a path")
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		source, err := newPatternSource(&cfg.Scanner.Patterns, config.PatternSource{Kind: "file", Name: "missing", Path: "/path/to/nonexistent/file.toml"}, nil, nil)
+		assert.NoError(t, err)
+
+		_, err = source.load(logger.With())
+		assert.ErrorContains(t, err, "could not read pattern source")
+	})
+}
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+	gitleaksconfig "github.com/zricethezav/gitleaks/v8/config"
+	"github.com/zricethezav/gitleaks/v8/detect"
+)
+
+// PatternTest is a set of samples that the rules are expected to match or not
+// match. Like gitleaks' rule fixtures, a match sample passes if any of the
+// rules find something in it and a no match sample passes if none of them
+// do. If no rules are listed, every rule is used.
+type PatternTest struct {
+	Name         string   `toml:"name" json:"name,omitempty"`
+	Rules        []string `toml:"rules" json:"rules,omitempty"`
+	Matches      []string `toml:"matches" json:"matches,omitempty"`
+	NoMatches    []string `toml:"no_matches" json:"no_matches,omitempty"`
+	MatchFiles   []string `toml:"match_files" json:"match_files,omitempty"`
+	NoMatchFiles []string `toml:"no_match_files" json:"no_match_files,omitempty"`
+}
+
+// PatternTestResult is the outcome of checking one sample
+type PatternTestResult struct {
+	Name  string   `json:"name,omitempty"`
+	Rules []string `json:"rules,omitempty"`
+	// Sample is the sample string or the path for file samples
+	Sample       string   `json:"sample"`
+	ExpectMatch  bool     `json:"expect_match"`
+	MatchedRules []string `json:"matched_rules,omitempty"`
+	Passed       bool     `json:"passed"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// LoadPatternTests reads a TOML file of [[tests]] tables. Relative sample
+// file paths are relative to the directory the file is in.
+func LoadPatternTests(path string) ([]PatternTest, error) {
+	var fixture struct {
+		Tests []PatternTest `toml:"tests"`
+	}
+
+	if _, err := toml.DecodeFile(path, &fixture); err != nil {
+		return nil, fmt.Errorf("could not load pattern tests: path=%q error=%q", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range fixture.Tests {
+		test := &fixture.Tests[i]
+
+		for _, paths := range []*[]string{&test.MatchFiles, &test.NoMatchFiles} {
+			for j, samplePath := range *paths {
+				if !filepath.IsAbs(samplePath) {
+					(*paths)[j] = filepath.Join(dir, samplePath)
+				}
+			}
+		}
+	}
+
+	return fixture.Tests, nil
+}
+
+// RunPatternTests checks each sample in the tests against the rules in cfg
+func RunPatternTests(cfg *gitleaksconfig.Config, tests []PatternTest) []*PatternTestResult {
+	var results []*PatternTestResult
+
+	for _, test := range tests {
+		newResult := func(sample string, expectMatch bool) *PatternTestResult {
+			result := &PatternTestResult{
+				Name:        test.Name,
+				Rules:       test.Rules,
+				Sample:      sample,
+				ExpectMatch: expectMatch,
+			}
+
+			results = append(results, result)
+			return result
+		}
+
+		detector, err := newPatternTestDetector(cfg, test.Rules)
+
+		for _, samples := range []struct {
+			values      []string
+			expectMatch bool
+			files       bool
+		}{
+			{test.Matches, true, false},
+			{test.NoMatches, false, false},
+			{test.MatchFiles, true, true},
+			{test.NoMatchFiles, false, true},
+		} {
+			for _, sample := range samples.values {
+				result := newResult(sample, samples.expectMatch)
+				if err != nil {
+					result.Error = err.Error()
+					continue
+				}
+
+				fragment := detect.Fragment{Raw: sample}
+				if samples.files {
+					data, err := os.ReadFile(sample)
+					if err != nil {
+						result.Error = fmt.Sprintf("could not read sample: path=%q error=%q", sample, err)
+						continue
+					}
+
+					fragment = detect.Fragment{Raw: string(data), FilePath: sample}
+				}
+
+				for _, finding := range detector.Detect(fragment) {
+					if !slices.Contains(result.MatchedRules, finding.RuleID) {
+						result.MatchedRules = append(result.MatchedRules, finding.RuleID)
+					}
+				}
+
+				result.Passed = (len(result.MatchedRules) > 0) == samples.expectMatch
+			}
+		}
+	}
+
+	return results
+}
+
+// newPatternTestDetector returns a detector for only the listed rules
+func newPatternTestDetector(cfg *gitleaksconfig.Config, rules []string) (*detect.Detector, error) {
+	for _, ruleID := range rules {
+		if _, ok := cfg.Rules[ruleID]; !ok {
+			return nil, fmt.Errorf("rule not found: rule_id=%q", ruleID)
+		}
+	}
+
+	filter := RuleFilter{Rules: rules}
+	detector := detect.NewDetector(*filter.Apply(cfg))
+	detector.NoColor = true
+	detector.Redact = 0
+	detector.Verbose = false
+
+	return detector, nil
+}
@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const mockPatternTestConfig = `
+[[rules]]
+id = "test-token"
+description = "Test Token"
+regex = '''test_[a-z0-9]{8}'''
+
+[[rules]]
+id = "other-token"
+description = "Other Token"
+regex = '''other_[a-z0-9]{8}'''
+`
+
+func TestLoadPatternTests(t *testing.T) {
+	tmpDir := t.TempDir()
+	testsPath := filepath.Join(tmpDir, "tests.toml")
+	assert.NoError(t, os.WriteFile(testsPath, []byte(`
+[[tests]]
+name = "test token"
+rules = ["test-token"]
+matches = ["test_abcd1234"]
+no_matches = ["test_short"]
+match_files = ["samples/leak.txt", "/abs/leak.txt"]
+`), 0600))
+
+	tests, err := LoadPatternTests(testsPath)
+	assert.NoError(t, err)
+	assert.Len(t, tests, 1)
+	assert.Equal(t, "test token", tests[0].Name)
+	assert.Equal(t, []string{"test-token"}, tests[0].Rules)
+	assert.Equal(t, []string{"test_abcd1234"}, tests[0].Matches)
+	assert.Equal(t, []string{"test_short"}, tests[0].NoMatches)
+	assert.Equal(t, []string{filepath.Join(tmpDir, "samples/leak.txt"), "/abs/leak.txt"}, tests[0].MatchFiles)
+
+	_, err = LoadPatternTests(filepath.Join(tmpDir, "missing.toml"))
+	assert.Error(t, err)
+}
+
+func TestRunPatternTests(t *testing.T) {
+	cfg, err := ParseGitleaksConfig(mockPatternTestConfig)
+	assert.NoError(t, err)
+
+	tmpDir := t.TempDir()
+	leakPath := filepath.Join(tmpDir, "leak.txt")
+	assert.NoError(t, os.WriteFile(leakPath, []byte("token = other_abcd1234\n"), 0600))
+
+	t.Run("SelectedRules", func(t *testing.T) {
+		results := RunPatternTests(cfg, []PatternTest{
+			{
+				Rules:      []string{"test-token"},
+				Matches:    []string{"token = test_abcd1234", "token = other_abcd1234"},
+				NoMatches:  []string{"token = test_short"},
+				MatchFiles: []string{leakPath},
+			},
+		})
+
+		assert.Len(t, results, 4)
+		assert.True(t, results[0].Passed)
+		assert.Equal(t, []string{"test-token"}, results[0].MatchedRules)
+		// other-token isn't selected so it doesn't count
+		assert.False(t, results[1].Passed)
+		assert.Empty(t, results[1].MatchedRules)
+		assert.True(t, results[2].Passed)
+		assert.False(t, results[2].ExpectMatch)
+		assert.False(t, results[3].Passed)
+		assert.Equal(t, leakPath, results[3].Sample)
+	})
+
+	t.Run("AllRules", func(t *testing.T) {
+		results := RunPatternTests(cfg, []PatternTest{
+			{
+				MatchFiles:   []string{leakPath},
+				NoMatchFiles: []string{filepath.Join(tmpDir, "missing.txt")},
+			},
+		})
+
+		assert.Len(t, results, 2)
+		assert.True(t, results[0].Passed)
+		assert.Equal(t, []string{"other-token"}, results[0].MatchedRules)
+		assert.False(t, results[1].Passed)
+		assert.Contains(t, results[1].Error, "could not read sample")
+	})
+
+	t.Run("UnknownRule", func(t *testing.T) {
+		results := RunPatternTests(cfg, []PatternTest{
+			{Rules: []string{"missing-rule"}, Matches: []string{"test_abcd1234"}},
+		})
+
+		assert.Len(t, results, 1)
+		assert.False(t, results[0].Passed)
+		assert.Equal(t, `rule not found: rule_id="missing-rule"`, results[0].Error)
+	})
+}
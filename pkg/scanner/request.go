@@ -1,9 +1,13 @@
 package scanner
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+
+	"github.com/BurntSushi/toml"
 
 	"github.com/leaktk/leaktk/pkg/logger"
 	"github.com/leaktk/leaktk/pkg/resource"
@@ -12,8 +16,114 @@ import (
 // Request to the scanner to scan some resource
 type Request struct {
 	ID string
+	// Tenant groups requests for fair scheduling (see Scheduling in the config)
+	Tenant string
+	// Options that apply to the request regardless of the resource kind
+	Options RequestOptions
 	// Thing to scan (e.g. URL, snippet of text, etc)
 	Resource resource.Resource
+	// timing tracks when the request reached each stage in the scanner
+	timing requestTiming
+	// optionsKey is the canonical form of the raw options used to recognize
+	// identical requests (empty if the request didn't come from JSON)
+	optionsKey string
+	// coalesceKey is set by the scanner when other identical requests can
+	// share this request's response
+	coalesceKey string
+	// rawSize is the size of the JSON the request was read from
+	rawSize int
+	// settings are the scanner settings when the request was accepted
+	settings *settings
+	// baseline is loaded from Options.Baseline the first time the results
+	// are finalized so streamed chunks don't each read the file
+	baseline     *Baseline
+	baselineOnce sync.Once
+}
+
+// RequestOptions are the options shared by every kind of request. They're
+// read from the same "options" object as the resource specific options.
+type RequestOptions struct {
+	// Path to a local results file whose results should not be reported
+	Baseline string `json:"baseline"`
+	// Extra gitleaks rules and allowlists to use for this request only
+	GitleaksConfig InlineGitleaksConfig `json:"gitleaks_config"`
+	// Redact this percent of the secret in the results (0-100). This can
+	// only increase the redaction set in the scanner config.
+	Redact uint `json:"redact"`
+	// Check if the secrets are live using the configured verifiers
+	Verify bool `json:"verify"`
+	// Send lifecycle and progress events in listen mode
+	Events bool `json:"events"`
+	// Send the results in chunks as they're found followed by a summary
+	Stream bool `json:"stream"`
+	// Include the logs at or above this level (e.g. DEBUG) in the response
+	// without changing the scanner's log level
+	LogLevel string `json:"log_level"`
+	// Limit which rules run (rules, exclude_rules, tags, exclude_tags)
+	RuleFilter
+	// progress is set by the scanner for the backend that's running
+	progress *scanProgress
+	// stream is set by the scanner when Stream is true
+	stream *resultStream
+}
+
+// InlineGitleaksConfig is a gitleaks config provided in a request. In JSON it
+// can either be a string of TOML or an object with the same structure as the
+// TOML. Either way it's stored as TOML.
+type InlineGitleaksConfig string
+
+// UnmarshalJSON converts the config to TOML if it's a JSON object
+func (c *InlineGitleaksConfig) UnmarshalJSON(data []byte) error {
+	var value any
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case nil:
+		*c = ""
+	case string:
+		*c = InlineGitleaksConfig(value)
+	case map[string]any:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(tomlValue(value)); err != nil {
+			return fmt.Errorf("could not convert gitleaks_config to TOML: error=%q", err)
+		}
+
+		*c = InlineGitleaksConfig(buf.String())
+	default:
+		return fmt.Errorf("gitleaks_config must be a string or an object: type=%q", fmt.Sprintf("%T", value))
+	}
+
+	return nil
+}
+
+// tomlValue converts json.Number values to ints or floats so they're encoded
+// as TOML numbers instead of strings
+func tomlValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = tomlValue(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = tomlValue(item)
+		}
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+
+		if f, err := value.Float64(); err == nil {
+			return f
+		}
+	}
+
+	return value
 }
 
 // Priority of this request
@@ -21,6 +131,22 @@ func (r *Request) Priority() int {
 	return r.Resource.Priority()
 }
 
+// log returns a logger that attaches the request and resource IDs and adds
+// the entries to the resource's logs if the request set a log_level
+func (r *Request) log() *logger.Logger {
+	return r.Resource.Logger()
+}
+
+// size returns how big the request was in bytes or the size of the resource
+// if it wasn't read from JSON
+func (r *Request) size() int {
+	if r.rawSize > 0 {
+		return r.rawSize
+	}
+
+	return len(r.Resource.String())
+}
+
 // UnmarshalJSON sets r to a copy of data
 func (r *Request) UnmarshalJSON(data []byte) error {
 	if r == nil {
@@ -29,6 +155,7 @@ func (r *Request) UnmarshalJSON(data []byte) error {
 
 	var temp struct {
 		ID       string          `json:"id"`
+		Tenant   string          `json:"tenant"`
 		Kind     string          `json:"kind"`
 		Resource string          `json:"resource"`
 		Options  json.RawMessage `json:"options"`
@@ -39,12 +166,39 @@ func (r *Request) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("could not unmarshal Request: error=%q", err)
 	}
 
+	var options RequestOptions
+	if len(temp.Options) > 0 {
+		if err := json.Unmarshal(temp.Options, &options); err != nil {
+			logger.Debug("RequestOptions:\n%v", temp.Options)
+			return fmt.Errorf("could not unmarshal RequestOptions: error=%q", err)
+		}
+	}
+
+	if options.Redact > 100 {
+		return fmt.Errorf("invalid redact option: redact=%d", options.Redact)
+	}
+
+	if len(options.LogLevel) > 0 {
+		if _, err := logger.ParseLogLevel(options.LogLevel); err != nil {
+			return fmt.Errorf("invalid log_level option: error=%q", err)
+		}
+	}
+
 	requestResource, err := resource.NewResource(temp.Kind, temp.Resource, temp.Options)
 	if err != nil {
 		return fmt.Errorf("could not create resource: error=%q", err)
 	}
 
+	optionsKey, err := canonicalOptions(temp.Options)
+	if err != nil {
+		return fmt.Errorf("could not normalize options: error=%q", err)
+	}
+
 	r.ID = temp.ID
+	r.Tenant = temp.Tenant
+	r.optionsKey = optionsKey
+	r.rawSize = len(data)
+	r.Options = options
 	r.Resource = requestResource
 
 	return nil
@@ -42,3 +42,26 @@ func TestGitRepoRequest(t *testing.T) {
 	err = json.Unmarshal([]byte(invalidGitRepoRequest), &invalidRequest)
 	assert.NotNil(t, err)
 }
+
+func TestRequestOptions(t *testing.T) {
+	t.Run("Redact", func(t *testing.T) {
+		var request Request
+		err := json.Unmarshal([]byte(`{"id": "foobar", "kind": "Text", "resource": "x", "options": {"redact": 50}}`), &request)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(50), request.Options.Redact)
+	})
+
+	t.Run("RuleFilter", func(t *testing.T) {
+		var request Request
+		err := json.Unmarshal([]byte(`{"id": "foobar", "kind": "Text", "resource": "x", "options": {"rules": ["a"], "exclude_tags": ["b"]}}`), &request)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a"}, request.Options.Rules)
+		assert.Equal(t, []string{"b"}, request.Options.ExcludeTags)
+	})
+
+	t.Run("InvalidRedact", func(t *testing.T) {
+		var request Request
+		err := json.Unmarshal([]byte(`{"id": "foobar", "kind": "Text", "resource": "x", "options": {"redact": 101}}`), &request)
+		assert.Error(t, err)
+	})
+}
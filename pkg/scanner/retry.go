@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/resource"
+)
+
+// retryPolicy is how many times a clone is attempted and how long to wait
+// between the attempts
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(cfg *config.Retry) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:    max(int(cfg.MaxAttempts), 1),
+		initialBackoff: time.Duration(cfg.InitialBackoff * float64(time.Second)),
+		maxBackoff:     time.Duration(cfg.MaxBackoff * float64(time.Second)),
+	}
+
+	if policy.maxBackoff < policy.initialBackoff {
+		policy.maxBackoff = policy.initialBackoff
+	}
+
+	return policy
+}
+
+// backoff returns how long to wait after the attempt (starting at 1) failed.
+// It doubles with each attempt up to maxBackoff and half of it is random so
+// clones that failed together don't all retry at the same time.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.initialBackoff
+	for i := 1; i < attempt && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	backoff = min(backoff, p.maxBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+
+	half := backoff / 2
+	return half + rand.N(backoff-half+1) // #nosec G404 -- jitter doesn't need a secure source
+}
+
+// cloneWithRetries clones the resource and tries again while it fails for
+// reasons that may go away on their own. Each failed attempt is recorded in
+// the resource logs. It returns the error from the last attempt.
+func (s *Scanner) cloneWithRetries(request *Request) error {
+	reqResource := request.Resource
+	path := s.resourcePath(reqResource)
+	retry := &resource.Retry{
+		MaxAttempts: request.settings.retry.maxAttempts,
+		Backoff:     request.settings.retry.backoff,
+	}
+
+	// Resources that retry the parts of their clone (e.g. image layers) are
+	// only cloned once so a failed part doesn't start the clone over
+	if retrier, ok := reqResource.(resource.Retrier); ok {
+		retry.OnRetry = func(attempt int, backoff time.Duration, err error) {
+			s.recordRetry(request, "clone step failed", attempt, backoff, err)
+		}
+		retrier.SetRetry(retry)
+
+		return reqResource.Clone(path)
+	}
+
+	retry.OnRetry = func(attempt int, backoff time.Duration, err error) {
+		s.recordRetry(request, "clone attempt failed", attempt, backoff, err)
+	}
+
+	// The attempts share one clone_timeout so stop waiting to retry once it's
+	// used up
+	ctx := context.Background()
+	if request.settings.cloneTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, request.timing.cloneStarted.Add(request.settings.cloneTimeout))
+		defer cancel()
+	}
+
+	attempt := 0
+	err := retry.Do(ctx, func() error {
+		attempt++
+
+		// Start the next attempt from a clean directory with what's left of
+		// the clone_timeout
+		if attempt > 1 {
+			if err := s.removeResourceFiles(reqResource); err != nil {
+				return fmt.Errorf("could not clean up failed clone: error=%q", err)
+			}
+
+			if deadline, ok := ctx.Deadline(); ok {
+				reqResource.SetCloneTimeout(time.Until(deadline))
+			}
+		}
+
+		return reqResource.Clone(path)
+	})
+
+	if err == nil && attempt > 1 {
+		reqResource.Record(logger.INFO, logger.CloneDetail, "clone succeeded", logger.Int("attempt", attempt))
+	}
+
+	return err
+}
+
+// recordRetry adds a failed attempt to the resource logs and counts it
+func (s *Scanner) recordRetry(request *Request, msg string, attempt int, backoff time.Duration, err error) {
+	request.Resource.Record(
+		logger.WARNING,
+		logger.CloneDetail,
+		msg,
+		logger.Int("attempt", attempt),
+		logger.Int("max_attempts", request.settings.retry.maxAttempts),
+		logger.Duration("retry_in", backoff.Round(time.Millisecond)),
+		logger.Err(err),
+	)
+	s.metrics.cloneRetries.Inc(request.Resource.Kind())
+}
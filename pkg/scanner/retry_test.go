@@ -0,0 +1,191 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/resource"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// flakyResource fails its first clones with the errors in cloneErrs
+type flakyResource struct {
+	mockResource
+	cloneErrs []error
+	clones    int
+}
+
+func (f *flakyResource) Clone(path string) error {
+	f.clones++
+	if err := f.mockResource.Clone(path); err != nil {
+		return err
+	}
+
+	if f.clones <= len(f.cloneErrs) {
+		return f.cloneErrs[f.clones-1]
+	}
+
+	return nil
+}
+
+// stepResource retries the failed steps of its clone itself like
+// ContainerImage does for each layer
+type stepResource struct {
+	flakyResource
+	retry *resource.Retry
+	steps int
+}
+
+func (r *stepResource) SetRetry(retry *resource.Retry) {
+	r.retry = retry
+}
+
+func (r *stepResource) Clone(path string) error {
+	r.steps++
+	return r.retry.Do(context.Background(), func() error {
+		return r.flakyResource.Clone(path)
+	})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := newRetryPolicy(&config.Retry{InitialBackoff: 1, MaxAttempts: 5, MaxBackoff: 3})
+
+	// Each backoff is between half and all of the doubled backoff (capped)
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 3 * time.Second, 10: 3 * time.Second} {
+		backoff := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, backoff, expected/2)
+		assert.LessOrEqual(t, backoff, expected)
+	}
+
+	// At least one attempt is always made
+	assert.Equal(t, 1, newRetryPolicy(&config.Retry{}).maxAttempts)
+}
+
+func TestCloneRetries(t *testing.T) {
+	scanWith := func(t *testing.T, flaky resource.Resource, configure func(*config.Config)) *response.Response {
+		scanner := newTestScanner(t, func(cfg *config.Config) {
+			cfg.Scanner.Retry = config.Retry{InitialBackoff: 0.001, MaxAttempts: 3, MaxBackoff: 0.001}
+			if configure != nil {
+				configure(cfg)
+			}
+		}, &mockBackend{})
+
+		var wg sync.WaitGroup
+		var resp *response.Response
+		wg.Add(1)
+		go scanner.Recv(func(r *response.Response) {
+			resp = r
+			wg.Done()
+		})
+
+		assert.NoError(t, scanner.Send(&Request{ID: "1", Resource: flaky}))
+		wg.Wait()
+
+		return resp
+	}
+
+	scan := func(t *testing.T, flaky resource.Resource) *response.Response {
+		return scanWith(t, flaky, nil)
+	}
+
+	t.Run("Transient", func(t *testing.T) {
+		flaky := &flakyResource{cloneErrs: []error{
+			errors.New("read: connection reset by peer"),
+			errors.New("unexpected status code: 503 Service Unavailable"),
+		}}
+
+		resp := scan(t, flaky)
+		assert.Equal(t, 3, flaky.clones)
+		assert.Equal(t, response.StatusSuccess, resp.Status)
+
+		// Each failed attempt is in the logs
+		var attempts []logger.Entry
+		for _, entry := range resp.Logs {
+			if entry.Code == "CloneDetail" {
+				attempts = append(attempts, entry)
+			}
+		}
+		assert.Len(t, attempts, 3)
+		assert.Equal(t, "clone attempt failed", attempts[0].Message)
+		assert.Contains(t, attempts[0].Fields, logger.Int("attempt", 1))
+		assert.Contains(t, attempts[0].Fields, logger.Int("max_attempts", 3))
+		assert.Equal(t, "clone succeeded", attempts[2].Message)
+		assert.Contains(t, attempts[2].Fields, logger.Int("attempt", 3))
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		flaky := &flakyResource{cloneErrs: []error{
+			errors.New("i/o timeout"),
+			errors.New("i/o timeout"),
+			errors.New("i/o timeout"),
+		}}
+
+		resp := scan(t, flaky)
+		assert.Equal(t, 3, flaky.clones)
+		assert.Equal(t, response.StatusFailed, resp.Status)
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		flaky := &flakyResource{cloneErrs: []error{
+			errors.New("remote: Repository not found."),
+		}}
+
+		resp := scan(t, flaky)
+		assert.Equal(t, 1, flaky.clones)
+		assert.Equal(t, response.NotFoundError, resp.Errors[0].Code)
+	})
+
+	t.Run("CloneTimeoutExceeded", func(t *testing.T) {
+		flaky := &flakyResource{cloneErrs: []error{
+			fmt.Errorf("clone timeout exceeded: %w", resource.ErrTimeout),
+		}}
+
+		// Another attempt would have no clone_timeout left
+		resp := scan(t, flaky)
+		assert.Equal(t, 1, flaky.clones)
+		assert.Equal(t, response.TimeoutError, resp.Errors[0].Code)
+	})
+
+	t.Run("StopsWaitingAtCloneTimeout", func(t *testing.T) {
+		flaky := &flakyResource{cloneErrs: []error{
+			errors.New("read: connection reset by peer"),
+		}}
+
+		start := time.Now()
+		resp := scanWith(t, flaky, func(cfg *config.Config) {
+			cfg.Scanner.CloneTimeout = 1
+			cfg.Scanner.Retry = config.Retry{InitialBackoff: 60, MaxAttempts: 3, MaxBackoff: 60}
+		})
+
+		assert.Less(t, time.Since(start), 30*time.Second)
+		assert.Equal(t, 1, flaky.clones)
+		assert.Equal(t, response.TimeoutError, resp.Errors[0].Code)
+	})
+
+	t.Run("RetriesSteps", func(t *testing.T) {
+		steps := &stepResource{flakyResource: flakyResource{cloneErrs: []error{
+			errors.New("read: connection reset by peer"),
+		}}}
+
+		resp := scan(t, steps)
+		assert.Equal(t, response.StatusSuccess, resp.Status)
+
+		// The step was retried without starting the clone over
+		assert.Equal(t, 1, steps.steps)
+		assert.Equal(t, 2, steps.clones)
+
+		var messages []string
+		for _, entry := range resp.Logs {
+			messages = append(messages, entry.Message)
+		}
+		assert.Contains(t, messages, "clone step failed")
+	})
+}
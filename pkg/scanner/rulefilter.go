@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"slices"
+	"strings"
+
+	gitleaksconfig "github.com/zricethezav/gitleaks/v8/config"
+)
+
+// RuleFilter selects which rules run for a request. If Rules or Tags are set,
+// only rules with one of those IDs or tags run. Excludes win over includes.
+type RuleFilter struct {
+	Rules        []string `json:"rules"`
+	ExcludeRules []string `json:"exclude_rules"`
+	Tags         []string `json:"tags"`
+	ExcludeTags  []string `json:"exclude_tags"`
+}
+
+// Empty returns true if the filter allows every rule
+func (f *RuleFilter) Empty() bool {
+	return len(f.Rules) == 0 && len(f.ExcludeRules) == 0 && len(f.Tags) == 0 && len(f.ExcludeTags) == 0
+}
+
+// Key returns a stable string describing the filter. Equivalent filters have
+// the same key (order and duplicates don't matter) and an empty filter has an
+// empty key.
+func (f *RuleFilter) Key() string {
+	parts := make([]string, 0, 4)
+
+	for _, field := range []struct {
+		name   string
+		values []string
+	}{
+		{"rules", f.Rules},
+		{"exclude_rules", f.ExcludeRules},
+		{"tags", f.Tags},
+		{"exclude_tags", f.ExcludeTags},
+	} {
+		if len(field.values) == 0 {
+			continue
+		}
+
+		values := slices.Clone(field.values)
+		slices.Sort(values)
+		parts = append(parts, field.name+"="+strings.Join(slices.Compact(values), ","))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Match returns true if a rule with this ID and tags should run
+func (f *RuleFilter) Match(ruleID string, tags []string) bool {
+	if slices.Contains(f.ExcludeRules, ruleID) || containsAny(f.ExcludeTags, tags) {
+		return false
+	}
+
+	if len(f.Rules) == 0 && len(f.Tags) == 0 {
+		return true
+	}
+
+	return slices.Contains(f.Rules, ruleID) || containsAny(f.Tags, tags)
+}
+
+// Apply returns a copy of the gitleaks config with only the matching rules
+func (f *RuleFilter) Apply(cfg *gitleaksconfig.Config) *gitleaksconfig.Config {
+	filtered := *cfg
+	filtered.Rules = make(map[string]gitleaksconfig.Rule)
+	filtered.Keywords = make(map[string]struct{})
+	filtered.OrderedRules = make([]string, 0, len(cfg.OrderedRules))
+
+	for _, ruleID := range cfg.OrderedRules {
+		rule, ok := cfg.Rules[ruleID]
+		if !ok || !f.Match(rule.RuleID, rule.Tags) {
+			continue
+		}
+
+		filtered.Rules[ruleID] = rule
+		filtered.OrderedRules = append(filtered.OrderedRules, ruleID)
+
+		for _, keyword := range rule.Keywords {
+			filtered.Keywords[strings.ToLower(keyword)] = struct{}{}
+		}
+	}
+
+	return &filtered
+}
+
+// containsAny returns true if any of the values are in the list
+func containsAny(list, values []string) bool {
+	for _, value := range values {
+		if slices.Contains(list, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+const mockRuleFilterConfig = `
+[[rules]]
+id = "aws-access-key"
+regex = '''AKIA[0-9A-Z]{16}'''
+keywords = ["AKIA"]
+tags = ["type:secret", "cloud:aws"]
+
+[[rules]]
+id = "gcp-api-key"
+regex = '''AIza[0-9A-Za-z_-]{35}'''
+keywords = ["AIza"]
+tags = ["type:secret", "cloud:gcp"]
+
+[[rules]]
+id = "generic-password"
+regex = '''password=\S+'''
+keywords = ["password"]
+tags = ["type:secret"]
+`
+
+func TestRuleFilter(t *testing.T) {
+	t.Run("Key", func(t *testing.T) {
+		assert.Equal(t, "", (&RuleFilter{}).Key())
+
+		a := RuleFilter{Rules: []string{"b", "a", "a"}, ExcludeTags: []string{"x"}}
+		b := RuleFilter{Rules: []string{"a", "b"}, ExcludeTags: []string{"x"}}
+		assert.Equal(t, "rules=a,b;exclude_tags=x", a.Key())
+		assert.Equal(t, a.Key(), b.Key())
+	})
+
+	t.Run("Match", func(t *testing.T) {
+		tests := []struct {
+			filter   RuleFilter
+			ruleID   string
+			tags     []string
+			expected bool
+		}{
+			{RuleFilter{}, "any", nil, true},
+			{RuleFilter{Rules: []string{"a"}}, "a", nil, true},
+			{RuleFilter{Rules: []string{"a"}}, "b", nil, false},
+			{RuleFilter{Tags: []string{"cloud:aws"}}, "b", []string{"cloud:aws"}, true},
+			// Rules and tags are combined as a union
+			{RuleFilter{Rules: []string{"a"}, Tags: []string{"cloud:aws"}}, "b", []string{"cloud:aws"}, true},
+			// Excludes win
+			{RuleFilter{Rules: []string{"a"}, ExcludeRules: []string{"a"}}, "a", nil, false},
+			{RuleFilter{Tags: []string{"type:secret"}, ExcludeTags: []string{"cloud:gcp"}}, "b", []string{"type:secret", "cloud:gcp"}, false},
+			{RuleFilter{ExcludeRules: []string{"a"}}, "b", nil, true},
+		}
+
+		for _, test := range tests {
+			assert.Equal(t, test.expected, test.filter.Match(test.ruleID, test.tags), "filter=%q rule=%q", test.filter.Key(), test.ruleID)
+		}
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		cfg, err := ParseGitleaksConfig(mockRuleFilterConfig)
+		assert.NoError(t, err)
+
+		filter := RuleFilter{Tags: []string{"type:secret"}, ExcludeTags: []string{"cloud:gcp"}}
+		filtered := filter.Apply(cfg)
+
+		assert.Equal(t, []string{"aws-access-key", "generic-password"}, filtered.OrderedRules)
+		assert.Len(t, filtered.Rules, 2)
+		assert.Contains(t, filtered.Keywords, "akia")
+		assert.NotContains(t, filtered.Keywords, "aiza")
+
+		// The original config isn't modified
+		assert.Len(t, cfg.Rules, 3)
+	})
+}
+
+func TestGitleaksFilteredConfig(t *testing.T) {
+	cfg, err := ParseGitleaksConfig(mockRuleFilterConfig)
+	assert.NoError(t, err)
+
+	gitleaks := NewGitleaks(0, nil)
+	filter := &RuleFilter{Rules: []string{"aws-access-key"}}
+
+	// No filter means the shared config is used as is
+	assert.Same(t, cfg, gitleaks.filteredConfig(logger.With(), cfg, &RuleFilter{}))
+
+	// Filtered configs are cached per filter
+	filtered := gitleaks.filteredConfig(logger.With(), cfg, filter)
+	assert.Len(t, filtered.Rules, 1)
+	assert.Same(t, filtered, gitleaks.filteredConfig(logger.With(), cfg, &RuleFilter{Rules: []string{"aws-access-key", "aws-access-key"}}))
+
+	// The cache is reset when the patterns change
+	newCfg, err := ParseGitleaksConfig(mockRuleFilterConfig)
+	assert.NoError(t, err)
+	assert.NotSame(t, filtered, gitleaks.filteredConfig(logger.With(), newCfg, filter))
+	assert.Len(t, gitleaks.filteredConfigs, 1)
+}
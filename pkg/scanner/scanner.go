@@ -1,8 +1,13 @@
 package scanner
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/leaktk/leaktk/pkg/config"
@@ -13,50 +18,227 @@ import (
 	"github.com/leaktk/leaktk/pkg/queue"
 	"github.com/leaktk/leaktk/pkg/resource"
 	"github.com/leaktk/leaktk/pkg/response"
+	"github.com/leaktk/leaktk/version"
 )
 
 // Set initial queue size. The queue can grow over time if needed
 const queueSize = 1024
 
+// requestTiming records when a request reached each stage
+type requestTiming struct {
+	queued        time.Time
+	cloneStarted  time.Time
+	cloneFinished time.Time
+	scanStarted   time.Time
+	scanFinished  time.Time
+}
+
+// durations returns how long the request spent in each stage. Stages that
+// didn't happen are zero.
+func (t *requestTiming) durations() response.Timing {
+	elapsed := func(start, end time.Time) int64 {
+		if start.IsZero() || end.IsZero() {
+			return 0
+		}
+
+		return end.Sub(start).Milliseconds()
+	}
+
+	return response.Timing{
+		QueuedMS: elapsed(t.queued, t.cloneStarted) + elapsed(t.cloneFinished, t.scanStarted),
+		CloneMS:  elapsed(t.cloneStarted, t.cloneFinished),
+		ScanMS:   elapsed(t.scanStarted, t.scanFinished),
+	}
+}
+
 // Scanner holds the config and state for the scanner processes
 type Scanner struct {
+	cloneQueue    *queue.PriorityQueue[*Request]
+	cloneWorkers  uint16
+	resourceDir   string
+	responseQueue *queue.PriorityQueue[*response.Response]
+	scanQueue     *queue.PriorityQueue[*Request]
+	scanWorkers   uint16
+	// settings can be swapped by Reload at any time so requests load them
+	// once and keep using the same ones
+	settings atomic.Pointer[settings]
+	// reloadLock keeps reloads from running at the same time
+	reloadLock sync.Mutex
+	// eventHandler receives events for requests that ask for them
+	eventHandler EventHandler
+	eventsLock   sync.RWMutex
+	// coalescer shares responses between identical requests
+	coalescer *coalescer
+	// pending counts the requests that are queued or in progress
+	pending atomic.Int64
+	// diskUsage tracks how much space the resources are using
+	diskUsage diskUsage
+	metrics   *scannerMetrics
+}
+
+// settings are everything that can be changed by a reload. They're never
+// modified after they're created.
+type settings struct {
 	allowLocal          bool
 	backends            []Backend
-	cloneQueue          *queue.PriorityQueue[*Request]
 	cloneTimeout        time.Duration
-	cloneWorkers        uint16
 	includeResponseLogs bool
+	maxQueueDepth       uint32
+	maxRequestSize      uint32
+	maxResourceBytes    uint64
 	maxScanDepth        uint16
-	resourceDir         string
-	responseQueue       *queue.PriorityQueue[*response.Response]
-	scanQueue           *queue.PriorityQueue[*Request]
-	scanWorkers         uint16
+	redact              uint
+	retry               retryPolicy
+	secretHashSalt      string
+	streamChunkSize     uint16
+	suppressions        *Suppressions
+	verifiers           *Verifiers
+	verifyTimeout       time.Duration
+	// patterns are shared by the gitleaks backends (nil if there aren't any)
+	patterns *Patterns
 }
 
 // NewScanner returns a initialized and listening scanner instance that should
 // be closed when it's no longer needed.
 func NewScanner(cfg *config.Config) *Scanner {
 	scanner := &Scanner{
+		cloneQueue:    queue.NewPriorityQueue[*Request](queueSize),
+		cloneWorkers:  cfg.Scanner.CloneWorkers,
+		coalescer:     newCoalescer(),
+		resourceDir:   filepath.Join(cfg.Scanner.Workdir, "resources"),
+		responseQueue: queue.NewPriorityQueue[*response.Response](queueSize),
+		scanQueue:     queue.NewPriorityQueue[*Request](queueSize),
+		scanWorkers:   cfg.Scanner.ScanWorkers,
+	}
+
+	scanner.metrics = scanner.newScannerMetrics()
+
+	backends, patterns := newBackends(cfg)
+	scanner.metrics.watchPatterns(patterns)
+	scanner.applySettings(cfg, backends, patterns)
+	scanner.start()
+	return scanner
+}
+
+// newSettings builds the settings from the config
+func newSettings(cfg *config.Config, backends []Backend, patterns *Patterns) *settings {
+	settings := &settings{
 		allowLocal:          cfg.Scanner.AllowLocal,
-		cloneQueue:          queue.NewPriorityQueue[*Request](queueSize),
+		backends:            backends,
 		cloneTimeout:        time.Duration(cfg.Scanner.CloneTimeout) * time.Second,
-		cloneWorkers:        cfg.Scanner.CloneWorkers,
-		maxScanDepth:        cfg.Scanner.MaxScanDepth,
-		resourceDir:         filepath.Join(cfg.Scanner.Workdir, "resources"),
-		responseQueue:       queue.NewPriorityQueue[*response.Response](queueSize),
-		scanQueue:           queue.NewPriorityQueue[*Request](queueSize),
-		scanWorkers:         cfg.Scanner.ScanWorkers,
 		includeResponseLogs: cfg.Scanner.IncludeResponseLogs,
-		backends: []Backend{
-			NewGitleaks(
-				cfg.Scanner.MaxDecodeDepth,
-				NewPatterns(&cfg.Scanner.Patterns, http.NewClient()),
-			),
-		},
+		maxQueueDepth:       cfg.Scanner.MaxQueueDepth,
+		maxRequestSize:      cfg.Scanner.MaxRequestSize,
+		maxResourceBytes:    cfg.Scanner.MaxResourceBytes,
+		maxScanDepth:        cfg.Scanner.MaxScanDepth,
+		patterns:            patterns,
+		redact:              cfg.Scanner.Redact,
+		retry:               newRetryPolicy(&cfg.Scanner.Retry),
+		secretHashSalt:      cfg.Scanner.SecretHashSalt,
+		streamChunkSize:     cfg.Scanner.StreamChunkSize,
+		verifiers:           NewVerifiers(cfg.Scanner.Verifiers, http.NewClient()),
+		verifyTimeout:       time.Duration(cfg.Scanner.VerifyTimeout) * time.Second,
 	}
 
-	scanner.start()
-	return scanner
+	if len(cfg.Scanner.SuppressionsPath) > 0 {
+		settings.suppressions = NewSuppressions(cfg.Scanner.SuppressionsPath)
+	}
+
+	if len(settings.secretHashSalt) == 0 {
+		logger.Warning("secret_hash_salt is not set so secret_hash is an unsalted SHA-256 that can be reversed for guessable secrets")
+	}
+
+	return settings
+}
+
+// applySettings swaps in everything that can be changed by a reload
+func (s *Scanner) applySettings(cfg *config.Config, backends []Backend, patterns *Patterns) {
+	s.settings.Store(newSettings(cfg, backends, patterns))
+	s.coalescer.setCacheTTL(time.Duration(cfg.Scanner.ResultCacheTTL) * time.Second)
+
+	policy := schedulingPolicy(&cfg.Scanner.Scheduling)
+	s.cloneQueue.SetPolicy(policy)
+	s.scanQueue.SetPolicy(policy)
+}
+
+// Reload swaps in the settings, backends and patterns from cfg without
+// dropping queued requests. The new patterns are loaded first (and fetched if
+// autofetch is enabled) so the current config is kept if they fail. Requests
+// already accepted finish with the settings they were accepted with and the
+// ones after it use the new config. The worker counts and workdir only change
+// on restart.
+func (s *Scanner) Reload(cfg *config.Config) error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	backends, patterns := newBackends(cfg)
+	s.metrics.watchPatterns(patterns)
+	if patterns != nil {
+		var err error
+		if cfg.Scanner.Patterns.Autofetch {
+			err = patterns.Fetch()
+		} else {
+			_, err = patterns.Gitleaks()
+		}
+
+		if err != nil {
+			return fmt.Errorf("could not reload patterns: error=%q", err)
+		}
+	}
+
+	oldHash, newHash := "", ""
+	if oldPatterns := s.settings.Load().patterns; oldPatterns != nil {
+		oldHash = oldPatterns.GitleaksConfigHash()
+	}
+	if patterns != nil {
+		newHash = patterns.GitleaksConfigHash()
+	}
+
+	s.applySettings(cfg, backends, patterns)
+	logger.Info("reloaded scanner config: old_patterns_hash=%q new_patterns_hash=%q", oldHash, newHash)
+
+	return nil
+}
+
+// newBackends returns the enabled backends in the order they're configured
+// and the patterns shared by the gitleaks backends
+func newBackends(cfg *config.Config) ([]Backend, *Patterns) {
+	var patterns *Patterns
+	backends := make([]Backend, 0, len(cfg.Scanner.Backends))
+
+	for _, backendCfg := range cfg.Scanner.Backends {
+		if backendCfg.Disabled {
+			continue
+		}
+
+		switch strings.ToLower(backendCfg.Kind) {
+		case "gitleaks":
+			// Share the patterns in case gitleaks is listed more than once
+			if patterns == nil {
+				patterns = NewPatterns(&cfg.Scanner.Patterns, http.NewClient())
+			}
+
+			backends = append(backends, NewGitleaks(cfg.Scanner.MaxDecodeDepth, patterns))
+		case "native":
+			backends = append(backends, NewNative(backendCfg.Native))
+		case "external":
+			backend, err := NewExternal(backendCfg.Name, backendCfg.External)
+			if err != nil {
+				logger.Error("could not configure external backend: name=%q error=%q", backendCfg.Name, err)
+				continue
+			}
+
+			backends = append(backends, backend)
+		default:
+			logger.Error("unsupported scanner backend: kind=%q", backendCfg.Kind)
+		}
+	}
+
+	if len(backends) == 0 {
+		logger.Warning("no scanner backends are enabled")
+	}
+
+	return backends, patterns
 }
 
 // Recv sends scan responses to a callback function
@@ -66,13 +248,75 @@ func (s *Scanner) Recv(fn func(*response.Response)) {
 	})
 }
 
-// Send accepts a request for scanning and puts it in the queues
-func (s *Scanner) Send(request *Request) {
-	logger.Info("queueing clone: request_id=%q resource_id=%q", request.ID, request.Resource.ID())
+// Send accepts a request for scanning and puts it in the queues. Requests
+// identical to one that's already queued or recently finished get a copy of
+// its response instead. It returns an error without queueing the request if
+// the scanner is at one of its limits.
+func (s *Scanner) Send(request *Request) error {
+	request.timing.queued = time.Now()
+	request.settings = s.settings.Load()
+	request.Resource.SetRequestID(request.ID)
+	if level, err := logger.ParseLogLevel(request.Options.LogLevel); err == nil {
+		request.Resource.SetLogLevel(level)
+	}
+
+	if err := s.admit(request); err != nil {
+		request.log().Warning("rejecting request", logger.Err(err))
+		s.metrics.requests.Inc(requestRejected)
+		return err
+	}
+
+	if key := s.requestKey(request); len(key) > 0 {
+		cached, joined := s.coalescer.join(key, request)
+		if cached != nil {
+			request.log().Info("using cached response")
+			s.metrics.requests.Inc(requestCached)
+			s.sendSharedResponse(request, cached)
+			return nil
+		}
+
+		if joined {
+			request.log().Info("sharing in-flight scan")
+			s.metrics.requests.Inc(requestShared)
+			return nil
+		}
+
+		request.coalesceKey = key
+	}
+
+	request.log().Info("queueing clone")
+	if !request.Resource.IsLocal() {
+		s.diskUsage.reserve()
+	}
+
+	s.pending.Add(1)
+	s.metrics.requests.Inc(requestQueued)
+	s.emit(request, &response.Event{Event: response.EventQueued})
 	s.cloneQueue.Send(&queue.Message[*Request]{
 		Priority: request.Priority(),
 		Value:    request,
+		Tenant:   request.Tenant,
 	})
+
+	return nil
+}
+
+// schedulingPolicy converts the scheduling config to a queue policy
+func schedulingPolicy(cfg *config.Scheduling) queue.Policy {
+	policy := queue.Policy{
+		AgingInterval: time.Duration(cfg.PriorityAging) * time.Second,
+		TenantLimit:   int(cfg.TenantConcurrency),
+		Tenants:       make(map[string]queue.TenantPolicy, len(cfg.Tenants)),
+	}
+
+	for name, tenant := range cfg.Tenants {
+		policy.Tenants[name] = queue.TenantPolicy{
+			Weight: uint(tenant.Weight),
+			Limit:  int(tenant.Concurrency),
+		}
+	}
+
+	return policy
 }
 
 // start kicks off the background workers
@@ -92,43 +336,57 @@ func (s *Scanner) listenForCloneRequests() {
 	// This should always send things to the scan queue, even if the clone fails.
 	// This ensures that things waiting on responses can mark them as done
 	s.cloneQueue.Recv(func(msg *queue.Message[*Request]) {
+		s.metrics.busyWorkers.Add(1, "clone")
+		defer s.metrics.busyWorkers.Add(-1, "clone")
+
 		request := msg.Value
+		settings := request.settings
+		request.timing.cloneStarted = time.Now()
 		reqResource := request.Resource
-		reqResource.IncludeLogs(s.includeResponseLogs)
-
-		if request.Resource.IsLocal() && !s.allowLocal {
-			reqResource.Error(logger.LocalScanDisabled, "local resources not allowed: request_id=%q", request.ID)
-			s.responseQueue.Send(&queue.Message[*response.Response]{
-				Priority: msg.Priority,
-				Value: &response.Response{
-					ID:        id.ID(),
-					Results:   make([]*response.Result, 0),
-					Logs:      reqResource.Logs(),
-					RequestID: request.ID,
-				},
+		reqResource.IncludeLogs(settings.includeResponseLogs)
+
+		if !request.Resource.IsLocal() {
+			defer s.releaseClone(request)
+		}
+
+		if request.Resource.IsLocal() && !settings.allowLocal {
+			reqResource.Fail(logger.LocalScanDisabled, response.LocalScanDisabled, true, "local resources not allowed")
+			s.emit(request, &response.Event{Event: response.EventCompleted})
+			s.sendResponse(request, msg.Priority, &response.Response{
+				ID:        id.ID(),
+				Results:   make([]*response.Result, 0),
+				Logs:      reqResource.Logs(),
+				RequestID: request.ID,
+				Scanner:   s.scannerInfo(request),
+				Status:    response.StatusFailed,
+				Errors:    reqResource.Errors(),
 			})
 			return
 		}
 
-		if s.cloneTimeout > 0 {
-			logger.Debug("setting clone timeout: request_id=%q resource_id=%q timeout=%v", request.ID, reqResource.ID(), s.cloneTimeout.Seconds())
-			reqResource.SetCloneTimeout(s.cloneTimeout)
+		if settings.cloneTimeout > 0 {
+			request.log().Debug("setting clone timeout", logger.Duration("timeout", settings.cloneTimeout))
+			reqResource.SetCloneTimeout(settings.cloneTimeout)
 		}
 
-		if s.maxScanDepth > 0 && reqResource.Depth() > s.maxScanDepth {
-			logger.Warning("reducing scan depth: request_id=%q resource_id=%q old_depth=%v new_depth=%v", request.ID, reqResource.ID(), reqResource.Depth(), s.maxScanDepth)
-			reqResource.SetDepth(s.maxScanDepth)
+		if settings.maxScanDepth > 0 && reqResource.Depth() > settings.maxScanDepth {
+			request.log().Warning("reducing scan depth", logger.Any("old_depth", reqResource.Depth()), logger.Any("new_depth", settings.maxScanDepth))
+			reqResource.SetDepth(settings.maxScanDepth)
 		}
 
 		if reqResource.Path() == "" {
-			logger.Info("starting clone: request_id=%q resource_id=%q", request.ID, reqResource.ID())
-			if err := reqResource.Clone(s.resourcePath(reqResource)); err != nil {
-				reqResource.Critical(logger.CloneError, "clone error: request_id=%q error=%q", request.ID, err.Error())
+			request.log().Info("starting clone")
+			s.emit(request, &response.Event{Event: response.EventCloneStarted})
+			if err := s.cloneWithRetries(request); err != nil {
+				reqResource.Fail(logger.CloneError, resource.CloneErrorCode(err), true, "clone error", logger.Err(err))
 			}
+			s.emit(request, &response.Event{Event: response.EventCloneFinished})
+			s.metrics.cloneDuration.Observe(time.Since(request.timing.cloneStarted).Seconds(), reqResource.Kind())
 		}
 
 		// Now that it's cloned send it on to the scan queue
-		logger.Info("queueing scan: request_id=%q resource_id=%q", request.ID, reqResource.ID())
+		request.timing.cloneFinished = time.Now()
+		request.log().Info("queueing scan")
 		s.scanQueue.Send(msg)
 	})
 }
@@ -141,48 +399,289 @@ func (s *Scanner) resourcePath(reqResource resource.Resource) string {
 	return filepath.Join(s.resourceFilesPath(reqResource), "clone")
 }
 
+// releaseClone counts what the request's clone wrote against the disk limit
+// now that it's done. The clone is only measured when there's a limit.
+func (s *Scanner) releaseClone(request *Request) {
+	var bytes int64
+	if request.settings.maxResourceBytes > 0 {
+		bytes, _ = fs.DirSize(s.resourceFilesPath(request.Resource))
+	}
+
+	s.diskUsage.release(bytes)
+}
+
 // removeResourceFiles clears out any left over resource files for scan
 func (s *Scanner) removeResourceFiles(reqResource resource.Resource) error {
 	return os.RemoveAll(s.resourceFilesPath(reqResource))
 }
 
+// scannerInfo describes the scanner's current settings for a response
+func (s *Scanner) scannerInfo(request *Request) *response.ScannerInfo {
+	settings := request.settings
+	info := &response.ScannerInfo{
+		Version:  version.ShortVersion(),
+		Backends: make([]string, 0, len(settings.backends)),
+		Timing:   request.timing.durations(),
+	}
+
+	for _, backend := range settings.backends {
+		info.Backends = append(info.Backends, backend.Name())
+	}
+
+	if settings.patterns != nil {
+		info.Patterns = settings.patterns.Info()
+	}
+
+	return info
+}
+
+// finalizeResults adds the secret hash and fingerprint to each result,
+// removes results in the request's baseline or the suppressions, verifies
+// the rest if requested and then applies the strongest of the configured and
+// requested redaction levels. It returns the remaining results and how many
+// were removed by the baseline and by the suppressions.
+func (s *Scanner) finalizeResults(request *Request, results []*response.Result) ([]*response.Result, int, int) {
+	var baselined, suppressed int
+	settings := request.settings
+	redact := max(settings.redact, request.Options.Redact)
+	identity := request.Resource.Identity()
+	ruleFilter := request.Options.RuleFilter.Key()
+
+	for _, result := range results {
+		result.SecretHash = response.HashSecret(settings.secretHashSalt, result.Secret)
+		result.Fingerprint = fingerprint(identity, result)
+		result.RuleFilter = ruleFilter
+	}
+
+	if len(request.Options.Baseline) > 0 {
+		results, baselined = s.applyBaseline(request, results)
+	}
+
+	if settings.suppressions != nil {
+		results, suppressed = s.applySuppressions(request, results)
+	}
+
+	// This has to happen before redaction since verifiers need the secret
+	if request.Options.Verify {
+		if settings.verifiers.Empty() {
+			request.Resource.Warning(logger.ScanDetail, "verify requested but no verifiers are configured")
+		}
+
+		// Bound the whole batch so slow services can't hold up the worker
+		ctx, cancel := context.WithTimeout(context.Background(), settings.verifyTimeout)
+		settings.verifiers.Verify(ctx, results)
+		cancel()
+	}
+
+	for _, result := range results {
+		result.Redact(redact)
+	}
+
+	s.metrics.observeFindings(settings.patterns, results)
+	return results, baselined, suppressed
+}
+
+// dedupeResults removes results for the same secret on the same line of a
+// file, keeping the first one. Since backends run in their configured order,
+// this favors the results of the backends listed first.
+func dedupeResults(results []*response.Result) []*response.Result {
+	seen := make(resultDedupe, len(results))
+	deduped := make([]*response.Result, 0, len(results))
+
+	for _, result := range results {
+		if seen.duplicate(result) {
+			continue
+		}
+
+		deduped = append(deduped, result)
+	}
+
+	return deduped
+}
+
+// resultDedupe holds the versions seen for each dedupe key
+type resultDedupe map[string]map[string]struct{}
+
+// duplicate records the result and returns true if it's the same finding as an
+// earlier one. Results with the same dedupe key are the same finding if they
+// have the same version or if either has no version, since not every backend
+// sets it (e.g. native scans a git repo's checkout rather than its history).
+// Otherwise they're the same secret in different commits.
+func (d resultDedupe) duplicate(result *response.Result) bool {
+	key := resultDedupeKey(result)
+	version := result.Location.Version
+
+	versions, ok := d[key]
+	if !ok {
+		d[key] = map[string]struct{}{version: {}}
+		return false
+	}
+
+	if _, ok := versions[version]; ok || len(version) == 0 {
+		return true
+	}
+
+	if _, ok := versions[""]; ok {
+		return true
+	}
+
+	versions[version] = struct{}{}
+	return false
+}
+
+// resultDedupeKey identifies a finding across backends apart from its
+// version. The columns are left out since backends can report different spans
+// for the same secret.
+func resultDedupeKey(result *response.Result) string {
+	return id.ID(
+		result.Location.Path,
+		fmt.Sprint(result.Location.Start.Line),
+		response.HashSecret("", result.Secret),
+	)
+}
+
+// applyBaseline removes the results found in the request's baseline file and
+// returns how many were removed. The file is only read once per request.
+func (s *Scanner) applyBaseline(request *Request, results []*response.Result) ([]*response.Result, int) {
+	request.baselineOnce.Do(func() {
+		reqResource := request.Resource
+
+		// The baseline is a file on the scanner's host so treat it like any
+		// other local resource
+		if !request.settings.allowLocal {
+			reqResource.Error(logger.LocalScanDisabled, "local baselines not allowed")
+			return
+		}
+
+		baseline, err := LoadBaseline(request.Options.Baseline)
+		if err != nil {
+			reqResource.Error(logger.ScanError, "could not load baseline", logger.Err(err))
+			return
+		}
+
+		request.baseline = baseline
+		reqResource.Info(logger.ScanDetail, "loaded baseline", logger.String("path", request.Options.Baseline), logger.Int("results", len(baseline.keys)))
+	})
+
+	if request.baseline == nil {
+		return results, 0
+	}
+
+	return request.baseline.Filter(results)
+}
+
+// fingerprint identifies a leak independent of how the resource was
+// requested. Be careful changing how this is generated, consumers use it to
+// keep triage history across runs. It includes the salted secret hash so
+// changing secret_hash_salt changes every fingerprint.
+func fingerprint(identity string, result *response.Result) string {
+	return id.ID(
+		identity,
+		result.Location.Version,
+		result.Location.Path,
+		result.Rule.ID,
+		result.SecretHash,
+	)
+}
+
+// applySuppressions removes the results matching the suppressions store and
+// returns the rest with how many were removed
+func (s *Scanner) applySuppressions(request *Request, results []*response.Result) ([]*response.Result, int) {
+	results, removed, err := request.settings.suppressions.Filter(results)
+	if err != nil {
+		request.Resource.Error(logger.ScanError, "could not apply suppressions", logger.Err(err))
+		return results, 0
+	}
+
+	if removed > 0 {
+		request.Resource.Info(logger.ScanDetail, "applied suppressions", logger.Int("removed", removed))
+	}
+
+	return results, removed
+}
+
 // Watch the scan queue for requests
 func (s *Scanner) listenForScanRequests() {
 	s.scanQueue.Recv(func(msg *queue.Message[*Request]) {
+		s.metrics.busyWorkers.Add(1, "scan")
+		defer s.metrics.busyWorkers.Add(-1, "scan")
+
 		request := msg.Value
+		backends := request.settings.backends
+		request.timing.scanStarted = time.Now()
+		s.emit(request, &response.Event{Event: response.EventScanStarted})
 		reqResource := request.Resource
 
 		results := make([]*response.Result, 0)
 
+		if request.Options.Stream {
+			request.Options.stream = s.newResultStream(request, msg.Priority)
+		}
+
 		if fs.PathExists(reqResource.Path()) {
-			for _, backend := range s.backends {
-				logger.Info("starting scan: request_id=%q resource_id=%q scanner_backend=%q", request.ID, reqResource.ID(), backend.Name())
+			var scanErrs []error
+			for _, backend := range backends {
+				request.log().Info("starting scan", logger.String("scanner_backend", backend.Name()))
 
-				backendResults, err := backend.Scan(reqResource)
+				request.Options.progress = s.newScanProgress(request, backend)
+				backendResults, err := backend.Scan(reqResource, &request.Options)
+				request.Options.progress.done()
 				if err != nil {
-					reqResource.Critical(logger.ScanError, "scan error: request_id=%q error=%q", request.ID, err.Error())
+					scanErrs = append(scanErrs, err)
 				}
-				if backendResults != nil {
+				if request.Options.stream != nil {
+					// Backends that don't stream their own results return them here
+					request.Options.stream.add(backendResults...)
+				} else if backendResults != nil {
 					results = append(results, backendResults...)
 				}
 			}
+
+			if len(backends) > 1 && request.Options.stream == nil {
+				results = dedupeResults(results)
+			}
+
+			// The scan only failed if none of the backends finished
+			for _, err := range scanErrs {
+				reqResource.Fail(logger.ScanError, scanErrorCode(err), len(scanErrs) == len(backends), "scan error", logger.Err(err))
+			}
+
 			if err := s.removeResourceFiles(reqResource); err != nil {
-				reqResource.Error(logger.ResourceCleanupError, "resource file cleanup error: request_id=%q error=%q", request.ID, err.Error())
+				reqResource.Error(logger.ResourceCleanupError, "resource file cleanup error", logger.Err(err))
 			}
 		} else {
-			reqResource.Critical(logger.ScanError, "skipping scan due to missing path: request_id=%q", request.ID)
+			// A failed clone has already recorded why so don't record it twice
+			errCode := response.ScanError
+			if len(reqResource.Errors()) > 0 {
+				errCode = response.NoErrorCode
+			}
 
+			reqResource.Fail(logger.ScanError, errCode, true, "skipping scan due to missing path")
 		}
 
-		logger.Info("queueing response: request_id=%q resource_id=%q", request.ID, reqResource.ID())
-		s.responseQueue.Send(&queue.Message[*response.Response]{
-			Priority: msg.Priority,
-			Value: &response.Response{
-				ID:        id.ID(),
-				Results:   results,
-				Logs:      reqResource.Logs(),
-				RequestID: request.ID,
-			},
-		})
+		var scanResponse *response.Response
+		if request.Options.stream != nil {
+			scanResponse = request.Options.stream.summary()
+		} else {
+			results, baselined, suppressed := s.finalizeResults(request, results)
+			scanResponse = &response.Response{
+				ID:         id.ID(),
+				Results:    results,
+				Logs:       reqResource.Logs(),
+				RequestID:  request.ID,
+				Suppressed: suppressed,
+				Baselined:  baselined,
+			}
+		}
+
+		request.timing.scanFinished = time.Now()
+		s.metrics.scanDuration.Observe(request.timing.scanFinished.Sub(request.timing.scanStarted).Seconds(), reqResource.Kind())
+		scanResponse.Scanner = s.scannerInfo(request)
+		scanResponse.Errors = reqResource.Errors()
+		scanResponse.Status = response.ErrorStatus(scanResponse.Errors)
+		s.emit(request, &response.Event{Event: response.EventCompleted, Results: len(scanResponse.Results) + scanResponse.Streamed})
+
+		request.log().Info("queueing response")
+		s.sendResponse(request, msg.Priority, scanResponse)
 	})
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -43,6 +44,10 @@ func (m *mockResource) Clone(path string) error {
 	return m.cloneErr
 }
 
+func (m *mockResource) Identity() string {
+	return "mock"
+}
+
 func (m *mockResource) Path() string {
 	return m.path
 }
@@ -92,17 +97,19 @@ func (b *mockBackend) Name() string {
 	return "mock"
 }
 
-func (b *mockBackend) Scan(resource resource.Resource) ([]*response.Result, error) {
-	mockResource, _ := resource.(*mockResource)
+func (b *mockBackend) Scan(resource resource.Resource, options *RequestOptions) ([]*response.Result, error) {
+	notes := map[string]string{
+		"depth":      fmt.Sprint(resource.Depth()),
+		"clone_path": resource.Path(),
+	}
+
+	// Other test resources (e.g. flakyResource) don't track the timeout
+	if mockResource, ok := resource.(*mockResource); ok {
+		notes["clone_timeout"] = fmt.Sprintf("%d", int(mockResource.cloneTimeout.Seconds()))
+	}
 
 	return []*response.Result{
-		&response.Result{
-			Notes: map[string]string{
-				"depth":         fmt.Sprint(resource.Depth()),
-				"clone_path":    resource.Path(),
-				"clone_timeout": fmt.Sprintf("%d", int(mockResource.cloneTimeout.Seconds())),
-			},
-		},
+		&response.Result{Notes: notes},
 	}, nil
 }
 
@@ -118,9 +125,7 @@ func TestScanner(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		scanner := NewScanner(cfg)
-		scanner.backends = []Backend{
-			&mockBackend{},
-		}
+		updateSettings(scanner, func(settings *settings) { settings.backends = []Backend{&mockBackend{}} })
 
 		request := &Request{
 			ID: "test-request",
@@ -134,7 +139,7 @@ func TestScanner(t *testing.T) {
 
 		var wg sync.WaitGroup
 
-		scanner.Send(request)
+		assert.NoError(t, scanner.Send(request))
 		wg.Add(1)
 
 		go scanner.Recv(func(response *response.Response) {
@@ -142,6 +147,40 @@ func TestScanner(t *testing.T) {
 			assert.Equal(t, response.Results[0].Notes["depth"], fmt.Sprint(request.Resource.Depth()))
 			assert.Equal(t, response.Results[0].Notes["clone_path"], request.Resource.Path())
 			assert.Equal(t, response.Results[0].Notes["clone_timeout"], fmt.Sprint(cfg.Scanner.CloneTimeout))
+			// The scanner info describes what produced the response
+			assert.NotNil(t, response.Scanner)
+			assert.Equal(t, []string{"mock"}, response.Scanner.Backends)
+			assert.NotNil(t, response.Scanner.Patterns)
+			assert.Equal(t, cfg.Scanner.Patterns.Gitleaks.Version, response.Scanner.Patterns.GitleaksVersion)
+			assert.GreaterOrEqual(t, response.Scanner.Timing.ScanMS, int64(0))
+			assert.Equal(t, "success", response.Status)
+			assert.Empty(t, response.Errors)
+			wg.Done()
+		})
+
+		wg.Wait()
+	})
+
+	t.Run("CloneFailure", func(t *testing.T) {
+		scanner := NewScanner(cfg)
+		updateSettings(scanner, func(settings *settings) { settings.backends = []Backend{&mockBackend{}} })
+
+		request := &Request{
+			ID: "test-request",
+			Resource: &mockResource{
+				cloneErr: errors.New("fatal: Authentication failed for 'https://example.com/repo.git/'"),
+			},
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		assert.NoError(t, scanner.Send(request))
+
+		go scanner.Recv(func(resp *response.Response) {
+			assert.Equal(t, response.StatusFailed, resp.Status)
+			assert.Len(t, resp.Errors, 1)
+			assert.Equal(t, response.CloneAuthError, resp.Errors[0].Code)
+			assert.True(t, resp.Errors[0].Fatal)
 			wg.Done()
 		})
 
@@ -167,7 +206,7 @@ func TestScanner(t *testing.T) {
 		var wg sync.WaitGroup
 
 		scanner := NewScanner(cfg)
-		scanner.Send(request)
+		assert.NoError(t, scanner.Send(request))
 		wg.Add(1)
 
 		go scanner.Recv(func(response *response.Response) {
@@ -199,7 +238,7 @@ func TestScanner(t *testing.T) {
 
 		var wg sync.WaitGroup
 
-		scanner.Send(request)
+		assert.NoError(t, scanner.Send(request))
 		wg.Add(1)
 
 		go scanner.Recv(func(response *response.Response) {
@@ -216,3 +255,97 @@ func TestScanner(t *testing.T) {
 
 	})
 }
+
+func TestRequestTimingDurations(t *testing.T) {
+	start := time.Now()
+	timing := requestTiming{
+		queued:        start,
+		cloneStarted:  start.Add(1 * time.Second),
+		cloneFinished: start.Add(3 * time.Second),
+		scanStarted:   start.Add(4 * time.Second),
+		scanFinished:  start.Add(7 * time.Second),
+	}
+
+	assert.Equal(t, response.Timing{QueuedMS: 2000, CloneMS: 2000, ScanMS: 3000}, timing.durations())
+
+	// Stages that didn't happen are zero
+	timing = requestTiming{queued: start, cloneStarted: start.Add(time.Second)}
+	assert.Equal(t, response.Timing{QueuedMS: 1000}, timing.durations())
+}
+
+func TestFingerprint(t *testing.T) {
+	result := &response.Result{
+		SecretHash: response.HashSecret("", "fake"),
+		Rule:       response.Rule{ID: "test-rule"},
+		Location: response.Location{
+			Version: "d5bcb89de5311aaa688cb23d8d2d78cf7cd74f1f",
+			Path:    "keys/tls/another-key.key",
+		},
+	}
+
+	httpsRepo := resource.NewGitRepo("https://github.com/leaktk/fake-leaks.git", &resource.GitRepoOptions{})
+	sshRepo := resource.NewGitRepo("git@github.com:leaktk/fake-leaks", &resource.GitRepoOptions{})
+	otherRepo := resource.NewGitRepo("https://github.com/leaktk/other-leaks.git", &resource.GitRepoOptions{})
+
+	assert.Equal(t, fingerprint(httpsRepo.Identity(), result), fingerprint(sshRepo.Identity(), result))
+	assert.NotEqual(t, fingerprint(httpsRepo.Identity(), result), fingerprint(otherRepo.Identity(), result))
+}
+
+func TestScannerReload(t *testing.T) {
+	tempDir := t.TempDir()
+	newConfig := func() *config.Config {
+		cfg := config.DefaultConfig()
+		cfg.Scanner.Workdir = tempDir
+		cfg.Scanner.Patterns.Autofetch = false
+		cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(tempDir, "gitleaks.toml")
+		return cfg
+	}
+
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, "gitleaks.toml"), []byte(mockConfig), 0600))
+
+	scanner := NewScanner(newConfig())
+	before := scanner.settings.Load()
+	assert.Equal(t, uint(0), before.redact)
+	assert.NotNil(t, before.patterns)
+
+	cfg := newConfig()
+	cfg.Scanner.Redact = 50
+	assert.NoError(t, scanner.Reload(cfg))
+	after := scanner.settings.Load()
+	assert.Equal(t, uint(50), after.redact)
+	// Reload loads the patterns before they're needed by a scan
+	assert.NotEqual(t, fmt.Sprintf("%x", [32]byte{}), after.patterns.GitleaksConfigHash())
+	// The old settings aren't changed for the requests still using them
+	assert.Equal(t, uint(0), before.redact)
+
+	// Patterns that can't be loaded keep the current settings
+	cfg = newConfig()
+	cfg.Scanner.Redact = 100
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(tempDir, "missing.toml")
+	assert.Error(t, scanner.Reload(cfg))
+	assert.Same(t, after, scanner.settings.Load())
+}
+
+// newTestScanner returns a scanner that works in a temp dir and scans with the
+// backends. configure can change the config before the scanner is created.
+func newTestScanner(t *testing.T, configure func(*config.Config), backends ...Backend) *Scanner {
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Workdir = tempDir
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(tempDir, "gitleaks.toml")
+	if configure != nil {
+		configure(cfg)
+	}
+
+	scanner := NewScanner(cfg)
+	updateSettings(scanner, func(settings *settings) { settings.backends = backends })
+
+	return scanner
+}
+
+// updateSettings swaps in a copy of the scanner's settings changed by fn
+func updateSettings(scanner *Scanner, fn func(*settings)) {
+	updated := *scanner.settings.Load()
+	fn(&updated)
+	scanner.settings.Store(&updated)
+}
@@ -0,0 +1,162 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// minisignAlgorithm is the minisign algorithm ID for plain (not
+	// prehashed) Ed25519 signatures
+	minisignAlgorithm = "Ed"
+	// minisignPrehashedAlgorithm is used by minisign when signing without -l
+	minisignPrehashedAlgorithm = "ED"
+	minisignKeyIDSize          = 8
+	minisignTrustedPrefix      = "trusted comment: "
+)
+
+// trustedKey is an Ed25519 public key that pattern signatures are checked
+// against. keyID is only set for minisign keys.
+type trustedKey struct {
+	keyID []byte
+	key   ed25519.PublicKey
+}
+
+// SignatureVerifier checks detached Ed25519 signatures on pattern files
+type SignatureVerifier struct {
+	keys []trustedKey
+}
+
+// NewSignatureVerifier parses the trusted keys. Each key is either a minisign
+// public key or a base64 encoded raw Ed25519 public key.
+func NewSignatureVerifier(encodedKeys []string) (*SignatureVerifier, error) {
+	verifier := &SignatureVerifier{}
+
+	for _, encodedKey := range encodedKeys {
+		key, err := parseTrustedKey(encodedKey)
+		if err != nil {
+			return nil, err
+		}
+
+		verifier.keys = append(verifier.keys, key)
+	}
+
+	return verifier, nil
+}
+
+func parseTrustedKey(encodedKey string) (trustedKey, error) {
+	// Allow pasting the whole minisign.pub file
+	lines := strings.Split(strings.TrimSpace(encodedKey), "\n")
+	encodedKey = strings.TrimSpace(lines[len(lines)-1])
+
+	data, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return trustedKey{}, fmt.Errorf("could not decode trusted key: key=%q error=%q", encodedKey, err)
+	}
+
+	switch len(data) {
+	case ed25519.PublicKeySize:
+		return trustedKey{key: ed25519.PublicKey(data)}, nil
+	case 2 + minisignKeyIDSize + ed25519.PublicKeySize:
+		if string(data[:2]) != minisignAlgorithm {
+			return trustedKey{}, fmt.Errorf("unsupported trusted key algorithm: key=%q", encodedKey)
+		}
+
+		return trustedKey{
+			keyID: data[2 : 2+minisignKeyIDSize],
+			key:   ed25519.PublicKey(data[2+minisignKeyIDSize:]),
+		}, nil
+	}
+
+	return trustedKey{}, fmt.Errorf("invalid trusted key length: key=%q", encodedKey)
+}
+
+// Verify returns an error unless one of the trusted keys signed data. The
+// signature is either a minisign signature file or a base64 encoded raw
+// Ed25519 signature.
+func (v *SignatureVerifier) Verify(data, signature []byte) error {
+	if len(v.keys) == 0 {
+		return errors.New("no trusted keys configured")
+	}
+
+	signature = bytes.TrimSpace(signature)
+	if len(signature) == 0 {
+		return errors.New("missing signature")
+	}
+
+	if bytes.HasPrefix(signature, []byte("untrusted comment:")) {
+		return v.verifyMinisign(data, signature)
+	}
+
+	rawSignature, err := base64.StdEncoding.DecodeString(string(signature))
+	if err != nil || len(rawSignature) != ed25519.SignatureSize {
+		return errors.New("invalid signature format")
+	}
+
+	for _, key := range v.keys {
+		if ed25519.Verify(key.key, data, rawSignature) {
+			return nil
+		}
+	}
+
+	return errors.New("signature does not match any trusted key")
+}
+
+// verifyMinisign checks a minisign signature file. The format is:
+//
+//	untrusted comment: <text>
+//	base64(algorithm || key ID || signature)
+//	trusted comment: <text>
+//	base64(signature of (signature || trusted comment))
+func (v *SignatureVerifier) verifyMinisign(data, signature []byte) error {
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], minisignTrustedPrefix) {
+		return errors.New("invalid minisign signature format")
+	}
+
+	sigData, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sigData) != 2+minisignKeyIDSize+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature format")
+	}
+
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid minisign signature format")
+	}
+
+	algorithm := string(sigData[:2])
+	if algorithm == minisignPrehashedAlgorithm {
+		return errors.New("prehashed minisign signatures are not supported, sign with minisign -l")
+	}
+
+	if algorithm != minisignAlgorithm {
+		return fmt.Errorf("unsupported minisign signature algorithm: algorithm=%q", algorithm)
+	}
+
+	keyID := sigData[2 : 2+minisignKeyIDSize]
+	rawSignature := sigData[2+minisignKeyIDSize:]
+	trustedComment := strings.TrimPrefix(lines[2], minisignTrustedPrefix)
+
+	for _, key := range v.keys {
+		if key.keyID != nil && !bytes.Equal(key.keyID, keyID) {
+			continue
+		}
+
+		if !ed25519.Verify(key.key, data, rawSignature) {
+			continue
+		}
+
+		// The global signature covers the trusted comment
+		if !ed25519.Verify(key.key, append(bytes.Clone(rawSignature), trustedComment...), globalSig) {
+			return errors.New("minisign trusted comment signature is invalid")
+		}
+
+		return nil
+	}
+
+	return errors.New("signature does not match any trusted key")
+}
@@ -0,0 +1,174 @@
+package scanner
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	httpclient "github.com/leaktk/leaktk/pkg/http"
+)
+
+// minisignKeyPair returns a minisign style public key and a function that
+// signs data in the minisign format with the given algorithm
+func minisignKeyPair(t *testing.T, algorithm string) (string, func([]byte) []byte) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	keyID := []byte("01234567")
+	encodedKey := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), publicKey...))
+
+	return "untrusted comment: minisign public key\n" + encodedKey, func(data []byte) []byte {
+		signature := ed25519.Sign(privateKey, data)
+		trustedComment := "timestamp:1700000000"
+		globalSignature := ed25519.Sign(privateKey, append(signature, trustedComment...))
+
+		return []byte(fmt.Sprintf(
+			"untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+			base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), keyID...), signature...)),
+			trustedComment,
+			base64.StdEncoding.EncodeToString(globalSignature),
+		))
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	data := []byte(mockConfig)
+
+	t.Run("RawEd25519", func(t *testing.T) {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+
+		verifier, err := NewSignatureVerifier([]string{base64.StdEncoding.EncodeToString(publicKey)})
+		assert.NoError(t, err)
+
+		signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, data)))
+		assert.NoError(t, verifier.Verify(data, signature))
+		assert.ErrorContains(t, verifier.Verify([]byte("tampered"), signature), "does not match")
+		assert.ErrorContains(t, verifier.Verify(data, nil), "missing signature")
+		assert.ErrorContains(t, verifier.Verify(data, []byte("not a signature")), "invalid signature format")
+	})
+
+	t.Run("Minisign", func(t *testing.T) {
+		publicKey, sign := minisignKeyPair(t, "Ed")
+		otherKey, _ := minisignKeyPair(t, "Ed")
+
+		verifier, err := NewSignatureVerifier([]string{otherKey, publicKey})
+		assert.NoError(t, err)
+		assert.NoError(t, verifier.Verify(data, sign(data)))
+		assert.ErrorContains(t, verifier.Verify([]byte("tampered"), sign(data)), "does not match")
+
+		// Changing the trusted comment breaks the global signature
+		tampered := []byte(strings.Replace(string(sign(data)), "timestamp:1700000000", "timestamp:1800000000", 1))
+		assert.ErrorContains(t, verifier.Verify(data, tampered), "trusted comment signature is invalid")
+	})
+
+	t.Run("MinisignPrehashed", func(t *testing.T) {
+		publicKey, sign := minisignKeyPair(t, "ED")
+		verifier, err := NewSignatureVerifier([]string{publicKey})
+		assert.NoError(t, err)
+		assert.ErrorContains(t, verifier.Verify(data, sign(data)), "prehashed minisign signatures are not supported")
+	})
+
+	t.Run("InvalidKeys", func(t *testing.T) {
+		_, err := NewSignatureVerifier([]string{"not base64!"})
+		assert.ErrorContains(t, err, "could not decode trusted key")
+
+		_, err = NewSignatureVerifier([]string{base64.StdEncoding.EncodeToString([]byte("short"))})
+		assert.ErrorContains(t, err, "invalid trusted key length")
+	})
+}
+
+func TestPatternsSignatures(t *testing.T) {
+	publicKey, sign := minisignKeyPair(t, "Ed")
+	signature := sign([]byte(mockConfig))
+	served := map[string][]byte{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := served[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = io.WriteString(w, string(data))
+	}))
+	defer ts.Close()
+
+	getPatterns := func(t *testing.T, trustedKeys []string) (*Patterns, string) {
+		cfg := config.DefaultConfig()
+		cfg.Scanner.Patterns.Server.URL = ts.URL
+		cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
+		cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(t.TempDir(), "gitleaks.toml")
+		cfg.Scanner.Patterns.TrustedKeys = trustedKeys
+
+		return NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient()), cfg.Scanner.Patterns.Gitleaks.ConfigPath
+	}
+
+	t.Run("Signed", func(t *testing.T) {
+		served["/patterns/gitleaks/x.y.z"] = []byte(mockConfig)
+		served["/patterns/gitleaks/x.y.z.sig"] = signature
+
+		patterns, configPath := getPatterns(t, []string{publicKey})
+		cfg, err := patterns.Gitleaks()
+		assert.NoError(t, err)
+		assert.NotNil(t, cfg)
+
+		cachedSignature, err := os.ReadFile(configPath + ".sig")
+		assert.NoError(t, err)
+		assert.Equal(t, signature, cachedSignature)
+
+		// The cache is verified when it's read back
+		cfg2 := config.DefaultConfig()
+		cfg2.Scanner.Patterns.Autofetch = false
+		cfg2.Scanner.Patterns.Gitleaks.ConfigPath = configPath
+		cfg2.Scanner.Patterns.TrustedKeys = []string{publicKey}
+		_, err = NewPatterns(&cfg2.Scanner.Patterns, httpclient.NewClient()).Gitleaks()
+		assert.NoError(t, err)
+
+		assert.NoError(t, os.WriteFile(configPath, []byte(mockAllowlistOnlyConfig), 0600))
+		_, err = NewPatterns(&cfg2.Scanner.Patterns, httpclient.NewClient()).Gitleaks()
+		assert.ErrorContains(t, err, "could not verify cached patterns")
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		served["/patterns/gitleaks/x.y.z"] = []byte(mockAllowlistOnlyConfig)
+		served["/patterns/gitleaks/x.y.z.sig"] = signature
+
+		patterns, configPath := getPatterns(t, []string{publicKey})
+		_, err := patterns.Gitleaks()
+		assert.ErrorContains(t, err, "could not verify patterns")
+		assert.NoFileExists(t, configPath)
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		served["/patterns/gitleaks/x.y.z"] = []byte(mockConfig)
+		delete(served, "/patterns/gitleaks/x.y.z.sig")
+
+		patterns, configPath := getPatterns(t, []string{publicKey})
+		_, err := patterns.Gitleaks()
+		assert.ErrorContains(t, err, "could not fetch pattern signature")
+		assert.NoFileExists(t, configPath)
+
+		// Without trusted keys signatures aren't required
+		patterns, _ = getPatterns(t, nil)
+		_, err = patterns.Gitleaks()
+		assert.NoError(t, err)
+	})
+
+	t.Run("InvalidTrustedKeys", func(t *testing.T) {
+		patterns, _ := getPatterns(t, []string{"invalid"})
+		_, err := patterns.Gitleaks()
+		assert.ErrorContains(t, err, "could not load trusted keys")
+	})
+}
@@ -0,0 +1,130 @@
+package scanner
+
+import (
+	"sync"
+
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/queue"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// resultStream sends a request's results in chunks as the backends find them
+// instead of holding all of them until the scan is done
+type resultStream struct {
+	scanner   *Scanner
+	request   *Request
+	priority  int
+	chunkSize int
+	// seen holds the dedupe keys and versions of the results so far when
+	// results from more than one backend need to be deduplicated
+	seen resultDedupe
+
+	lock       sync.Mutex
+	pending    []*response.Result
+	sequence   int
+	streamed   int
+	suppressed int
+	baselined  int
+}
+
+// newResultStream returns a stream for the request
+func (s *Scanner) newResultStream(request *Request, priority int) *resultStream {
+	stream := &resultStream{
+		scanner:   s,
+		request:   request,
+		priority:  priority,
+		chunkSize: max(int(request.settings.streamChunkSize), 1),
+	}
+
+	if len(request.settings.backends) > 1 {
+		stream.seen = make(resultDedupe)
+	}
+
+	return stream
+}
+
+// add queues results and sends a chunk each time there are enough of them
+func (rs *resultStream) add(results ...*response.Result) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	for _, result := range results {
+		if rs.seen != nil && rs.seen.duplicate(result) {
+			continue
+		}
+
+		rs.pending = append(rs.pending, result)
+		if len(rs.pending) >= rs.chunkSize {
+			rs.sendChunk()
+		}
+	}
+}
+
+// flush sends any results that haven't been sent yet
+func (rs *resultStream) flush() {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	if len(rs.pending) > 0 {
+		rs.sendChunk()
+	}
+}
+
+// sendChunk finalizes the pending results and sends them as a partial
+// response. Chunks with nothing left after finalizing aren't sent.
+func (rs *resultStream) sendChunk() {
+	results, baselined, suppressed := rs.scanner.finalizeResults(rs.request, rs.pending)
+	rs.pending = nil
+	rs.baselined += baselined
+	rs.suppressed += suppressed
+
+	if len(results) == 0 {
+		return
+	}
+
+	rs.sequence++
+	rs.streamed += len(results)
+	rs.scanner.responseQueue.Send(&queue.Message[*response.Response]{
+		Priority: rs.priority,
+		Value: &response.Response{
+			ID:        id.ID(),
+			Logs:      make([]logger.Entry, 0),
+			RequestID: rs.request.ID,
+			Results:   results,
+			Sequence:  rs.sequence,
+			Partial:   true,
+		},
+	})
+}
+
+// summary returns the final response for the request after flushing the
+// stream
+func (rs *resultStream) summary() *response.Response {
+	rs.flush()
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	return &response.Response{
+		ID:         id.ID(),
+		Logs:       rs.request.Resource.Logs(),
+		RequestID:  rs.request.ID,
+		Results:    make([]*response.Result, 0),
+		Suppressed: rs.suppressed,
+		Baselined:  rs.baselined,
+		Sequence:   rs.sequence + 1,
+		Streamed:   rs.streamed,
+	}
+}
+
+// collect adds the result to results or sends it to the stream if the
+// request is streaming results
+func (o *RequestOptions) collect(results []*response.Result, result *response.Result) []*response.Result {
+	if o.stream != nil {
+		o.stream.add(result)
+		return results
+	}
+
+	return append(results, result)
+}
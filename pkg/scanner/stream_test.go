@@ -0,0 +1,77 @@
+package scanner
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/resource"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// mockManyResultsBackend returns a result on each of the first count lines
+type mockManyResultsBackend struct {
+	count int
+}
+
+func (b *mockManyResultsBackend) Name() string {
+	return "mock-many"
+}
+
+func (b *mockManyResultsBackend) Scan(resource resource.Resource, options *RequestOptions) ([]*response.Result, error) {
+	results := make([]*response.Result, 0, b.count)
+	for i := 1; i <= b.count; i++ {
+		results = append(results, &response.Result{
+			Secret:   "secret",
+			Location: response.Location{Start: response.Point{Line: i}},
+		})
+	}
+
+	return results, nil
+}
+
+func TestScannerStream(t *testing.T) {
+	// The second backend's results are all duplicates of the first's
+	scanner := newTestScanner(
+		t,
+		func(cfg *config.Config) { cfg.Scanner.StreamChunkSize = 2 },
+		&mockManyResultsBackend{count: 5},
+		&mockManyResultsBackend{count: 3},
+	)
+
+	var wg sync.WaitGroup
+	var responses []*response.Response
+	go scanner.Recv(func(response *response.Response) {
+		responses = append(responses, response)
+		wg.Done()
+	})
+
+	// Three chunks and the summary
+	wg.Add(4)
+	assert.NoError(t, scanner.Send(&Request{ID: "stream", Options: RequestOptions{Stream: true}, Resource: &mockResource{}}))
+	wg.Wait()
+
+	// Put them in the order they were sent
+	sort.Slice(responses, func(i, j int) bool { return responses[i].Sequence < responses[j].Sequence })
+	assert.Len(t, responses, 4)
+	for i, chunk := range responses[:3] {
+		assert.True(t, chunk.Partial)
+		assert.Equal(t, "stream", chunk.RequestID)
+		assert.Equal(t, i+1, chunk.Sequence)
+		assert.NotEmpty(t, chunk.Results[0].Fingerprint)
+	}
+
+	assert.Len(t, responses[0].Results, 2)
+	assert.Len(t, responses[1].Results, 2)
+	assert.Len(t, responses[2].Results, 1)
+
+	summary := responses[3]
+	assert.False(t, summary.Partial)
+	assert.Equal(t, 4, summary.Sequence)
+	assert.Equal(t, 5, summary.Streamed)
+	assert.Empty(t, summary.Results)
+	assert.NotNil(t, summary.Scanner)
+}
@@ -0,0 +1,259 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/fs"
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// suppressionDateFormat is the format for suppression expiry dates
+const suppressionDateFormat = "2006-01-02"
+
+// Suppression marks results as triaged so they're left out of responses. All
+// of the criteria that are set must match for a result to be suppressed.
+type Suppression struct {
+	ID          string `json:"id"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Rule        string `json:"rule,omitempty"`
+	// Path is a glob supporting * and ** (see fs.Match)
+	Path       string `json:"path,omitempty"`
+	SecretHash string `json:"secret_hash,omitempty"`
+	Reason     string `json:"reason"`
+	// Expires is a yyyy-mm-dd date (UTC) after which the suppression is ignored
+	Expires string `json:"expires,omitempty"`
+	Created string `json:"created"`
+}
+
+// Suppressions is a local store of suppressions kept in a JSON file. It's
+// reloaded when the file changes so long running scanners pick up changes
+// made by the ignore command.
+type Suppressions struct {
+	entries []*Suppression
+	modTime time.Time
+	mutex   sync.Mutex
+	path    string
+	size    int64
+}
+
+// NewSuppressions returns a store backed by the file at path. The file
+// doesn't need to exist yet.
+func NewSuppressions(path string) *Suppressions {
+	return &Suppressions{
+		path: path,
+	}
+}
+
+// Validate makes sure the suppression can be safely applied
+func (s *Suppression) Validate() error {
+	if len(s.Fingerprint) == 0 && len(s.Rule) == 0 && len(s.Path) == 0 && len(s.SecretHash) == 0 {
+		return errors.New("suppression must set at least one of fingerprint, rule, path or secret_hash")
+	}
+
+	if len(s.Expires) > 0 {
+		if _, err := time.Parse(suppressionDateFormat, s.Expires); err != nil {
+			return fmt.Errorf("invalid expires date: expires=%q error=%q", s.Expires, err)
+		}
+	}
+
+	return nil
+}
+
+// Expired returns true if the suppression's expiry date has passed
+func (s *Suppression) Expired(now time.Time) bool {
+	if len(s.Expires) == 0 {
+		return false
+	}
+
+	expires, err := time.Parse(suppressionDateFormat, s.Expires)
+	if err != nil {
+		// Fail open so that a bad entry can't hide leaks forever
+		return true
+	}
+
+	return !now.UTC().Before(expires)
+}
+
+// Matches returns true if the result meets all of the suppression's criteria
+func (s *Suppression) Matches(result *response.Result) bool {
+	if len(s.Fingerprint) > 0 && s.Fingerprint != result.Fingerprint {
+		return false
+	}
+
+	if len(s.Rule) > 0 && s.Rule != result.Rule.ID {
+		return false
+	}
+
+	if len(s.Path) > 0 && !fs.Match(s.Path, result.Location.Path) {
+		return false
+	}
+
+	if len(s.SecretHash) > 0 && s.SecretHash != result.SecretHash {
+		return false
+	}
+
+	return s.Validate() == nil
+}
+
+// List returns the suppressions in the store
+func (s *Suppressions) List() ([]*Suppression, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return slices.Clone(s.entries), nil
+}
+
+// Add validates and saves a new suppression, setting its ID and created date
+func (s *Suppressions) Add(suppression *Suppression) error {
+	if err := suppression.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	suppression.ID = id.ID()
+	suppression.Created = time.Now().UTC().Format(time.RFC3339)
+
+	return s.save(append(s.entries, suppression))
+}
+
+// Remove deletes the suppression with the ID
+func (s *Suppressions) Remove(suppressionID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	entries := slices.DeleteFunc(slices.Clone(s.entries), func(entry *Suppression) bool {
+		return entry.ID == suppressionID
+	})
+
+	if len(entries) == len(s.entries) {
+		return fmt.Errorf("suppression not found: id=%q", suppressionID)
+	}
+
+	return s.save(entries)
+}
+
+// Filter returns the results that aren't suppressed and how many were
+func (s *Suppressions) Filter(results []*response.Result) ([]*response.Result, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return results, 0, err
+	}
+
+	now := time.Now()
+	active := make([]*Suppression, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if !entry.Expired(now) {
+			active = append(active, entry)
+		}
+	}
+
+	if len(active) == 0 {
+		return results, 0, nil
+	}
+
+	filtered := make([]*response.Result, 0, len(results))
+	for _, result := range results {
+		suppressed := slices.ContainsFunc(active, func(entry *Suppression) bool {
+			return entry.Matches(result)
+		})
+
+		if !suppressed {
+			filtered = append(filtered, result)
+		}
+	}
+
+	return filtered, len(results) - len(filtered), nil
+}
+
+// load reads the file if it has changed since it was last read. The caller
+// must hold the mutex.
+func (s *Suppressions) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.entries = nil
+			s.modTime = time.Time{}
+			s.size = 0
+			return nil
+		}
+
+		return fmt.Errorf("could not stat suppressions: path=%q error=%q", s.path, err)
+	}
+
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size && s.entries != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if err != nil {
+		return fmt.Errorf("could not read suppressions: path=%q error=%q", s.path, err)
+	}
+
+	var entries []*Suppression
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("could not parse suppressions: path=%q error=%q", s.path, err)
+	}
+
+	logger.Debug("loaded suppressions: path=%q count=%d", s.path, len(entries))
+	s.entries = entries
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+
+	return nil
+}
+
+// save writes the entries to the file. The caller must hold the mutex.
+func (s *Suppressions) save(entries []*Suppression) error {
+	if entries == nil {
+		entries = make([]*Suppression, 0)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal suppressions: error=%q", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("could not create suppressions dir: error=%q", err)
+	}
+
+	// Write to a temp file and rename it so a scanner never reads a partial file
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("could not write suppressions: path=%q error=%q", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("could not write suppressions: path=%q error=%q", s.path, err)
+	}
+
+	// Force a reload on the next read to pick up the new mod time
+	s.entries = nil
+
+	return nil
+}
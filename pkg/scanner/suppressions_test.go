@@ -0,0 +1,86 @@
+package scanner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+func TestSuppressions(t *testing.T) {
+	resultA := &response.Result{
+		Fingerprint: "fp-a",
+		SecretHash:  "hash-a",
+		Rule:        response.Rule{ID: "rule-a"},
+		Location:    response.Location{Path: "tests/fixtures/keys.txt"},
+	}
+	resultB := &response.Result{
+		Fingerprint: "fp-b",
+		SecretHash:  "hash-b",
+		Rule:        response.Rule{ID: "rule-b"},
+		Location:    response.Location{Path: "src/config.go"},
+	}
+	results := []*response.Result{resultA, resultB}
+
+	t.Run("Validate", func(t *testing.T) {
+		assert.Error(t, (&Suppression{Reason: "no criteria"}).Validate())
+		assert.Error(t, (&Suppression{Rule: "rule-a", Expires: "next week"}).Validate())
+		assert.NoError(t, (&Suppression{Rule: "rule-a", Expires: "2030-01-01"}).Validate())
+	})
+
+	t.Run("Matches", func(t *testing.T) {
+		assert.True(t, (&Suppression{Fingerprint: "fp-a"}).Matches(resultA))
+		assert.True(t, (&Suppression{SecretHash: "hash-a"}).Matches(resultA))
+		assert.True(t, (&Suppression{Path: "tests/**"}).Matches(resultA))
+		assert.False(t, (&Suppression{Path: "tests/**"}).Matches(resultB))
+		// All criteria must match
+		assert.True(t, (&Suppression{Rule: "rule-a", Path: "tests/**"}).Matches(resultA))
+		assert.False(t, (&Suppression{Rule: "rule-b", Path: "tests/**"}).Matches(resultA))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		assert.False(t, (&Suppression{Rule: "rule-a"}).Expired(now))
+		assert.False(t, (&Suppression{Rule: "rule-a", Expires: "2025-06-02"}).Expired(now))
+		assert.True(t, (&Suppression{Rule: "rule-a", Expires: "2025-06-01"}).Expired(now))
+	})
+
+	t.Run("AddFilterRemove", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "leaktk", "suppressions.json")
+		suppressions := NewSuppressions(path)
+
+		// A missing file suppresses nothing
+		filtered, removed, err := suppressions.Filter(results)
+		assert.NoError(t, err)
+		assert.Equal(t, results, filtered)
+		assert.Equal(t, 0, removed)
+
+		assert.Error(t, suppressions.Add(&Suppression{Reason: "no criteria"}))
+
+		suppression := &Suppression{Path: "tests/**", Reason: "test fixtures"}
+		assert.NoError(t, suppressions.Add(suppression))
+		assert.NotEmpty(t, suppression.ID)
+		assert.NoError(t, suppressions.Add(&Suppression{Rule: "rule-b", Reason: "expired", Expires: "2000-01-01"}))
+
+		// Another store on the same file sees the changes
+		entries, err := NewSuppressions(path).List()
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+
+		filtered, removed, err = suppressions.Filter(results)
+		assert.NoError(t, err)
+		assert.Equal(t, []*response.Result{resultB}, filtered)
+		assert.Equal(t, 1, removed)
+
+		assert.NoError(t, suppressions.Remove(suppression.ID))
+		assert.Error(t, suppressions.Remove(suppression.ID))
+
+		filtered, removed, err = suppressions.Filter(results)
+		assert.NoError(t, err)
+		assert.Equal(t, results, filtered)
+		assert.Equal(t, 0, removed)
+	})
+}
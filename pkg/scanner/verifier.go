@@ -0,0 +1,365 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+// maxVerifierBodySize limits how much of a verifier response is read
+const maxVerifierBodySize = 1024 * 1024 // 1 MiB
+
+// defaultVerifierTimeout is used if a verifier doesn't set a timeout
+const defaultVerifierTimeout = 10 * time.Second
+
+// Verifier checks whether the secret in a result is live
+type Verifier interface {
+	Name() string
+	// Verify returns one of the response.Verification* statuses
+	Verify(ctx context.Context, result *response.Result) (string, error)
+}
+
+// Verifiers holds the registered verifiers keyed by rule ID and tag
+type Verifiers struct {
+	byRule map[string]Verifier
+	byTag  map[string]Verifier
+}
+
+// NewVerifiers returns a registry with a HTTPVerifier for each config entry.
+// Invalid entries are logged and skipped.
+func NewVerifiers(cfgs []config.Verifier, client *http.Client) *Verifiers {
+	verifiers := &Verifiers{
+		byRule: make(map[string]Verifier),
+		byTag:  make(map[string]Verifier),
+	}
+
+	for _, cfg := range cfgs {
+		verifier, err := NewHTTPVerifier(cfg, client)
+		if err != nil {
+			logger.Error("could not load verifier: name=%q error=%q", cfg.Name, err)
+			continue
+		}
+
+		verifiers.Register(verifier, cfg.Rules, cfg.Tags)
+	}
+
+	return verifiers
+}
+
+// Register adds a verifier for results with any of the rule IDs or tags.
+// Rule IDs take priority over tags when looking up a verifier.
+func (v *Verifiers) Register(verifier Verifier, rules, tags []string) {
+	for _, rule := range rules {
+		v.byRule[rule] = verifier
+	}
+
+	for _, tag := range tags {
+		v.byTag[tag] = verifier
+	}
+}
+
+// Lookup returns the verifier for the result or nil if there isn't one
+func (v *Verifiers) Lookup(result *response.Result) Verifier {
+	if verifier, ok := v.byRule[result.Rule.ID]; ok {
+		return verifier
+	}
+
+	for _, tag := range result.Rule.Tags {
+		if verifier, ok := v.byTag[tag]; ok {
+			return verifier
+		}
+	}
+
+	return nil
+}
+
+// Empty returns true if no verifiers are registered
+func (v *Verifiers) Empty() bool {
+	return len(v.byRule) == 0 && len(v.byTag) == 0
+}
+
+// Verify sets the verification status on each result. Each secret is only
+// checked once per verifier. Results that haven't been checked when the
+// context is done are set to VerificationError.
+func (v *Verifiers) Verify(ctx context.Context, results []*response.Result) {
+	checked := make(map[string]string)
+
+	for _, result := range results {
+		verifier := v.Lookup(result)
+		if verifier == nil {
+			result.Verification = response.VerificationUnknown
+			continue
+		}
+
+		if ctx.Err() != nil {
+			result.Verification = response.VerificationError
+			continue
+		}
+
+		key := verifier.Name() + "\n" + result.SecretHash
+		if status, ok := checked[key]; ok {
+			result.Verification = status
+			continue
+		}
+
+		status, err := verifier.Verify(ctx, result)
+		if err != nil {
+			logger.Warning("could not verify result: verifier=%q result_id=%q error=%q", verifier.Name(), result.ID, err)
+			status = response.VerificationError
+		}
+
+		checked[key] = status
+		result.Verification = status
+	}
+}
+
+// verifierTemplateData is what's available to the verifier templates
+type verifierTemplateData struct {
+	Secret string
+	Match  string
+	RuleID string
+}
+
+// HTTPVerifier verifies secrets by making a templated HTTP request and
+// checking the response status and body
+type HTTPVerifier struct {
+	client        *http.Client
+	body          *template.Template
+	headers       map[string]*template.Template
+	invalidBody   *regexp.Regexp
+	invalidStatus []int
+	limiter       *rateLimiter
+	method        *template.Template
+	name          string
+	timeout       time.Duration
+	url           *template.Template
+	validBody     *regexp.Regexp
+	validStatus   []int
+}
+
+// NewHTTPVerifier returns a verifier built from the config
+func NewHTTPVerifier(cfg config.Verifier, client *http.Client) (*HTTPVerifier, error) {
+	var err error
+
+	if len(cfg.Name) == 0 {
+		return nil, fmt.Errorf("verifier name is required")
+	}
+
+	if len(cfg.URL) == 0 {
+		return nil, fmt.Errorf("verifier url is required")
+	}
+
+	// The requests carry the secrets so don't send them in the clear
+	if !strings.HasPrefix(strings.ToLower(cfg.URL), "https://") {
+		return nil, fmt.Errorf("verifier url must use https: url=%q", cfg.URL)
+	}
+
+	verifier := &HTTPVerifier{
+		client:        client,
+		headers:       make(map[string]*template.Template, len(cfg.Headers)),
+		invalidStatus: cfg.InvalidStatus,
+		limiter:       newRateLimiter(cfg.RateLimit),
+		name:          cfg.Name,
+		timeout:       time.Duration(cfg.Timeout) * time.Second,
+		validStatus:   cfg.ValidStatus,
+	}
+
+	if verifier.timeout == 0 {
+		verifier.timeout = defaultVerifierTimeout
+	}
+
+	if len(verifier.validStatus) == 0 {
+		verifier.validStatus = []int{http.StatusOK}
+	}
+
+	if len(verifier.invalidStatus) == 0 {
+		verifier.invalidStatus = []int{http.StatusUnauthorized, http.StatusForbidden}
+	}
+
+	method := cfg.Method
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+
+	if verifier.method, err = parseVerifierTemplate("method", method); err != nil {
+		return nil, err
+	}
+
+	if verifier.url, err = parseVerifierTemplate("url", cfg.URL); err != nil {
+		return nil, err
+	}
+
+	if verifier.body, err = parseVerifierTemplate("body", cfg.Body); err != nil {
+		return nil, err
+	}
+
+	for name, value := range cfg.Headers {
+		if verifier.headers[name], err = parseVerifierTemplate("header "+name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.ValidBody) > 0 {
+		if verifier.validBody, err = regexp.Compile(cfg.ValidBody); err != nil {
+			return nil, fmt.Errorf("invalid valid_body: error=%q", err)
+		}
+	}
+
+	if len(cfg.InvalidBody) > 0 {
+		if verifier.invalidBody, err = regexp.Compile(cfg.InvalidBody); err != nil {
+			return nil, fmt.Errorf("invalid invalid_body: error=%q", err)
+		}
+	}
+
+	return verifier, nil
+}
+
+// Name returns the name of the verifier
+func (v *HTTPVerifier) Name() string {
+	return v.name
+}
+
+// Verify makes the HTTP request and maps the response to a status
+func (v *HTTPVerifier) Verify(ctx context.Context, result *response.Result) (string, error) {
+	data := verifierTemplateData{
+		Secret: result.Secret,
+		Match:  result.Match,
+		RuleID: result.Rule.ID,
+	}
+
+	method, err := renderVerifierTemplate(v.method, data)
+	if err != nil {
+		return response.VerificationError, err
+	}
+
+	url, err := renderVerifierTemplate(v.url, data)
+	if err != nil {
+		return response.VerificationError, err
+	}
+
+	body, err := renderVerifierTemplate(v.body, data)
+	if err != nil {
+		return response.VerificationError, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), url, strings.NewReader(body))
+	if err != nil {
+		return response.VerificationError, err
+	}
+
+	for name, tmpl := range v.headers {
+		value, err := renderVerifierTemplate(tmpl, data)
+		if err != nil {
+			return response.VerificationError, err
+		}
+
+		request.Header.Set(name, value)
+	}
+
+	if err := v.limiter.Wait(ctx); err != nil {
+		return response.VerificationError, err
+	}
+
+	resp, err := v.client.Do(request)
+	if err != nil {
+		return response.VerificationError, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxVerifierBodySize))
+	if err != nil {
+		return response.VerificationError, err
+	}
+
+	if slices.Contains(v.validStatus, resp.StatusCode) && (v.validBody == nil || v.validBody.Match(respBody)) {
+		return response.VerificationValid, nil
+	}
+
+	if slices.Contains(v.invalidStatus, resp.StatusCode) || (v.invalidBody != nil && v.invalidBody.Match(respBody)) {
+		return response.VerificationInvalid, nil
+	}
+
+	return response.VerificationUnknown, nil
+}
+
+func parseVerifierTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: error=%q", name, err)
+	}
+
+	return tmpl, nil
+}
+
+func renderVerifierTemplate(tmpl *template.Template, data verifierTemplateData) (string, error) {
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("could not render %s template: error=%q", tmpl.Name(), err)
+	}
+
+	return buf.String(), nil
+}
+
+// rateLimiter spaces out calls so they happen at most perSecond times a second
+type rateLimiter struct {
+	interval time.Duration
+	mutex    sync.Mutex
+	next     time.Time
+}
+
+// newRateLimiter returns a limiter. A perSecond of 0 or less means no limit.
+func newRateLimiter(perSecond float64) *rateLimiter {
+	limiter := &rateLimiter{}
+
+	if perSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+
+	return limiter
+}
+
+// Wait blocks until the next call is allowed or the context is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+	wait := l.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	l.next = now.Add(wait + l.interval)
+	l.mutex.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
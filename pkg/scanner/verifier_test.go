@@ -0,0 +1,174 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/response"
+)
+
+func TestHTTPVerifier(t *testing.T) {
+	var requests atomic.Int32
+
+	// Stands in for a service like the GitHub API
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+
+		switch r.Header.Get("Authorization") {
+		case "token live-token":
+			assert.Equal(t, "/user", r.URL.Path)
+			assert.Equal(t, "rule=github-pat", string(body))
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"login": "leaktk"}`)
+		case "token dead-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "token suspended-token":
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.WriteString(w, `{"message": "suspended"}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := config.Verifier{
+		Name:        "github",
+		Rules:       []string{"github-pat"},
+		Tags:        []string{"type:github-token"},
+		Method:      "POST",
+		URL:         ts.URL + "/user",
+		Headers:     map[string]string{"Authorization": "token {{ .Secret }}"},
+		Body:        "rule={{ .RuleID }}",
+		ValidBody:   `"login"`,
+		InvalidBody: `suspended`,
+	}
+
+	newResult := func(secret, ruleID string, tags ...string) *response.Result {
+		return &response.Result{
+			Secret:     secret,
+			SecretHash: response.HashSecret("", secret),
+			Rule:       response.Rule{ID: ruleID, Tags: tags},
+		}
+	}
+
+	t.Run("Statuses", func(t *testing.T) {
+		verifier, err := NewHTTPVerifier(cfg, ts.Client())
+		assert.NoError(t, err)
+
+		tests := []struct {
+			secret   string
+			expected string
+		}{
+			{"live-token", response.VerificationValid},
+			{"dead-token", response.VerificationInvalid},
+			{"suspended-token", response.VerificationInvalid},
+			{"other-token", response.VerificationUnknown},
+		}
+
+		for _, test := range tests {
+			status, err := verifier.Verify(context.Background(), newResult(test.secret, "github-pat"))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, status, test.secret)
+		}
+	})
+
+	t.Run("ConnectionError", func(t *testing.T) {
+		brokenCfg := cfg
+		brokenCfg.URL = "https://127.0.0.1:0/user"
+		verifier, err := NewHTTPVerifier(brokenCfg, ts.Client())
+		assert.NoError(t, err)
+
+		status, err := verifier.Verify(context.Background(), newResult("live-token", "github-pat"))
+		assert.Error(t, err)
+		assert.Equal(t, response.VerificationError, status)
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		_, err := NewHTTPVerifier(config.Verifier{Name: "bad", URL: "{{ .Secret"}, nil)
+		assert.Error(t, err)
+		_, err = NewHTTPVerifier(config.Verifier{Name: "bad", URL: "https://x", ValidBody: "("}, nil)
+		assert.Error(t, err)
+		_, err = NewHTTPVerifier(config.Verifier{URL: "https://x"}, nil)
+		assert.Error(t, err)
+		_, err = NewHTTPVerifier(config.Verifier{Name: "plain", URL: "http://x"}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Registry", func(t *testing.T) {
+		requests.Store(0)
+		verifiers := NewVerifiers([]config.Verifier{cfg}, ts.Client())
+		assert.False(t, verifiers.Empty())
+
+		results := []*response.Result{
+			newResult("live-token", "github-pat"),
+			newResult("dead-token", "other-rule", "type:github-token"),
+			newResult("live-token", "other-rule"),
+			// Same secret and verifier as the first result so no new request
+			newResult("live-token", "github-pat"),
+		}
+
+		verifiers.Verify(context.Background(), results)
+		assert.Equal(t, response.VerificationValid, results[0].Verification)
+		assert.Equal(t, response.VerificationInvalid, results[1].Verification)
+		assert.Equal(t, response.VerificationUnknown, results[2].Verification)
+		assert.Equal(t, response.VerificationValid, results[3].Verification)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		requests.Store(0)
+		verifiers := NewVerifiers([]config.Verifier{cfg}, ts.Client())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results := []*response.Result{
+			newResult("live-token", "github-pat"),
+			newResult("live-token", "other-rule"),
+		}
+
+		verifiers.Verify(ctx, results)
+		assert.Equal(t, response.VerificationError, results[0].Verification)
+		assert.Equal(t, response.VerificationUnknown, results[1].Verification)
+		assert.Equal(t, int32(0), requests.Load())
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("Unlimited", func(t *testing.T) {
+		limiter := newRateLimiter(0)
+		start := time.Now()
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, limiter.Wait(context.Background()))
+		}
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("Limited", func(t *testing.T) {
+		limiter := newRateLimiter(20)
+		start := time.Now()
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, limiter.Wait(context.Background()))
+		}
+		// The first call is immediate and the next three wait 50ms each
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		limiter := newRateLimiter(0.1)
+		assert.NoError(t, limiter.Wait(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Error(t, limiter.Wait(ctx))
+	})
+}
@@ -12,7 +12,7 @@ var Version = ""
 var Commit = ""
 
 // GlobalUserAgent the useragent used by our http requests
-var GlobalUserAgent = fmt.Sprintf("leaktk/%s (%s %s)", shortVersion(), runtime.GOOS, runtime.GOARCH)
+var GlobalUserAgent = fmt.Sprintf("leaktk/%s (%s %s)", ShortVersion(), runtime.GOOS, runtime.GOARCH)
 
 // PrintVersion prints the version details to stdout
 func PrintVersion() {
@@ -27,7 +27,8 @@ func PrintVersion() {
 	}
 }
 
-func shortVersion() string {
+// ShortVersion returns the version and commit in the form version@commit
+func ShortVersion() string {
 	if len(Version) > 0 {
 		if len(Commit) > 0 {
 			return Version + "@" + Commit